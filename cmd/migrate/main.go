@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/db"
+)
+
+const usage = `Usage: migrate <command>
+
+Applies the database migrations embedded in the binary to the database in DB_URL.
+
+Commands:
+  up           apply all pending migrations
+  down [N]     revert the last N applied migrations (1 by default)
+  status       list migrations and whether they are applied
+`
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	url := os.Getenv("DB_URL")
+	if url == "" {
+		fmt.Fprintln(os.Stderr, "DB_URL was not set")
+		os.Exit(1)
+	}
+
+	database, err := db.NewDB(ctx, url, db.Options{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initialising the database: %s\n", err)
+		os.Exit(1)
+	}
+	defer database.Close()
+
+	if err := run(ctx, database, os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		database.Close()
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, database *db.DB, args []string) error {
+	switch args[0] {
+	case "up":
+		applied, err := database.MigrateUp(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("number of migrations to revert must be a positive integer: %q", args[1])
+			}
+			steps = n
+		}
+
+		reverted, err := database.MigrateDown(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migrations\n", reverted)
+
+	case "status":
+		states, err := database.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range states {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+
+	return nil
+}
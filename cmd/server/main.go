@@ -4,18 +4,27 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/achere/homework-pack-sizes/internal/cache"
 	"github.com/achere/homework-pack-sizes/internal/db"
+	"github.com/achere/homework-pack-sizes/internal/file"
+	"github.com/achere/homework-pack-sizes/internal/memory"
+	"github.com/achere/homework-pack-sizes/internal/pack"
 	"github.com/achere/homework-pack-sizes/internal/server"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	// Orchestrators stop containers with SIGTERM
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
@@ -26,14 +35,22 @@ func main() {
 		os.Exit(1)
 	}
 
-	db, err := db.NewDB(ctx, app.Config.DbUrl)
+	shutdownTracing, err := app.SetupTracing(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error initialising tracing: %s", err)
+		os.Exit(1)
+	}
+
+	repo, closeRepo, err := openRepo(ctx, app, logger)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error initialising the database: %s", err)
 		os.Exit(1)
 	}
-	logger.Info("Connected to the DB")
 
-	app.SizeRepo = db
+	app.SizeRepo = repo
+	app.CalcRepo = repo
+	app.AuditRepo = repo
+	app.KeyRepo = repo
 
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", app.Config.Port),
@@ -48,24 +65,141 @@ func main() {
 		}
 	}()
 
+	var grpcServer *grpc.Server
+	if app.Config.GRPCPort > 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", app.Config.GRPCPort))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error listening for gRPC: %s\n", err)
+			os.Exit(1)
+		}
+		grpcServer = app.NewGRPCServer()
+
+		go func() {
+			logger.Info("gRPC server listening", "addr", lis.Addr().String())
+			if err := grpcServer.Serve(lis); err != nil {
+				fmt.Fprintf(os.Stderr, "error serving gRPC: %s\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	// Watcher goroutine for graceful shutdown
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		<-ctx.Done()
+		// Another interrupt stops the server right away
+		cancel()
+
+		// Load balancers stop sending requests once /readyz fails, so the in-flight ones can finish
+		app.StartShutdown()
+		if app.Config.ShutdownDelay > 0 {
+			logger.Info("Shutting down", "delay", app.Config.ShutdownDelay)
+			time.Sleep(app.Config.ShutdownDelay)
+		}
 
 		shutdownCtx := context.Background()
 		shutdownCtx, cancel := context.WithTimeout(shutdownCtx, 10*time.Second)
 		defer cancel()
 
-		go func() {
-			db.Close()
-		}()
-
+		if grpcServer != nil {
+			// GracefulStop waits for streams without a deadline, so it's cut short along with the HTTP server
+			go func() {
+				<-shutdownCtx.Done()
+				grpcServer.Stop()
+			}()
+		}
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
 			fmt.Fprintf(os.Stderr, "error shutting down http server: %s\n", err)
 		}
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		// In-flight requests may still use the database until both servers have stopped
+		closeRepo()
+		if err := shutdownTracing(shutdownCtx); err != nil {
+			fmt.Fprintf(os.Stderr, "error flushing traces: %s\n", err)
+		}
 	}()
 	wg.Wait()
 }
+
+type repo interface {
+	pack.PackSizeRepo
+	pack.CalculationRepo
+	pack.AuditRepo
+	pack.APIKeyRepo
+}
+
+// cachedRepo serves pack sizes through a cache and everything else directly
+type cachedRepo struct {
+	*cache.SizeRepo
+	pack.CalculationRepo
+	pack.AuditRepo
+	pack.APIKeyRepo
+}
+
+// openRepo selects the repository implementation by the scheme of DB_URL:
+// memory:// keeps everything in memory, file://<path> persists to a JSON file
+// and postgres:// or postgresql:// connects to a Postgres database.
+func openRepo(ctx context.Context, app *server.App, logger *slog.Logger) (repo, func(), error) {
+	config := app.Config
+	scheme, rest, _ := strings.Cut(config.DbUrl, "://")
+
+	switch scheme {
+	case "memory":
+		logger.Info("Using in-memory storage, data will be lost on exit")
+		return memory.NewRepo(), func() {}, nil
+
+	case "file":
+		repo, err := file.Open(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Info("Using file storage", "path", rest)
+		return repo, func() { repo.Close() }, nil
+
+	case "postgres", "postgresql":
+		db, err := db.NewDB(ctx, config.DbUrl, db.Options{
+			QueryTimeout: config.DBQueryTimeout,
+			MaxRetries:   config.DBMaxRetries,
+			RetryBackoff: config.DBRetryBackoff,
+			MaxConns:     config.DBMaxConns,
+			MinConns:     config.DBMinConns,
+			ReplicaURL:   config.DBReplicaURL,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Info("Connected to the DB")
+		app.PoolStats = func() any { return db.PoolStats() }
+		app.ReadyChecks = map[string]server.CheckFunc{"database": db.Ping, "migrations": db.CheckMigrations}
+		if err := app.RegisterCollector(db.Collector()); err != nil {
+			db.Close()
+			return nil, nil, fmt.Errorf("failed to register DB metrics: %w", err)
+		}
+
+		if config.MigrateOnStart {
+			applied, err := db.MigrateUp(ctx)
+			if err != nil {
+				db.Close()
+				return nil, nil, fmt.Errorf("failed to migrate: %w", err)
+			}
+			logger.Info("Migrated the DB", "applied", applied)
+		}
+
+		if config.SizeCacheTTL < 0 {
+			return db, db.Close, nil
+		}
+
+		// Other instances announce their saves, so cached sizes are only as stale as the notification delay
+		sizes := cache.NewSizeRepo(db, config.SizeCacheTTL, logger)
+		go db.ListenPackSizes(ctx, logger, sizes.Invalidate)
+
+		return cachedRepo{SizeRepo: sizes, CalculationRepo: db, AuditRepo: db, APIKeyRepo: db}, db.Close, nil
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported DB_URL scheme %q, expected memory, file or postgres", scheme)
+	}
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"golang.org/x/sync/singleflight"
+)
+
+// SizeRepo is a pack.PackSizeRepo decorator serving the latest pack sizes from memory.
+// The cached sizes are invalidated on local saves, by Invalidate(), after ttl passes and when the next
+// scheduled version takes effect. If the underlying repository fails while the cache is invalid,
+// the last known sizes are served instead.
+type SizeRepo struct {
+	pack.PackSizeRepo
+
+	ttl    time.Duration
+	logger *slog.Logger
+	now    func() time.Time
+	// fetches lets a single caller fetch the sizes on a miss while the others wait for it
+	fetches singleflight.Group
+
+	mu        sync.Mutex
+	set       pack.SizeSet
+	hasSet    bool // set holds the last known sizes
+	expiresAt time.Time
+	// generation is incremented by Invalidate(), so sizes fetched before aren't cached
+	// and callers after it don't wait for them
+	generation uint64
+}
+
+// NewSizeRepo wraps repo with a cache whose entries expire after ttl
+func NewSizeRepo(repo pack.PackSizeRepo, ttl time.Duration, logger *slog.Logger) *SizeRepo {
+	return &SizeRepo{
+		PackSizeRepo: repo,
+		ttl:          ttl,
+		logger:       logger,
+		now:          time.Now,
+	}
+}
+
+// GetPackSizes serves the cached sizes or fetches them. The lock isn't held while fetching,
+// and callers waiting for the fetch of another one give up when their own ctx is done.
+func (c *SizeRepo) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
+	c.mu.Lock()
+	if c.hasSet && c.now().Before(c.expiresAt) {
+		set := cloneSizeSet(c.set)
+		c.mu.Unlock()
+		return set, nil
+	}
+	generation := c.generation
+	c.mu.Unlock()
+
+	// The fetch outlives the caller that started it if the others still wait for it
+	fetchCtx := context.WithoutCancel(ctx)
+	result := c.fetches.DoChan(strconv.FormatUint(generation, 10), func() (any, error) {
+		return c.fetch(fetchCtx, generation)
+	})
+
+	select {
+	case <-ctx.Done():
+		return pack.SizeSet{}, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return pack.SizeSet{}, res.Err
+		}
+		return cloneSizeSet(res.Val.(pack.SizeSet)), nil
+	}
+}
+
+// fetch gets the sizes from the underlying repository and caches them unless the cache was invalidated meanwhile.
+// They expire after ttl or when the next scheduled version takes effect, whichever is sooner.
+func (c *SizeRepo) fetch(ctx context.Context, generation uint64) (pack.SizeSet, error) {
+	// Versions taking effect while the sizes are fetched are after now as well, so they aren't missed
+	now := c.now()
+
+	set, err := c.PackSizeRepo.GetPackSizes(ctx)
+	if err != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if !c.hasSet {
+			return pack.SizeSet{}, err
+		}
+
+		c.logger.Warn("Serving last known pack sizes", "version", c.set.Version, "err", err)
+		return cloneSizeSet(c.set), nil
+	}
+
+	expiresAt := now.Add(c.ttl)
+	if next, err := c.PackSizeRepo.GetNextEffectiveFrom(ctx, now); err != nil {
+		// Without the schedule the sizes can't be cached, but they are still served
+		c.logger.Warn("Not caching pack sizes without the next scheduled version", "err", err)
+		expiresAt = time.Time{}
+	} else if !next.IsZero() && next.Before(expiresAt) {
+		expiresAt = next
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation {
+		c.set = cloneSizeSet(set)
+		c.hasSet = true
+		c.expiresAt = expiresAt
+	}
+
+	return set, nil
+}
+
+func (c *SizeRepo) StorePackSizes(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+	stored, err := c.PackSizeRepo.StorePackSizes(ctx, set)
+	if err == nil {
+		c.Invalidate()
+	}
+
+	return stored, err
+}
+
+func (c *SizeRepo) CompareAndStorePackSizes(ctx context.Context, expectedVersion int, set pack.SizeSet) (pack.SizeSet, error) {
+	stored, err := c.PackSizeRepo.CompareAndStorePackSizes(ctx, expectedVersion, set)
+	if err == nil {
+		c.Invalidate()
+	}
+
+	return stored, err
+}
+
+func (c *SizeRepo) UpdatePackSizes(
+	ctx context.Context,
+	author string,
+	update func(pack.SizeSet) ([]int, error),
+) (pack.SizeSet, error) {
+	stored, err := c.PackSizeRepo.UpdatePackSizes(ctx, author, update)
+	if err == nil {
+		c.Invalidate()
+	}
+
+	return stored, err
+}
+
+func (c *SizeRepo) ApplyPackSizes(
+	ctx context.Context,
+	plan func([]pack.SizeSet) (pack.SizeSetChanges, error),
+) ([]pack.SizeSet, error) {
+	stored, err := c.PackSizeRepo.ApplyPackSizes(ctx, plan)
+	if err == nil {
+		c.Invalidate()
+	}
+
+	return stored, err
+}
+
+// Invalidate makes the next GetPackSizes() fetch the sizes from the underlying repository.
+// The last known sizes are kept as a fallback.
+func (c *SizeRepo) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expiresAt = time.Time{}
+	c.generation++
+}
+
+func cloneSizeSet(set pack.SizeSet) pack.SizeSet {
+	set.Sizes = append([]int(nil), set.Sizes...)
+	return set
+}
@@ -0,0 +1,274 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/memory"
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/achere/homework-pack-sizes/internal/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingRepo counts reads of the latest pack sizes and fails them while err is set
+type countingRepo struct {
+	pack.PackSizeRepo
+	reads int
+	err   error
+}
+
+func (r *countingRepo) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
+	r.reads++
+	if r.err != nil {
+		return pack.SizeSet{}, r.err
+	}
+	return r.PackSizeRepo.GetPackSizes(ctx)
+}
+
+func newTestCache(t *testing.T) (*SizeRepo, *countingRepo, *time.Time) {
+	t.Helper()
+
+	repo := &countingRepo{PackSizeRepo: memory.NewRepo()}
+	c := NewSizeRepo(repo, time.Minute, slog.New(slog.DiscardHandler))
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	_, err := repo.StorePackSizes(context.Background(), pack.SizeSet{Sizes: []int{250, 500}})
+	require.NoError(t, err)
+
+	return c, repo, &now
+}
+
+func TestRepo(t *testing.T) {
+	repotest.TestPackSizeRepo(t, func(t *testing.T) pack.PackSizeRepo {
+		return NewSizeRepo(memory.NewRepo(), time.Minute, slog.New(slog.DiscardHandler))
+	})
+}
+
+func TestSizeRepo_Hit(t *testing.T) {
+	c, repo, _ := newTestCache(t)
+	ctx := context.Background()
+
+	for range 3 {
+		set, err := c.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []int{250, 500}, set.Sizes)
+	}
+	assert.Equal(t, 1, repo.reads)
+
+	// Callers must not be able to modify the cached sizes
+	set, err := c.GetPackSizes(ctx)
+	require.NoError(t, err)
+	set.Sizes[0] = 1
+	set, err = c.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{250, 500}, set.Sizes)
+}
+
+func TestSizeRepo_Invalidation(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		invalidate func(t *testing.T, c *SizeRepo, now *time.Time)
+		expected   []int
+	}{
+		{
+			name: "StorePackSizes",
+			invalidate: func(t *testing.T, c *SizeRepo, now *time.Time) {
+				_, err := c.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{100}})
+				require.NoError(t, err)
+			},
+			expected: []int{100},
+		},
+		{
+			name: "CompareAndStorePackSizes",
+			invalidate: func(t *testing.T, c *SizeRepo, now *time.Time) {
+				_, err := c.CompareAndStorePackSizes(ctx, 1, pack.SizeSet{Sizes: []int{100}})
+				require.NoError(t, err)
+			},
+			expected: []int{100},
+		},
+		{
+			name: "UpdatePackSizes",
+			invalidate: func(t *testing.T, c *SizeRepo, now *time.Time) {
+				_, err := c.UpdatePackSizes(ctx, "john", func(pack.SizeSet) ([]int, error) {
+					return []int{100}, nil
+				})
+				require.NoError(t, err)
+			},
+			expected: []int{100},
+		},
+		{
+			name: "ApplyPackSizes",
+			invalidate: func(t *testing.T, c *SizeRepo, now *time.Time) {
+				_, err := c.ApplyPackSizes(ctx, func([]pack.SizeSet) (pack.SizeSetChanges, error) {
+					return pack.SizeSetChanges{Store: []pack.SizeSet{{Sizes: []int{100}}}}, nil
+				})
+				require.NoError(t, err)
+			},
+			expected: []int{100},
+		},
+		{
+			name: "Invalidate",
+			invalidate: func(t *testing.T, c *SizeRepo, now *time.Time) {
+				c.Invalidate()
+			},
+			expected: []int{250, 500},
+		},
+		{
+			name: "TTL",
+			invalidate: func(t *testing.T, c *SizeRepo, now *time.Time) {
+				*now = now.Add(time.Minute)
+			},
+			expected: []int{250, 500},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, repo, now := newTestCache(t)
+
+			_, err := c.GetPackSizes(ctx)
+			require.NoError(t, err)
+
+			tt.invalidate(t, c, now)
+
+			set, err := c.GetPackSizes(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, set.Sizes)
+			assert.Equal(t, 2, repo.reads)
+		})
+	}
+}
+
+func TestSizeRepo_FailedStoreKeepsCache(t *testing.T) {
+	c, repo, _ := newTestCache(t)
+	ctx := context.Background()
+
+	_, err := c.GetPackSizes(ctx)
+	require.NoError(t, err)
+
+	_, err = c.CompareAndStorePackSizes(ctx, 5, pack.SizeSet{Sizes: []int{100}})
+	require.ErrorIs(t, err, pack.ErrConflict)
+
+	_, err = c.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, repo.reads)
+}
+
+func TestSizeRepo_Fallback(t *testing.T) {
+	ctx := context.Background()
+	errUnavailable := errors.New("database is unavailable")
+
+	t.Run("LastKnown", func(t *testing.T) {
+		c, repo, _ := newTestCache(t)
+
+		_, err := c.GetPackSizes(ctx)
+		require.NoError(t, err)
+
+		repo.err = errUnavailable
+		c.Invalidate()
+
+		set, err := c.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, set.Version)
+		assert.Equal(t, []int{250, 500}, set.Sizes)
+
+		// The cache stays invalid, so the sizes are fetched again once the database is back
+		repo.err = nil
+		_, err = c.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, repo.reads)
+	})
+
+	t.Run("NothingKnown", func(t *testing.T) {
+		c, repo, _ := newTestCache(t)
+		repo.err = errUnavailable
+
+		_, err := c.GetPackSizes(ctx)
+		assert.ErrorIs(t, err, errUnavailable)
+	})
+}
+
+// blockingRepo holds reads of the latest pack sizes until release is closed
+type blockingRepo struct {
+	pack.PackSizeRepo
+	reads   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingRepo) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
+	if r.reads.Add(1) == 1 {
+		close(r.started)
+	}
+	<-r.release
+	return r.PackSizeRepo.GetPackSizes(ctx)
+}
+
+func TestSizeRepo_SlowFetch(t *testing.T) {
+	repo := &blockingRepo{
+		PackSizeRepo: memory.NewRepo(),
+		started:      make(chan struct{}),
+		release:      make(chan struct{}),
+	}
+	_, err := repo.StorePackSizes(context.Background(), pack.SizeSet{Sizes: []int{250, 500}})
+	require.NoError(t, err)
+	c := NewSizeRepo(repo, time.Minute, slog.New(slog.DiscardHandler))
+
+	var wg sync.WaitGroup
+	results := make([]pack.SizeSet, 3)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			set, err := c.GetPackSizes(context.Background())
+			assert.NoError(t, err)
+			results[i] = set
+		}()
+	}
+	<-repo.started
+
+	// A caller gives up waiting for the fetch of another one when its own context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = c.GetPackSizes(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	close(repo.release)
+	wg.Wait()
+	for _, set := range results {
+		assert.Equal(t, []int{250, 500}, set.Sizes)
+	}
+	assert.Equal(t, int32(1), repo.reads.Load())
+}
+
+func TestSizeRepo_ScheduledExpiry(t *testing.T) {
+	c, repo, now := newTestCache(t)
+	ctx := context.Background()
+
+	_, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{100}, EffectiveFrom: now.Add(10 * time.Second)})
+	require.NoError(t, err)
+
+	_, err = c.GetPackSizes(ctx)
+	require.NoError(t, err)
+
+	*now = now.Add(5 * time.Second)
+	_, err = c.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, repo.reads)
+
+	// The cached sizes expire when the scheduled version takes effect, long before ttl passes
+	*now = now.Add(5 * time.Second)
+	_, err = c.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, repo.reads)
+}
@@ -2,74 +2,767 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
 
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// sizeSetsChannel is the notification channel announcing new pack size versions
+const sizeSetsChannel = "size_sets"
+
 const (
-	getSizes    = "SELECT * FROM sizes ORDER BY size ASC"
-	deleteSizes = "DELETE FROM sizes"
-	insertSizes = "INSERT INTO sizes (size) VALUES ($1)"
+	selectSizeSets = `SELECT s.version, s.author, s.created_at, s.rolled_back_from, s.effective_from, s.cancelled_at,
+			array_remove(array_agg(z.size ORDER BY z.size), NULL)
+		FROM size_sets s LEFT JOIN sizes z ON z.version = s.version`
+	// getEffectiveSizeSet selects the version effective at $1, or at the current time if it's NULL
+	// the version is picked first, so only its sizes are joined and aggregated
+	getEffectiveSizeSet = `SELECT s.version, s.author, s.created_at, s.rolled_back_from, s.effective_from, s.cancelled_at,
+			array_remove(array_agg(z.size ORDER BY z.size), NULL)
+		FROM (
+			SELECT * FROM size_sets
+			WHERE cancelled_at IS NULL AND effective_from <= COALESCE($1::timestamptz, clock_timestamp())
+			ORDER BY effective_from DESC, version DESC LIMIT 1
+		) s LEFT JOIN sizes z ON z.version = s.version
+		GROUP BY s.version, s.author, s.created_at, s.rolled_back_from, s.effective_from, s.cancelled_at`
+	getSizeSet = selectSizeSets + " WHERE s.version = $1 GROUP BY s.version"
+	// getNextEffectiveFrom selects the earliest effective_from after $1, NULL if nothing is scheduled after it
+	getNextEffectiveFrom = "SELECT MIN(effective_from) FROM size_sets WHERE cancelled_at IS NULL AND effective_from > $1"
+	getSizeSets          = selectSizeSets + " GROUP BY s.version ORDER BY s.version DESC"
+	insertSizeSet        = `INSERT INTO size_sets (author, created_at, rolled_back_from, effective_from)
+		SELECT $1, now, $2, COALESCE($3, now) FROM clock_timestamp() now
+		RETURNING version, created_at, effective_from`
+	cancelSizeSet = `UPDATE size_sets SET cancelled_at = clock_timestamp()
+		WHERE version = $1 AND cancelled_at IS NULL AND effective_from > clock_timestamp()
+		RETURNING cancelled_at`
+	// lockSizeSets blocks concurrent saves while still allowing reads
+	lockSizeSets = "LOCK TABLE size_sets IN SHARE ROW EXCLUSIVE MODE"
+	// notifySizeSets is delivered to listeners when the transaction commits
+	notifySizeSets = "SELECT pg_notify('" + sizeSetsChannel + "', $1::text)"
+	listenSizeSets = "LISTEN " + sizeSetsChannel
+
+	insertAuditEntry = `INSERT INTO audit_log
+			(created_at, actor, client_ip, old_version, old_sizes, new_version, new_sizes, cancelled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	getAuditEntries = `SELECT created_at, actor, client_ip, COALESCE(old_version, 0), old_sizes, new_version, new_sizes,
+			cancelled
+		FROM audit_log
+		WHERE ($1::timestamptz IS NULL OR created_at >= $1)
+			AND ($2::timestamptz IS NULL OR created_at < $2)
+			AND ($3::text IS NULL OR actor = $3)
+		ORDER BY created_at DESC, id DESC
+		LIMIT NULLIF($4::integer, 0) OFFSET $5`
+
+	insertCalculation = `INSERT INTO calculations (created_at, order_qty, sizes, packs, solver, version)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	getCalculations = `SELECT created_at, order_qty, sizes, packs, solver, COALESCE(version, 0) FROM calculations
+		WHERE ($1::timestamptz IS NULL OR created_at >= $1)
+			AND ($2::timestamptz IS NULL OR created_at < $2)
+			AND ($3::integer IS NULL OR order_qty >= $3)
+			AND ($4::integer IS NULL OR order_qty <= $4)
+		ORDER BY created_at DESC, id DESC
+		LIMIT NULLIF($5::integer, 0) OFFSET $6`
+
+	selectAPIKeys = "SELECT id, name, role, hash, created_at, revoked_at FROM api_keys"
+	insertAPIKey  = `INSERT INTO api_keys (name, role, hash, created_at) VALUES ($1, $2, $3, clock_timestamp())
+		RETURNING id, created_at`
+	getAPIKeyByHash = selectAPIKeys + " WHERE hash = $1"
+	getAPIKeyByID   = selectAPIKeys + " WHERE id = $1"
+	getAPIKeys      = selectAPIKeys + " ORDER BY id"
+	revokeAPIKey    = "UPDATE api_keys SET revoked_at = clock_timestamp() WHERE id = $1 AND revoked_at IS NULL"
 )
 
+// Options tune the connection pool and how queries deal with a slow or briefly unavailable database.
+// The zero value keeps the pool settings from the URL and doesn't time out or retry anything.
+type Options struct {
+	// QueryTimeout bounds every attempt of a query or transaction, 0 means no timeout
+	QueryTimeout time.Duration
+	// MaxRetries is how many times an operation failed with a transient error is retried
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry, doubled for every next one
+	RetryBackoff time.Duration
+	// MaxConns and MinConns override the pool size if they aren't 0
+	MaxConns int32
+	MinConns int32
+	// ReplicaURL is an optional hot standby that serves reads
+	ReplicaURL string
+}
+
 type DB struct {
-	conn *pgxpool.Pool
+	conn    *pgxpool.Pool
+	replica *replica
+	opts    Options
+	retries atomic.Int64
 }
 
-func NewDB(ctx context.Context, url string) (*DB, error) {
-	conn, err := pgxpool.New(ctx, url)
+// NewDB connects to the database, retrying the first connection as configured by opts
+// in case the database is still starting up. The replica isn't required to be up.
+func NewDB(ctx context.Context, url string, opts Options) (*DB, error) {
+	conn, err := newPool(ctx, url, "primary", opts)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialise database: %w", err)
 	}
-	if err = conn.Ping(ctx); err != nil {
+
+	db := &DB{conn: conn, opts: opts}
+	if err = db.do(ctx, conn.Ping); err != nil {
+		conn.Close()
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
-	return &DB{conn: conn}, nil
+	if opts.ReplicaURL != "" {
+		replicaConn, err := newPool(ctx, opts.ReplicaURL, "replica", opts)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("unable to initialise replica: %w", err)
+		}
+		db.replica = &replica{conn: replicaConn}
+	}
+
+	return db, nil
+}
+
+// newPool creates a connection pool sized by opts, which doesn't connect until it's used.
+// Its statements are traced as the queries of the named pool.
+func newPool(ctx context.Context, url, name string, opts Options) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(url)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxConns > 0 {
+		config.MaxConns = opts.MaxConns
+	}
+	if opts.MinConns > 0 {
+		config.MinConns = opts.MinConns
+	}
+	config.ConnConfig.Tracer = queryTracer{pool: name}
+
+	return pgxpool.NewWithConfig(ctx, config)
+}
+
+// Ping checks that the primary database can be reached, without retrying
+func (db *DB) Ping(ctx context.Context) error {
+	return unavailable(db.attempt(ctx, db.conn.Ping))
 }
 
 func (db *DB) Close() {
 	db.conn.Close()
+	if db.replica != nil {
+		db.replica.conn.Close()
+	}
+}
+
+func (db *DB) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
+	return db.getPackSizesAt(ctx, nil)
+}
+
+func (db *DB) GetPackSizesAt(ctx context.Context, at time.Time) (pack.SizeSet, error) {
+	return db.getPackSizesAt(ctx, &at)
+}
+
+// getPackSizesAt gets the version effective at the given time, or at the current database time if it's nil
+func (db *DB) getPackSizesAt(ctx context.Context, at *time.Time) (pack.SizeSet, error) {
+	var set pack.SizeSet
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		var err error
+		set, err = scanSizeSet(conn.QueryRow(ctx, getEffectiveSizeSet, at))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pack.SizeSet{}, nil
+	}
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to get pack sizes: %w", err)
+	}
+
+	return set, nil
+}
+
+func (db *DB) GetPackSizeSet(ctx context.Context, version int) (pack.SizeSet, error) {
+	var set pack.SizeSet
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		var err error
+		set, err = scanSizeSet(conn.QueryRow(ctx, getSizeSet, version))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pack.SizeSet{}, fmt.Errorf("pack sizes version %d: %w", version, pack.ErrNotFound)
+	}
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to get pack sizes version %d: %w", version, err)
+	}
+
+	return set, nil
+}
+
+func (db *DB) GetPackSizeSets(ctx context.Context) ([]pack.SizeSet, error) {
+	var sets []pack.SizeSet
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		rows, err := conn.Query(ctx, getSizeSets)
+		if err != nil {
+			return fmt.Errorf("failed to get pack size versions: %w", err)
+		}
+
+		sets, err = scanSizeSets(rows)
+		return err
+	})
+
+	return sets, err
+}
+
+func (db *DB) GetNextEffectiveFrom(ctx context.Context, after time.Time) (time.Time, error) {
+	var next *time.Time
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		return conn.QueryRow(ctx, getNextEffectiveFrom, after).Scan(&next)
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get the next effective pack sizes: %w", err)
+	}
+	if next == nil {
+		return time.Time{}, nil
+	}
+
+	return *next, nil
+}
+
+func (db *DB) StorePackSizes(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+	return db.storePackSizes(ctx, func(pack.SizeSet) (pack.SizeSet, bool, error) {
+		return set, true, nil
+	})
+}
+
+func (db *DB) CompareAndStorePackSizes(ctx context.Context, expectedVersion int, set pack.SizeSet) (pack.SizeSet, error) {
+	return db.storePackSizes(ctx, func(current pack.SizeSet) (pack.SizeSet, bool, error) {
+		if current.Version != expectedVersion {
+			return pack.SizeSet{}, false, fmt.Errorf("%w: expected version %d, current is %d", pack.ErrConflict, expectedVersion, current.Version)
+		}
+		return set, true, nil
+	})
+}
+
+func (db *DB) UpdatePackSizes(
+	ctx context.Context,
+	author string,
+	update func(pack.SizeSet) ([]int, error),
+) (pack.SizeSet, error) {
+	return db.storePackSizes(ctx, func(current pack.SizeSet) (pack.SizeSet, bool, error) {
+		sizes, err := update(current)
+		if err != nil {
+			return pack.SizeSet{}, false, err
+		}
+		if slices.Equal(slices.Sorted(slices.Values(sizes)), current.Sizes) {
+			return current, false, nil
+		}
+		return pack.SizeSet{Sizes: sizes, Author: author}, true, nil
+	})
+}
+
+// storePackSizes inserts a new version of pack sizes and its audit entry in a single transaction, so readers see either
+// the whole new version or the previous one. Saves are serialised with a table lock taken before the current version
+// is read, so versions are committed in order and next gets the version the new one replaces. next returns the set
+// to store, or false to store nothing and return the set as is. The whole transaction is retried on transient
+// errors, so next may be called more than once.
+func (db *DB) storePackSizes(
+	ctx context.Context,
+	next func(current pack.SizeSet) (pack.SizeSet, bool, error),
+) (pack.SizeSet, error) {
+	var set pack.SizeSet
+	err := db.do(ctx, func(ctx context.Context) error {
+		var err error
+		set, err = db.storePackSizesTx(ctx, next)
+		return err
+	})
+	if err == nil {
+		db.markWritten(ctx)
+	}
+
+	return set, err
+}
+
+func (db *DB) storePackSizesTx(
+	ctx context.Context,
+	next func(current pack.SizeSet) (pack.SizeSet, bool, error),
+) (pack.SizeSet, error) {
+	tx, err := beginSizeSets(ctx, db.conn)
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	old, err := getEffectiveSizeSetTx(ctx, tx)
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+
+	set, store, err := next(old)
+	if err != nil || !store {
+		return set, err
+	}
+
+	set, err = insertSizeSetTx(ctx, tx, old, set)
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to commit pack sizes: %w", err)
+	}
+
+	return set, nil
+}
+
+func (db *DB) ApplyPackSizes(
+	ctx context.Context,
+	plan func([]pack.SizeSet) (pack.SizeSetChanges, error),
+) ([]pack.SizeSet, error) {
+	var stored []pack.SizeSet
+	err := db.do(ctx, func(ctx context.Context) error {
+		var err error
+		stored, err = db.applyPackSizesTx(ctx, plan)
+		return err
+	})
+	if err == nil {
+		db.markWritten(ctx)
+	}
+
+	return stored, err
+}
+
+// applyPackSizesTx makes all changes in a single transaction, serialised with other saves like storePackSizes
+func (db *DB) applyPackSizesTx(
+	ctx context.Context,
+	plan func([]pack.SizeSet) (pack.SizeSetChanges, error),
+) ([]pack.SizeSet, error) {
+	tx, err := beginSizeSets(ctx, db.conn)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, getSizeSets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pack size versions: %w", err)
+	}
+	sets, err := scanSizeSets(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := plan(sets)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, version := range changes.Cancel {
+		if _, err := cancelSizeSetTx(ctx, tx, version, changes.Author); err != nil {
+			return nil, err
+		}
+	}
+
+	stored := make([]pack.SizeSet, 0, len(changes.Store))
+	for _, set := range changes.Store {
+		old, err := getEffectiveSizeSetTx(ctx, tx)
+		if err != nil {
+			return nil, err
+		}
+
+		set, err = insertSizeSetTx(ctx, tx, old, set)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, set)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit pack sizes: %w", err)
+	}
+
+	return stored, nil
 }
 
-func (db *DB) GetPackSizes(ctx context.Context) ([]int, error) {
-	rows, err := db.conn.Query(ctx, getSizes)
+// beginSizeSets begins a transaction changing pack size versions. Such transactions are serialised
+// with a table lock, so versions are committed in order and the current version can't change until commit.
+func beginSizeSets(ctx context.Context, conn *pgxpool.Pool) (pgx.Tx, error) {
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get pack sizes: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, lockSizeSets); err != nil {
+		tx.Rollback(ctx)
+		return nil, fmt.Errorf("failed to lock pack size versions: %w", err)
+	}
+
+	return tx, nil
+}
+
+// getEffectiveSizeSetTx gets the currently effective version or an empty SizeSet if there is none
+func getEffectiveSizeSetTx(ctx context.Context, tx pgx.Tx) (pack.SizeSet, error) {
+	set, err := scanSizeSet(tx.QueryRow(ctx, getEffectiveSizeSet, nil))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return pack.SizeSet{}, fmt.Errorf("failed to get current pack size version: %w", err)
 	}
+
+	return set, nil
+}
+
+// insertSizeSetTx inserts a new version replacing old as the current one along with its audit entry
+// and announces it to listeners once the transaction commits
+func insertSizeSetTx(ctx context.Context, tx pgx.Tx, old, set pack.SizeSet) (pack.SizeSet, error) {
+	err := tx.QueryRow(ctx, insertSizeSet, set.Author, nullInt(set.RolledBackFrom), nullTime(set.EffectiveFrom)).
+		Scan(&set.Version, &set.CreatedAt, &set.EffectiveFrom)
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to insert pack size version: %w", err)
+	}
+
+	rows := make([][]any, 0, len(set.Sizes))
+	for _, size := range set.Sizes {
+		rows = append(rows, []any{set.Version, size})
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"sizes"}, []string{"version", "size"}, pgx.CopyFromRows(rows))
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to insert pack sizes: %w", err)
+	}
+
+	set.Sizes = slices.Sorted(slices.Values(set.Sizes))
+
+	_, err = tx.Exec(ctx, insertAuditEntry,
+		set.CreatedAt,
+		set.Author,
+		pack.ClientIP(ctx),
+		nullInt(old.Version),
+		nonNil(old.Sizes),
+		set.Version,
+		nonNil(set.Sizes),
+		false,
+	)
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, notifySizeSets, set.Version); err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to notify about pack sizes: %w", err)
+	}
+
+	return set, nil
+}
+
+func (db *DB) CancelPackSizes(ctx context.Context, version int, author string) (pack.SizeSet, error) {
+	var set pack.SizeSet
+	err := db.do(ctx, func(ctx context.Context) error {
+		tx, err := beginSizeSets(ctx, db.conn)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback(ctx)
+
+		set, err = cancelSizeSetTx(ctx, tx, version, author)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("failed to commit pack sizes: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+	db.markWritten(ctx)
+
+	return set, nil
+}
+
+// cancelSizeSetTx cancels a scheduled version along with its audit entry
+// and announces it to listeners once the transaction commits
+func cancelSizeSetTx(ctx context.Context, tx pgx.Tx, version int, author string) (pack.SizeSet, error) {
+	set, err := scanSizeSet(tx.QueryRow(ctx, getSizeSet, version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pack.SizeSet{}, fmt.Errorf("pack sizes version %d: %w", version, pack.ErrNotFound)
+	}
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to get pack sizes version %d: %w", version, err)
+	}
+
+	err = tx.QueryRow(ctx, cancelSizeSet, version).Scan(&set.CancelledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pack.SizeSet{}, fmt.Errorf("%w: pack sizes version %d is not scheduled", pack.ErrConflict, version)
+	}
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to cancel pack sizes version %d: %w", version, err)
+	}
+
+	current, err := getEffectiveSizeSetTx(ctx, tx)
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+
+	_, err = tx.Exec(ctx, insertAuditEntry,
+		set.CancelledAt,
+		author,
+		pack.ClientIP(ctx),
+		nullInt(current.Version),
+		nonNil(current.Sizes),
+		set.Version,
+		nonNil(set.Sizes),
+		true,
+	)
+	if err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to insert audit entry: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, notifySizeSets, set.Version); err != nil {
+		return pack.SizeSet{}, fmt.Errorf("failed to notify about pack sizes: %w", err)
+	}
+
+	return set, nil
+}
+
+// scanSizeSets scans and closes rows selected with selectSizeSets
+func scanSizeSets(rows pgx.Rows) ([]pack.SizeSet, error) {
 	defer rows.Close()
 
-	var sizes []int
+	var sets []pack.SizeSet
 	for rows.Next() {
-		var size int
-		if err := rows.Scan(&size); err != nil {
-			return nil, fmt.Errorf("failed to scan pack size: %w", err)
+		set, err := scanSizeSet(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pack size version: %w", err)
 		}
-		sizes = append(sizes, size)
+		sets = append(sets, set)
 	}
 
-	return sizes, nil
+	return sets, rows.Err()
 }
 
-func (db *DB) StorePackSizes(ctx context.Context, sizes []int) error {
-	tx, err := db.conn.Begin(ctx)
+// scanSizeSet scans a row selected with selectSizeSets
+func scanSizeSet(row pgx.Row) (pack.SizeSet, error) {
+	var set pack.SizeSet
+	var rolledBackFrom *int
+	var cancelledAt *time.Time
+
+	err := row.Scan(&set.Version, &set.Author, &set.CreatedAt, &rolledBackFrom, &set.EffectiveFrom, &cancelledAt, &set.Sizes)
 	if err != nil {
+		return pack.SizeSet{}, err
+	}
+	if rolledBackFrom != nil {
+		set.RolledBackFrom = *rolledBackFrom
+	}
+	if cancelledAt != nil {
+		set.CancelledAt = *cancelledAt
+	}
+
+	return set, nil
+}
+
+func (db *DB) StoreCalculation(ctx context.Context, calc pack.Calculation) error {
+	err := db.do(ctx, func(ctx context.Context) error {
+		_, err := db.conn.Exec(ctx, insertCalculation,
+			calc.CreatedAt, calc.Order, calc.Sizes, calc.Packs, calc.Solver, nullInt(calc.Version),
+		)
 		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert calculation: %w", err)
 	}
-	defer tx.Rollback(ctx)
+	db.markWritten(ctx)
 
-	_, err = db.conn.Exec(ctx, deleteSizes)
+	return nil
+}
+
+func (db *DB) GetCalculations(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+	var calcs []pack.Calculation
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		rows, err := conn.Query(ctx, getCalculations,
+			nullTime(filter.From), nullTime(filter.To),
+			nullInt(filter.MinOrder), nullInt(filter.MaxOrder),
+			filter.Limit, filter.Offset,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get calculations: %w", err)
+		}
+		defer rows.Close()
+
+		calcs = nil
+		for rows.Next() {
+			var calc pack.Calculation
+			if err := rows.Scan(&calc.CreatedAt, &calc.Order, &calc.Sizes, &calc.Packs, &calc.Solver, &calc.Version); err != nil {
+				return fmt.Errorf("failed to scan calculation: %w", err)
+			}
+			calcs = append(calcs, calc)
+		}
+
+		return rows.Err()
+	})
+
+	return calcs, err
+}
+
+func (db *DB) GetAuditEntries(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error) {
+	var entries []pack.AuditEntry
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		rows, err := conn.Query(ctx, getAuditEntries,
+			nullTime(filter.From), nullTime(filter.To),
+			nullString(filter.Actor),
+			filter.Limit, filter.Offset,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get audit entries: %w", err)
+		}
+		defer rows.Close()
+
+		entries = nil
+		for rows.Next() {
+			var e pack.AuditEntry
+			if err := rows.Scan(
+				&e.CreatedAt, &e.Actor, &e.ClientIP, &e.OldVersion, &e.OldSizes, &e.NewVersion, &e.NewSizes, &e.Cancelled,
+			); err != nil {
+				return fmt.Errorf("failed to scan audit entry: %w", err)
+			}
+			entries = append(entries, e)
+		}
+
+		return rows.Err()
+	})
+
+	return entries, err
+}
+
+func (db *DB) StoreAPIKey(ctx context.Context, key pack.APIKey) (pack.APIKey, error) {
+	err := db.do(ctx, func(ctx context.Context) error {
+		return db.conn.QueryRow(ctx, insertAPIKey, key.Name, key.Role, key.Hash).Scan(&key.ID, &key.CreatedAt)
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete pack sizes: %w", err)
+		return pack.APIKey{}, fmt.Errorf("failed to insert API key: %w", err)
 	}
+	db.markWritten(ctx)
+
+	return key, nil
+}
 
-	for _, size := range sizes {
-		_, err := db.conn.Exec(ctx, insertSizes, size)
+// GetAPIKey always reads from the primary, so a revoked key can't be used while the replica catches up
+func (db *DB) GetAPIKey(ctx context.Context, hash string) (pack.APIKey, error) {
+	var key pack.APIKey
+	err := db.do(ctx, func(ctx context.Context) error {
+		var err error
+		key, err = scanAPIKey(db.conn.QueryRow(ctx, getAPIKeyByHash, hash))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pack.APIKey{}, fmt.Errorf("API key: %w", pack.ErrNotFound)
+	}
+	if err != nil {
+		return pack.APIKey{}, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (db *DB) GetAPIKeys(ctx context.Context) ([]pack.APIKey, error) {
+	var keys []pack.APIKey
+	err := db.query(ctx, func(ctx context.Context, conn querier) error {
+		rows, err := conn.Query(ctx, getAPIKeys)
 		if err != nil {
-			return fmt.Errorf("failed to insert pack size: %w", err)
+			return fmt.Errorf("failed to get API keys: %w", err)
 		}
+		defer rows.Close()
+
+		keys = nil
+		for rows.Next() {
+			key, err := scanAPIKey(rows)
+			if err != nil {
+				return fmt.Errorf("failed to scan API key: %w", err)
+			}
+			keys = append(keys, key)
+		}
+
+		return rows.Err()
+	})
+
+	return keys, err
+}
+
+func (db *DB) RevokeAPIKey(ctx context.Context, id int) (pack.APIKey, error) {
+	var tag pgconn.CommandTag
+	err := db.do(ctx, func(ctx context.Context) error {
+		var err error
+		tag, err = db.conn.Exec(ctx, revokeAPIKey, id)
+		return err
+	})
+	if err != nil {
+		return pack.APIKey{}, fmt.Errorf("failed to revoke API key %d: %w", id, err)
 	}
+	db.markWritten(ctx)
 
-	return tx.Commit(ctx)
+	var key pack.APIKey
+	err = db.do(ctx, func(ctx context.Context) error {
+		var err error
+		key, err = scanAPIKey(db.conn.QueryRow(ctx, getAPIKeyByID, id))
+		return err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return pack.APIKey{}, fmt.Errorf("API key %d: %w", id, pack.ErrNotFound)
+	}
+	if err != nil {
+		return pack.APIKey{}, fmt.Errorf("failed to get API key %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return pack.APIKey{}, fmt.Errorf("%w: API key %d is already revoked", pack.ErrConflict, id)
+	}
+
+	return key, nil
+}
+
+// scanAPIKey scans a row selected with selectAPIKeys
+func scanAPIKey(row pgx.Row) (pack.APIKey, error) {
+	var key pack.APIKey
+	var revokedAt *time.Time
+
+	if err := row.Scan(&key.ID, &key.Name, &key.Role, &key.Hash, &key.CreatedAt, &revokedAt); err != nil {
+		return pack.APIKey{}, err
+	}
+	if revokedAt != nil {
+		key.RevokedAt = *revokedAt
+	}
+
+	return key, nil
+}
+
+// nullTime converts a zero time to NULL so it can be used as an optional query parameter
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// nullInt converts a zero integer to NULL so it can be used as an optional query parameter
+func nullInt(i int) *int {
+	if i == 0 {
+		return nil
+	}
+	return &i
+}
+
+// nullString converts an empty string to NULL so it can be used as an optional query parameter
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// nonNil converts a nil slice to an empty one for NOT NULL array columns
+func nonNil(sizes []int) []int {
+	if sizes == nil {
+		return []int{}
+	}
+	return sizes
 }
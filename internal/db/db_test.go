@@ -0,0 +1,186 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/achere/homework-pack-sizes/internal/repotest"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDbUrlEnv names the environment variable with a Postgres URL for integration tests.
+// Every test runs in its own throwaway schema which is dropped afterwards.
+const testDbUrlEnv = "TEST_DB_URL"
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	url := os.Getenv(testDbUrlEnv)
+	if url == "" {
+		t.Skipf("%s is not set, skipping database integration test", testDbUrlEnv)
+	}
+
+	ctx := context.Background()
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+
+	admin, err := pgxpool.New(ctx, url)
+	require.NoError(t, err)
+	t.Cleanup(admin.Close)
+
+	_, err = admin.Exec(ctx, "CREATE SCHEMA "+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+	})
+
+	config, err := pgxpool.ParseConfig(url)
+	require.NoError(t, err)
+	config.ConnConfig.RuntimeParams["search_path"] = schema
+
+	conn, err := pgxpool.NewWithConfig(ctx, config)
+	require.NoError(t, err)
+	t.Cleanup(conn.Close)
+
+	db := &DB{conn: conn}
+	_, err = db.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	return db
+}
+
+func TestRepo(t *testing.T) {
+	repotest.TestPackSizeRepo(t, func(t *testing.T) pack.PackSizeRepo {
+		return newTestDB(t)
+	})
+	repotest.TestCalculationRepo(t, func(t *testing.T) pack.CalculationRepo {
+		return newTestDB(t)
+	})
+	repotest.TestAuditRepo(t, func(t *testing.T) repotest.AuditedRepo {
+		return newTestDB(t)
+	})
+	repotest.TestAPIKeyRepo(t, func(t *testing.T) pack.APIKeyRepo {
+		return newTestDB(t)
+	})
+}
+
+// newTestReplicaDB returns a DB reading from a replica, which is the primary itself
+// as a server that isn't in recovery always counts as up to date
+func newTestReplicaDB(t *testing.T) *DB {
+	t.Helper()
+
+	db := newTestDB(t)
+	db.replica = &replica{conn: db.conn}
+
+	return db
+}
+
+func TestRepo_Replica(t *testing.T) {
+	repotest.TestPackSizeRepo(t, func(t *testing.T) pack.PackSizeRepo {
+		return newTestReplicaDB(t)
+	})
+	repotest.TestCalculationRepo(t, func(t *testing.T) pack.CalculationRepo {
+		return newTestReplicaDB(t)
+	})
+}
+
+func TestPing(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	assert.NoError(t, db.Ping(ctx))
+
+	// Nothing listens on the port
+	unreachable, err := pgxpool.New(ctx, "postgres://postgres@127.0.0.1:1/postgres?connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(unreachable.Close)
+
+	assert.ErrorIs(t, (&DB{conn: unreachable}).Ping(ctx), pack.ErrUnavailable)
+}
+
+func TestReplicaFailover(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	// Nothing listens on the port, so every connection to the replica fails
+	replicaConn, err := pgxpool.New(ctx, "postgres://postgres@127.0.0.1:1/postgres?connect_timeout=1")
+	require.NoError(t, err)
+	t.Cleanup(replicaConn.Close)
+	db.replica = &replica{conn: replicaConn}
+
+	stored, err := db.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500}, Author: "john"})
+	require.NoError(t, err)
+
+	for range 2 {
+		set, err := db.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, stored.Version, set.Version)
+	}
+
+	assert.Equal(t, int64(2), db.PoolStats().ReplicaFallbacks)
+
+	expected := `
+# HELP pack_db_replica_fallbacks_total Reads that went to the primary because the replica was down or behind.
+# TYPE pack_db_replica_fallbacks_total counter
+pack_db_replica_fallbacks_total 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(db.Collector(), strings.NewReader(expected), "pack_db_replica_fallbacks_total"))
+	assert.Equal(t, 2, testutil.CollectAndCount(db.Collector(), "pack_db_pool_max_connections"), "both pools are collected")
+}
+
+func TestStorePackSizes_FailureLeavesPreviousSet(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	stored, err := db.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500}, Author: "john"})
+	require.NoError(t, err)
+
+	// The last size overflows the integer column, failing the insert after the version row was created
+	_, err = db.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500, 1 << 40}, Author: "jane"})
+	assert.Error(t, err)
+
+	set, err := db.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, stored.Version, set.Version)
+	assert.Equal(t, []int{250, 500}, set.Sizes)
+}
+
+func TestListenPackSizes(t *testing.T) {
+	db := newTestDB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- db.ListenPackSizes(ctx, slog.New(slog.DiscardHandler), func() {
+			changes <- struct{}{}
+		})
+	}()
+
+	// The first call announces that the listener is connected
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not connect")
+	}
+
+	_, err := db.StorePackSizes(context.Background(), pack.SizeSet{Sizes: []int{250, 500}})
+	require.NoError(t, err)
+
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification after storing pack sizes")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
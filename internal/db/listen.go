@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const (
+	listenRetryMin = 100 * time.Millisecond
+	listenRetryMax = 10 * time.Second
+)
+
+// ListenPackSizes calls onChange every time a new version of pack sizes is committed by any instance
+// sharing the database. It holds a dedicated connection until ctx is cancelled, reconnecting with backoff
+// if the connection is lost. onChange is also called after every (re)connect because notifications
+// sent while not listening are lost.
+func (db *DB) ListenPackSizes(ctx context.Context, logger *slog.Logger, onChange func()) error {
+	retry := listenRetryMin
+
+	for {
+		listening, err := db.listenPackSizes(ctx, onChange)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if listening {
+			retry = listenRetryMin
+		}
+
+		logger.Warn("Lost pack sizes notifications, reconnecting", "err", err, "retry", retry)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+		retry = min(retry*2, listenRetryMax)
+	}
+}
+
+// listenPackSizes listens for notifications on a single connection until it fails
+// and reports whether it managed to start listening
+func (db *DB) listenPackSizes(ctx context.Context, onChange func()) (bool, error) {
+	poolConn, err := db.conn.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	// The connection is taken out of the pool so its LISTEN doesn't leak to other queries
+	conn := poolConn.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, listenSizeSets); err != nil {
+		return false, fmt.Errorf("failed to listen for pack sizes: %w", err)
+	}
+	db.markWritten(ctx)
+	onChange()
+
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return true, fmt.Errorf("failed to wait for pack sizes notification: %w", err)
+		}
+		// Other instances' changes have to be replayed by the replica before they are read from it
+		db.markWritten(ctx)
+		onChange()
+	}
+}
@@ -0,0 +1,296 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const (
+	createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    integer PRIMARY KEY,
+		name       text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`
+	// lockMigrations makes replicas starting at the same time apply migrations one after another
+	lockMigrations         = "SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))"
+	getAppliedMigrations   = "SELECT version, applied_at FROM schema_migrations"
+	insertAppliedMigration = "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	deleteAppliedMigration = "DELETE FROM schema_migrations WHERE version = $1"
+)
+
+// Migration is a versioned schema change embedded from migrations/<version>_<name>.(up|down).sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState is a known migration and whether it was applied to the database
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the migrations embedded in the binary ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		name, direction, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("unexpected migration file name: %s", e.Name())
+		}
+
+		versionStr, name, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("unexpected migration file name: %s", e.Name())
+		}
+
+		sql, err := fs.ReadFile(migrationFiles, path.Join("migrations", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(sql)
+		} else {
+			m.Down = string(sql)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return a.Version - b.Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be sequential, got %d after %d", m.Version, i)
+		}
+	}
+
+	return migrations, nil
+}
+
+// MigrateUp applies all pending migrations in a single transaction and returns the number applied
+func (db *DB) MigrateUp(ctx context.Context) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	err = db.inMigrationTx(ctx, func(tx pgx.Tx, done map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, m.Up); err != nil {
+				return fmt.Errorf("failed to apply migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := tx.Exec(ctx, insertAppliedMigration, m.Version, m.Name); err != nil {
+				return fmt.Errorf("failed to record migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts up to steps latest applied migrations in a single transaction and returns the number reverted
+func (db *DB) MigrateDown(ctx context.Context, steps int) (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	err = db.inMigrationTx(ctx, func(tx pgx.Tx, done map[int]time.Time) error {
+		for _, m := range slices.Backward(migrations) {
+			if reverted >= steps {
+				break
+			}
+			if _, ok := done[m.Version]; !ok {
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, m.Down); err != nil {
+				return fmt.Errorf("failed to revert migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			if _, err := tx.Exec(ctx, deleteAppliedMigration, m.Version); err != nil {
+				return fmt.Errorf("failed to unrecord migration %d_%s: %w", m.Version, m.Name, err)
+			}
+			reverted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return reverted, nil
+}
+
+// MigrationStatus lists all known migrations and whether they were applied
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationState, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	err = db.inMigrationTx(ctx, func(tx pgx.Tx, done map[int]time.Time) error {
+		for _, m := range migrations {
+			appliedAt, ok := done[m.Version]
+			states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return states, nil
+}
+
+// CheckMigrations returns an error listing the known migrations that weren't applied yet.
+// Unlike MigrationStatus() it only reads, so it doesn't wait for migrations being applied.
+func (db *DB) CheckMigrations(ctx context.Context) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	done, err := db.appliedMigrations(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, m := range migrations {
+		if !done[m.Version] {
+			pending = append(pending, fmt.Sprintf("%d_%s", m.Version, m.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d migrations are pending: %s", len(pending), strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+// appliedMigrations returns the versions of the applied migrations, none if there is no migrations table yet
+func (db *DB) appliedMigrations(ctx context.Context) (map[int]bool, error) {
+	var versions []int
+	rows, err := db.conn.Query(ctx, getAppliedMigrations)
+	if err == nil {
+		for rows.Next() {
+			var version int
+			var appliedAt time.Time
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+			}
+			versions = append(versions, version)
+		}
+		rows.Close()
+		err = rows.Err()
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "42P01" { // undefined_table
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	done := make(map[int]bool, len(versions))
+	for _, v := range versions {
+		done[v] = true
+	}
+	return done, nil
+}
+
+// inMigrationTx runs fn in a transaction holding the migrations lock, passing it the applied migration versions
+func (db *DB) inMigrationTx(ctx context.Context, fn func(tx pgx.Tx, done map[int]time.Time) error) error {
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, lockMigrations); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	if _, err := tx.Exec(ctx, createMigrationsTable); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, getAppliedMigrations)
+	if err != nil {
+		return fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		done[version] = appliedAt
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+
+	if err := fn(tx, done); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit migrations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+		assert.NotEmpty(t, m.Down)
+	}
+}
+
+func TestMigrateUpDown(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	migrations, err := Migrations()
+	require.NoError(t, err)
+
+	applied, err := db.MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, applied, "newTestDB has already migrated the schema")
+
+	states, err := db.MigrationStatus(ctx)
+	require.NoError(t, err)
+	for _, s := range states {
+		assert.True(t, s.Applied, "migration %d", s.Version)
+	}
+	assert.NoError(t, db.CheckMigrations(ctx))
+
+	reverted, err := db.MigrateDown(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted)
+	assert.ErrorContains(t, db.CheckMigrations(ctx), fmt.Sprintf("1 migrations are pending: %d_", len(migrations)))
+
+	applied, err = db.MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, applied)
+
+	reverted, err = db.MigrateDown(ctx, len(migrations)+1)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), reverted)
+
+	states, err = db.MigrationStatus(ctx)
+	require.NoError(t, err)
+	for _, s := range states {
+		assert.False(t, s.Applied, "migration %d", s.Version)
+	}
+
+	applied, err = db.MigrateUp(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, len(migrations), applied)
+}
+
+func TestMigrateUp_CarriesOverUnversionedSizes(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	_, err := db.MigrateDown(ctx, 100)
+	require.NoError(t, err)
+
+	_, err = db.conn.Exec(ctx, "CREATE TABLE sizes (size integer); INSERT INTO sizes VALUES (500), (250), (250)")
+	require.NoError(t, err)
+
+	_, err = db.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	set, err := db.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{250, 500}, set.Sizes)
+	assert.Equal(t, "migration", set.Author)
+}
+
+func TestSchemaConstraints(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	_, err := db.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 0}, Author: "john"})
+	assert.Error(t, err, "sizes must be positive")
+
+	_, err = db.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 250}, Author: "john"})
+	assert.Error(t, err, "sizes must be unique within a version")
+
+	set, err := db.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, set.Version)
+}
+
+func TestSchemaConstraints_AuditLogIsAppendOnly(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	_, err := db.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250}, Author: "john"})
+	require.NoError(t, err)
+
+	for _, sql := range []string{
+		"UPDATE audit_log SET actor = 'jane'",
+		"DELETE FROM audit_log",
+		"TRUNCATE audit_log",
+	} {
+		_, err := db.conn.Exec(ctx, sql)
+		assert.Error(t, err, sql)
+	}
+
+	entries, err := db.GetAuditEntries(ctx, pack.AuditFilter{})
+	require.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "john", entries[0].Actor)
+	}
+}
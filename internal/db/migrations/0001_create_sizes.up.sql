@@ -0,0 +1,32 @@
+CREATE TABLE size_sets (
+    version          serial PRIMARY KEY,
+    author           text NOT NULL,
+    created_at       timestamptz NOT NULL,
+    rolled_back_from integer REFERENCES size_sets (version)
+);
+
+-- Before versioning the sizes were kept in a single unversioned table,
+-- its contents are carried over as the first version
+DO $$
+BEGIN
+    IF to_regclass('sizes') IS NOT NULL THEN
+        ALTER TABLE sizes RENAME TO sizes_unversioned;
+    END IF;
+END $$;
+
+CREATE TABLE sizes (
+    version integer NOT NULL REFERENCES size_sets (version),
+    size    integer NOT NULL CHECK (size > 0),
+    PRIMARY KEY (version, size)
+);
+
+DO $$
+BEGIN
+    IF to_regclass('sizes_unversioned') IS NOT NULL THEN
+        INSERT INTO size_sets (author, created_at) VALUES ('migration', now());
+        INSERT INTO sizes (version, size)
+            SELECT DISTINCT currval(pg_get_serial_sequence('size_sets', 'version')), size
+            FROM sizes_unversioned WHERE size > 0;
+        DROP TABLE sizes_unversioned;
+    END IF;
+END $$;
@@ -0,0 +1,11 @@
+CREATE TABLE calculations (
+    id         bigserial PRIMARY KEY,
+    created_at timestamptz NOT NULL,
+    order_qty  integer NOT NULL CHECK (order_qty > 0),
+    sizes      integer[] NOT NULL,
+    packs      jsonb NOT NULL,
+    solver     text NOT NULL,
+    version    integer REFERENCES size_sets (version)
+);
+
+CREATE INDEX calculations_created_at_idx ON calculations (created_at);
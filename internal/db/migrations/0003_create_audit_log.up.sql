@@ -0,0 +1,23 @@
+CREATE TABLE audit_log (
+    id          bigserial PRIMARY KEY,
+    created_at  timestamptz NOT NULL,
+    actor       text NOT NULL,
+    client_ip   text NOT NULL,
+    old_version integer REFERENCES size_sets (version),
+    old_sizes   integer[] NOT NULL,
+    new_version integer NOT NULL REFERENCES size_sets (version),
+    new_sizes   integer[] NOT NULL
+);
+
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
+
+-- The audit log is append-only, entries can't be changed or removed
+CREATE FUNCTION audit_log_append_only() RETURNS trigger LANGUAGE plpgsql AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END $$;
+
+CREATE TRIGGER audit_log_no_update_delete BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,3 @@
+ALTER TABLE size_sets
+    DROP COLUMN effective_from,
+    DROP COLUMN cancelled_at;
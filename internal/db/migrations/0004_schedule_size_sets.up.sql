@@ -0,0 +1,10 @@
+ALTER TABLE size_sets
+    ADD COLUMN effective_from timestamptz,
+    ADD COLUMN cancelled_at   timestamptz;
+
+-- Versions stored before scheduling took effect when they were created
+UPDATE size_sets SET effective_from = created_at;
+
+ALTER TABLE size_sets ALTER COLUMN effective_from SET NOT NULL;
+
+CREATE INDEX size_sets_effective_from_idx ON size_sets (effective_from);
@@ -0,0 +1,9 @@
+CREATE TABLE api_keys (
+    id         serial PRIMARY KEY,
+    name       text NOT NULL,
+    role       text NOT NULL CHECK (role IN ('reader', 'calculator', 'admin')),
+    -- Only the hash of a key is stored, keys are looked up by it on every request
+    hash       text NOT NULL UNIQUE,
+    created_at timestamptz NOT NULL,
+    revoked_at timestamptz
+);
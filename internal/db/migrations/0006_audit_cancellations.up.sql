@@ -0,0 +1,2 @@
+-- Cancelled scheduled versions are recorded with the cancelled version as new_version
+ALTER TABLE audit_log ADD COLUMN cancelled boolean NOT NULL DEFAULT false;
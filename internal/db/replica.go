@@ -0,0 +1,156 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// replicaRetryDelay is how long reads go to the primary after the replica failed
+const replicaRetryDelay = 5 * time.Second
+
+const (
+	getWrittenLSN  = "SELECT pg_current_wal_lsn()::text"
+	getReplayedLSN = "SELECT pg_last_wal_replay_lsn()::text"
+)
+
+// querier runs read-only queries on either the primary or the replica
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// replica is a hot standby serving reads that are allowed to see changes made by this instance only after it
+// has replayed them. Writes raise the WAL position the replica must have reached, and until it does
+// reads go to the primary.
+type replica struct {
+	conn *pgxpool.Pool
+	// written is the WAL position of the latest known change, 0 once the replica has replayed it
+	written   atomic.Uint64
+	fallbacks atomic.Int64
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// query runs op on the replica if there is one that is up and has replayed the latest known change,
+// and on the primary otherwise
+func (db *DB) query(ctx context.Context, op func(ctx context.Context, conn querier) error) error {
+	if db.replica != nil && db.replica.usable(ctx, db) {
+		err := db.attempt(ctx, func(ctx context.Context) error {
+			return op(ctx, db.replica.conn)
+		})
+		if err == nil || ctx.Err() != nil || !replicaFailed(err) {
+			return err
+		}
+		db.replica.down()
+	}
+	if db.replica != nil {
+		db.replica.fallbacks.Add(1)
+	}
+
+	return db.do(ctx, func(ctx context.Context) error {
+		return op(ctx, db.conn)
+	})
+}
+
+// markWritten makes reads wait for the replica to replay everything committed on the primary so far.
+// It's called after every change, so clients always read their own writes.
+func (db *DB) markWritten(ctx context.Context) {
+	if db.replica == nil {
+		return
+	}
+
+	var lsn string
+	err := db.attempt(ctx, func(ctx context.Context) error {
+		return db.conn.QueryRow(ctx, getWrittenLSN).Scan(&lsn)
+	})
+	if err != nil {
+		// Without knowing what the replica has to catch up to, it's only safe to read from the primary
+		db.replica.down()
+		return
+	}
+
+	written, err := parseLSN(lsn)
+	if err != nil {
+		db.replica.down()
+		return
+	}
+
+	for {
+		current := db.replica.written.Load()
+		if current >= written || db.replica.written.CompareAndSwap(current, written) {
+			return
+		}
+	}
+}
+
+// usable reports whether reads can go to the replica right now
+func (r *replica) usable(ctx context.Context, db *DB) bool {
+	r.mu.Lock()
+	down := time.Now().Before(r.downUntil)
+	r.mu.Unlock()
+	if down {
+		return false
+	}
+
+	written := r.written.Load()
+	if written == 0 {
+		return true
+	}
+
+	var lsn *string
+	err := db.attempt(ctx, func(ctx context.Context) error {
+		return r.conn.QueryRow(ctx, getReplayedLSN).Scan(&lsn)
+	})
+	if err != nil {
+		r.down()
+		return false
+	}
+
+	// A server that isn't in recovery, e.g. a promoted replica, has no replay position and is up to date
+	if lsn != nil {
+		replayed, err := parseLSN(*lsn)
+		if err != nil || replayed < written {
+			return false
+		}
+	}
+
+	// Only clear the mark if no newer change raised it in the meantime
+	r.written.CompareAndSwap(written, 0)
+	return true
+}
+
+// down sends reads to the primary for a while
+func (r *replica) down() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.downUntil = time.Now().Add(replicaRetryDelay)
+}
+
+// replicaFailed reports whether err means the replica can't serve reads, rather than that there is no data
+// or the query is wrong
+func replicaFailed(err error) bool {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	return !errors.As(err, &pgErr) || isTransient(err)
+}
+
+// parseLSN parses the text form of a WAL position, e.g. 16/B374D848
+func parseLSN(s string) (uint64, error) {
+	var hi, lo uint32
+	if _, err := fmt.Sscanf(s, "%X/%X", &hi, &lo); err != nil {
+		return 0, fmt.Errorf("invalid WAL position %q: %w", s, err)
+	}
+	return uint64(hi)<<32 | uint64(lo), nil
+}
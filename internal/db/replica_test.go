@@ -0,0 +1,43 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLSN(t *testing.T) {
+	lsn, err := parseLSN("16/B374D848")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x16B374D848), lsn)
+
+	lower, err := parseLSN("0/FFFFFFFF")
+	assert.NoError(t, err)
+	assert.Less(t, lower, lsn)
+
+	_, err = parseLSN("B374D848")
+	assert.Error(t, err)
+}
+
+func TestReplicaFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		failed bool
+	}{
+		{"No rows", fmt.Errorf("failed to get pack sizes: %w", pgx.ErrNoRows), false},
+		{"Query error", &pgconn.PgError{Code: "42P01"}, false},
+		{"Conflict with recovery", &pgconn.PgError{Code: "40001"}, true},
+		{"Connect error", &pgconn.ConnectError{}, true},
+		{"Network error", fmt.Errorf("failed to get pack sizes: %w", assert.AnError), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.failed, replicaFailed(tt.err))
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// maxRetryBackoff caps the delay between retries however many there are
+const maxRetryBackoff = 5 * time.Second
+
+// do runs op with the query timeout, retrying it with backoff while it fails with a transient error.
+// op must be safe to run again, e.g. a single statement or a whole transaction.
+// Errors left after the retries that mean the database is unavailable wrap pack.ErrUnavailable.
+func (db *DB) do(ctx context.Context, op func(ctx context.Context) error) error {
+	backoff := db.opts.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		err := db.attempt(ctx, op)
+		if err == nil || attempt >= db.opts.MaxRetries || !isTransient(err) || ctx.Err() != nil {
+			return unavailable(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return unavailable(err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+		db.retries.Add(1)
+	}
+}
+
+// attempt runs op once with the query timeout
+func (db *DB) attempt(ctx context.Context, op func(ctx context.Context) error) error {
+	if db.opts.QueryTimeout <= 0 {
+		return op(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.opts.QueryTimeout)
+	defer cancel()
+
+	return op(ctx)
+}
+
+// unavailable wraps err with pack.ErrUnavailable if it's caused by the database being unreachable or too slow
+func unavailable(err error) error {
+	if err == nil || !isTransient(err) && !isTimeout(err) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", pack.ErrUnavailable, err)
+}
+
+// isTimeout reports whether err is caused by the query timeout or the deadline of the caller
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err)
+}
+
+// isTransient reports whether err is caused by a failure that is likely to go away and that left no changes behind:
+// either the query wasn't sent at all or the server rejected it. Timeouts aren't retried so a slow database
+// isn't loaded even more.
+func isTransient(err error) bool {
+	if isTimeout(err) {
+		return false
+	}
+
+	var connectErr *pgconn.ConnectError
+	if pgconn.SafeToRetry(err) || errors.As(err, &connectErr) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	switch pgErr.Code {
+	case "40001", // serialization_failure
+		"40P01", // deadlock_detected
+		"53300", // too_many_connections
+		"57P01", // admin_shutdown
+		"57P02", // crash_shutdown
+		"57P03": // cannot_connect_now
+		return true
+	}
+	// Class 08 is connection exceptions
+	return strings.HasPrefix(pgErr.Code, "08")
+}
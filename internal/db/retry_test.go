@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"Serialization failure", &pgconn.PgError{Code: "40001"}, true},
+		{"Cannot connect now", fmt.Errorf("failed to get pack sizes: %w", &pgconn.PgError{Code: "57P03"}), true},
+		{"Connection failure", &pgconn.PgError{Code: "08006"}, true},
+		{"Connect error", &pgconn.ConnectError{}, true},
+		{"Unique violation", &pgconn.PgError{Code: "23505"}, false},
+		{"Deadline exceeded", fmt.Errorf("failed to get pack sizes: %w", context.DeadlineExceeded), false},
+		{"Other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.transient, isTransient(tt.err))
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	transient := &pgconn.PgError{Code: "57P03"}
+
+	t.Run("Retries transient errors", func(t *testing.T) {
+		db := &DB{opts: Options{MaxRetries: 3, RetryBackoff: time.Millisecond}}
+
+		calls := 0
+		err := db.do(ctx, func(ctx context.Context) error {
+			calls++
+			if calls < 3 {
+				return transient
+			}
+			return nil
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		assert.Equal(t, int64(2), db.retries.Load())
+	})
+
+	t.Run("Gives up after max retries", func(t *testing.T) {
+		db := &DB{opts: Options{MaxRetries: 2, RetryBackoff: time.Millisecond}}
+
+		calls := 0
+		err := db.do(ctx, func(ctx context.Context) error {
+			calls++
+			return transient
+		})
+
+		assert.ErrorIs(t, err, transient)
+		assert.ErrorIs(t, err, pack.ErrUnavailable)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Doesn't retry other errors", func(t *testing.T) {
+		db := &DB{opts: Options{MaxRetries: 2, RetryBackoff: time.Millisecond}}
+
+		calls := 0
+		err := db.do(ctx, func(ctx context.Context) error {
+			calls++
+			return assert.AnError
+		})
+
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NotErrorIs(t, err, pack.ErrUnavailable)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("Times out every attempt", func(t *testing.T) {
+		db := &DB{opts: Options{QueryTimeout: time.Millisecond, MaxRetries: 2, RetryBackoff: time.Millisecond}}
+
+		calls := 0
+		err := db.do(ctx, func(ctx context.Context) error {
+			calls++
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.ErrorIs(t, err, pack.ErrUnavailable)
+		assert.Equal(t, 1, calls, "timeouts aren't retried")
+	})
+
+	t.Run("Stops when cancelled", func(t *testing.T) {
+		db := &DB{opts: Options{MaxRetries: 5, RetryBackoff: time.Hour}}
+		ctx, cancel := context.WithCancel(ctx)
+
+		calls := 0
+		err := db.do(ctx, func(ctx context.Context) error {
+			calls++
+			cancel()
+			return transient
+		})
+
+		assert.ErrorIs(t, err, transient)
+		assert.Equal(t, 1, calls)
+	})
+}
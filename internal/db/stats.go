@@ -0,0 +1,117 @@
+package db
+
+import (
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PoolStats are statistics of the connection pool for monitoring
+type PoolStats struct {
+	TotalConns           int32   `json:"total_conns"`
+	IdleConns            int32   `json:"idle_conns"`
+	AcquiredConns        int32   `json:"acquired_conns"`
+	MaxConns             int32   `json:"max_conns"`
+	AcquireCount         int64   `json:"acquire_count"`
+	EmptyAcquireCount    int64   `json:"empty_acquire_count"`
+	CanceledAcquireCount int64   `json:"canceled_acquire_count"`
+	AcquireSeconds       float64 `json:"acquire_seconds"`
+	Retries              int64   `json:"retries,omitempty"`
+	// ReplicaFallbacks counts reads that went to the primary because the replica was down or behind
+	ReplicaFallbacks int64      `json:"replica_fallbacks,omitempty"`
+	Replica          *PoolStats `json:"replica,omitempty"`
+}
+
+// PoolStats returns the current statistics of the connection pools
+func (db *DB) PoolStats() PoolStats {
+	stats := poolStats(db.conn)
+	stats.Retries = db.retries.Load()
+
+	if db.replica != nil {
+		replica := poolStats(db.replica.conn)
+		stats.Replica = &replica
+		stats.ReplicaFallbacks = db.replica.fallbacks.Load()
+	}
+
+	return stats
+}
+
+func poolStats(conn *pgxpool.Pool) PoolStats {
+	stat := conn.Stat()
+
+	return PoolStats{
+		TotalConns:           stat.TotalConns(),
+		IdleConns:            stat.IdleConns(),
+		AcquiredConns:        stat.AcquiredConns(),
+		MaxConns:             stat.MaxConns(),
+		AcquireCount:         stat.AcquireCount(),
+		EmptyAcquireCount:    stat.EmptyAcquireCount(),
+		CanceledAcquireCount: stat.CanceledAcquireCount(),
+		AcquireSeconds:       stat.AcquireDuration().Seconds(),
+	}
+}
+
+var (
+	poolConnsDesc = prometheus.NewDesc(
+		"pack_db_pool_connections", "Connections in the pool by state.", []string{"pool", "state"}, nil,
+	)
+	poolMaxConnsDesc = prometheus.NewDesc(
+		"pack_db_pool_max_connections", "Most connections the pool may open.", []string{"pool"}, nil,
+	)
+	poolAcquiresDesc = prometheus.NewDesc(
+		"pack_db_pool_acquires_total", "Connections acquired from the pool.", []string{"pool"}, nil,
+	)
+	poolEmptyAcquiresDesc = prometheus.NewDesc(
+		"pack_db_pool_empty_acquires_total", "Acquires that had to wait for a connection as none was idle.", []string{"pool"}, nil,
+	)
+	poolCanceledAcquiresDesc = prometheus.NewDesc(
+		"pack_db_pool_canceled_acquires_total", "Acquires cancelled by their context.", []string{"pool"}, nil,
+	)
+	poolAcquireSecondsDesc = prometheus.NewDesc(
+		"pack_db_pool_acquire_seconds_total", "Time spent acquiring connections.", []string{"pool"}, nil,
+	)
+	retriesDesc = prometheus.NewDesc(
+		"pack_db_retries_total", "Queries retried after a transient error.", nil, nil,
+	)
+	replicaFallbacksDesc = prometheus.NewDesc(
+		"pack_db_replica_fallbacks_total", "Reads that went to the primary because the replica was down or behind.", nil, nil,
+	)
+)
+
+// Collector returns a collector of the PoolStats() for Prometheus
+func (db *DB) Collector() prometheus.Collector {
+	return statsCollector{db}
+}
+
+type statsCollector struct {
+	db *DB
+}
+
+func (c statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.db.PoolStats()
+
+	collectPoolStats(ch, "primary", stats)
+	ch <- prometheus.MustNewConstMetric(retriesDesc, prometheus.CounterValue, float64(stats.Retries))
+
+	if stats.Replica != nil {
+		collectPoolStats(ch, "replica", *stats.Replica)
+		ch <- prometheus.MustNewConstMetric(replicaFallbacksDesc, prometheus.CounterValue, float64(stats.ReplicaFallbacks))
+	}
+}
+
+func collectPoolStats(ch chan<- prometheus.Metric, pool string, stats PoolStats) {
+	ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stats.IdleConns), pool, "idle")
+	ch <- prometheus.MustNewConstMetric(poolConnsDesc, prometheus.GaugeValue, float64(stats.AcquiredConns), pool, "acquired")
+	// Connections being established are neither idle nor acquired
+	ch <- prometheus.MustNewConstMetric(
+		poolConnsDesc, prometheus.GaugeValue, float64(stats.TotalConns-stats.IdleConns-stats.AcquiredConns), pool, "constructing",
+	)
+	ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, prometheus.GaugeValue, float64(stats.MaxConns), pool)
+	ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, prometheus.CounterValue, float64(stats.AcquireCount), pool)
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, prometheus.CounterValue, float64(stats.EmptyAcquireCount), pool)
+	ch <- prometheus.MustNewConstMetric(poolCanceledAcquiresDesc, prometheus.CounterValue, float64(stats.CanceledAcquireCount), pool)
+	ch <- prometheus.MustNewConstMetric(poolAcquireSecondsDesc, prometheus.CounterValue, stats.AcquireSeconds, pool)
+}
@@ -0,0 +1,14 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpanName(t *testing.T) {
+	assert.Equal(t, "SELECT", spanName(getEffectiveSizeSet))
+	assert.Equal(t, "INSERT", spanName(insertAPIKey))
+	assert.Equal(t, "UPDATE", spanName("\n\tupdate\napi_keys SET revoked_at = now()"))
+	assert.Equal(t, "", spanName(""))
+}
@@ -0,0 +1,256 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/achere/homework-pack-sizes/internal/memory"
+	"github.com/achere/homework-pack-sizes/internal/pack"
+)
+
+// formatVersion is increased on incompatible changes of the file contents.
+// Version 1 kept the calculation history in the state file, it's moved to the calculation log on Open.
+const formatVersion = 2
+
+type fileContents struct {
+	FormatVersion int `json:"format_version"`
+	memory.Snapshot
+	// Calculations are only read from files of version 1
+	Calculations []pack.Calculation `json:"calculations,omitempty"`
+}
+
+// ErrLocked is returned by Open if the file is already open in another Repo, e.g. of another process
+var ErrLocked = errors.New("file is in use")
+
+// Repo is a repository persisted to a JSON file
+type Repo struct {
+	*memory.Repo
+	lock *os.File
+}
+
+// Open loads the state of a repository from a JSON file at path, creating it on the first change if it doesn't exist.
+// The returned repository keeps the state in memory and rewrites the file atomically on every change
+// of pack sizes, the audit log or API keys, so the file always holds a complete state even if the process crashes.
+// The calculation history is appended to a log next to it, see CalculationsPath(), without syncing it,
+// so a crash may lose the latest calculations. The log is compacted to the latest memory.MaxCalculations
+// calculations on Open and whenever it grows to twice as many.
+//
+// As every Repo only knows its own changes, the file can be used by a single Repo at a time. Open takes
+// an advisory lock on LockPath() until Close and returns ErrLocked if it's already held. The lock is only
+// taken on Unix, other systems rely on the file not being shared.
+func Open(path string) (_ *Repo, err error) {
+	lock, err := lockFile(LockPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Close()
+		}
+	}()
+
+	var contents fileContents
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		contents.FormatVersion = formatVersion
+	case err != nil:
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	default:
+		if err := json.Unmarshal(data, &contents); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if contents.FormatVersion != formatVersion && contents.FormatVersion != 1 {
+			return nil, fmt.Errorf("unsupported format version %d of %s", contents.FormatVersion, path)
+		}
+	}
+
+	log := &calculationLog{path: CalculationsPath(path)}
+	persist := func(state memory.Snapshot) error {
+		return writeState(path, state)
+	}
+
+	var calcs []pack.Calculation
+	if contents.FormatVersion == 1 {
+		// A log left by an interrupted migration is replaced, then the state file drops the calculations
+		calcs = contents.Calculations
+		if err := log.compact(calcs); err != nil {
+			return nil, err
+		}
+		if err := persist(contents.Snapshot); err != nil {
+			return nil, err
+		}
+	} else if calcs, err = log.open(); err != nil {
+		return nil, err
+	}
+
+	repo := memory.NewRepoFromSnapshot(contents.Snapshot, calcs, memory.Persistence{
+		Snapshot:    persist,
+		Calculation: log.append,
+	})
+
+	return &Repo{Repo: repo, lock: lock}, nil
+}
+
+// Close releases the lock on the file, so it can be opened again. The Repo must not be used afterwards.
+func (r *Repo) Close() error {
+	return r.lock.Close()
+}
+
+// CalculationsPath returns the path of the calculation log kept next to the state file at path
+func CalculationsPath(path string) string {
+	return path + ".calculations.jsonl"
+}
+
+// LockPath returns the path of the lock file kept next to the state file at path. The state file itself
+// can't be locked as it's replaced on every change.
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// calculationLog is a file holding a calculation per line, the oldest first
+type calculationLog struct {
+	path  string
+	lines int
+}
+
+// open reads the log and compacts it if needed. It returns the latest memory.MaxCalculations calculations.
+func (l *calculationLog) open() ([]pack.Calculation, error) {
+	calcs, complete, err := readCalculations(l.path)
+	if err != nil {
+		return nil, err
+	}
+	l.lines = len(calcs)
+
+	// A torn last line left by a crash must be removed before appending after it
+	if !complete || len(calcs) > memory.MaxCalculations {
+		if err := l.compact(calcs); err != nil {
+			return nil, err
+		}
+	}
+
+	return calcs[max(len(calcs)-memory.MaxCalculations, 0):], nil
+}
+
+// append adds calc at the end of the log, compacting it when it grows to twice the kept calculations
+func (l *calculationLog) append(calc pack.Calculation) error {
+	line, err := json.Marshal(calc)
+	if err != nil {
+		return fmt.Errorf("failed to encode calculation: %w", err)
+	}
+
+	if l.lines >= 2*memory.MaxCalculations {
+		calcs, _, err := readCalculations(l.path)
+		if err != nil {
+			return err
+		}
+		if err := l.compact(calcs); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", l.path, err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", l.path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", l.path, err)
+	}
+	l.lines++
+
+	return nil
+}
+
+// compact replaces the log with the latest memory.MaxCalculations of calcs
+func (l *calculationLog) compact(calcs []pack.Calculation) error {
+	calcs = calcs[max(len(calcs)-memory.MaxCalculations, 0):]
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, c := range calcs {
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf("failed to encode calculation: %w", err)
+		}
+	}
+	if err := write(l.path, buf.Bytes()); err != nil {
+		return err
+	}
+	l.lines = len(calcs)
+
+	return nil
+}
+
+// readCalculations reads the log at path, which is empty if it doesn't exist.
+// A last line without a newline is skipped and reported by complete being false.
+func readCalculations(path string) (calcs []pack.Calculation, complete bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, true, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	for n := 1; len(data) > 0; n++ {
+		line, rest, found := bytes.Cut(data, []byte("\n"))
+		if !found {
+			return calcs, false, nil
+		}
+		data = rest
+
+		var c pack.Calculation
+		if err := json.Unmarshal(line, &c); err != nil {
+			return nil, false, fmt.Errorf("failed to parse line %d of %s: %w", n, path, err)
+		}
+		calcs = append(calcs, c)
+	}
+
+	return calcs, true, nil
+}
+
+// writeState replaces the state file at path with state
+func writeState(path string, state memory.Snapshot) error {
+	data, err := json.Marshal(fileContents{FormatVersion: formatVersion, Snapshot: state})
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	return write(path, data)
+}
+
+// write replaces the file at path with data by writing a temporary file next to it and renaming it
+func write(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync %s: %w", tmp.Name(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %s: %w", tmp.Name(), err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	return nil
+}
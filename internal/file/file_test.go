@@ -0,0 +1,171 @@
+package file_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/file"
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/achere/homework-pack-sizes/internal/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo(t *testing.T) {
+	open := func(t *testing.T) *file.Repo {
+		repo, err := file.Open(filepath.Join(t.TempDir(), "state.json"))
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	}
+
+	repotest.TestPackSizeRepo(t, func(t *testing.T) pack.PackSizeRepo {
+		return open(t)
+	})
+	repotest.TestCalculationRepo(t, func(t *testing.T) pack.CalculationRepo {
+		return open(t)
+	})
+	repotest.TestAuditRepo(t, func(t *testing.T) repotest.AuditedRepo {
+		return open(t)
+	})
+	repotest.TestAPIKeyRepo(t, func(t *testing.T) pack.APIKeyRepo {
+		return open(t)
+	})
+}
+
+func TestRepo_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	repo, err := file.Open(path)
+	require.NoError(t, err)
+
+	stored, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500}, Author: "john"})
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreCalculation(ctx, pack.Calculation{Order: 251, Sizes: []int{250, 500}, Packs: map[int]int{500: 1}}))
+	require.NoError(t, repo.Close())
+
+	repo, err = file.Open(path)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	set, err := repo.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, stored.Version, set.Version)
+	assert.Equal(t, []int{250, 500}, set.Sizes)
+	assert.True(t, stored.CreatedAt.Equal(set.CreatedAt))
+
+	calcs, err := repo.GetCalculations(ctx, pack.CalculationFilter{})
+	require.NoError(t, err)
+	if assert.Len(t, calcs, 1) {
+		assert.Equal(t, map[int]int{500: 1}, calcs[0].Packs)
+	}
+}
+
+func TestRepo_TornCalculation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// A crash while appending leaves a partial last line
+	require.NoError(t, os.WriteFile(file.CalculationsPath(path), []byte(`{"Order":251}`+"\n"+`{"Ord`), 0o600))
+
+	repo, err := file.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, repo.StoreCalculation(ctx, pack.Calculation{Order: 501}))
+	require.NoError(t, repo.Close())
+
+	repo, err = file.Open(path)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	calcs, err := repo.GetCalculations(ctx, pack.CalculationFilter{})
+	require.NoError(t, err)
+	var orders []int
+	for _, c := range calcs {
+		orders = append(orders, c.Order)
+	}
+	assert.Equal(t, []int{501, 251}, orders)
+}
+
+func TestOpen_FormatVersion1(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	v1 := `{"format_version": 1, "size_sets": [], "calculations": [{"Order": 251, "Packs": {"500": 1}}], "audit_log": [], "api_keys": []}`
+	require.NoError(t, os.WriteFile(path, []byte(v1), 0o600))
+
+	for range 2 {
+		repo, err := file.Open(path)
+		require.NoError(t, err)
+
+		calcs, err := repo.GetCalculations(ctx, pack.CalculationFilter{})
+		require.NoError(t, err)
+		if assert.Len(t, calcs, 1) {
+			assert.Equal(t, map[int]int{500: 1}, calcs[0].Packs)
+		}
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "calculations")
+		require.NoError(t, repo.Close())
+	}
+}
+
+func TestRepo_FailedWriteKeepsState(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	repo, err := file.Open(filepath.Join(dir, "state.json"))
+	require.NoError(t, err)
+	defer repo.Close()
+
+	_, err = repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250}, Author: "john"})
+	require.NoError(t, err)
+
+	require.NoError(t, os.Chmod(dir, 0o500))
+	t.Cleanup(func() { os.Chmod(dir, 0o700) })
+
+	if f, err := os.CreateTemp(dir, "probe"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		t.Skip("directory permissions are not enforced, probably running as root")
+	}
+
+	_, err = repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{500}, Author: "jane"})
+	assert.Error(t, err)
+
+	set, err := repo.GetPackSizes(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int{250}, set.Sizes)
+}
+
+func TestOpen_Locked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	repo, err := file.Open(path)
+	require.NoError(t, err)
+
+	_, err = file.Open(path)
+	assert.ErrorIs(t, err, file.ErrLocked)
+
+	require.NoError(t, repo.Close())
+	repo, err = file.Open(path)
+	require.NoError(t, err, "the lock is released on Close")
+	require.NoError(t, repo.Close())
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	dir := t.TempDir()
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	require.NoError(t, os.WriteFile(corrupt, []byte("{"), 0o600))
+	_, err := file.Open(corrupt)
+	assert.Error(t, err)
+
+	unsupported := filepath.Join(dir, "unsupported.json")
+	require.NoError(t, os.WriteFile(unsupported, []byte(`{"format_version": 99}`), 0o600))
+	_, err = file.Open(unsupported)
+	assert.Error(t, err)
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package file
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockFile opens the lock file at path without locking it, as flock is only available on Unix
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,499 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+)
+
+// MaxCalculations caps the calculation history kept by a Repo, the oldest calculations are dropped first
+const MaxCalculations = 10_000
+
+// Snapshot is the state of a Repo except for the calculation history
+type Snapshot struct {
+	SizeSets []pack.SizeSet    `json:"size_sets"`
+	AuditLog []pack.AuditEntry `json:"audit_log"`
+	APIKeys  []pack.APIKey     `json:"api_keys"`
+}
+
+// Persistence saves the changes of a Repo, a change is discarded if saving it fails
+type Persistence struct {
+	// Snapshot is called with the new state on every change of pack sizes, the audit log or API keys
+	Snapshot func(Snapshot) error
+	// Calculation is called with every stored calculation. Calculations are kept apart from the snapshot,
+	// so storing one neither rewrites the whole state nor blocks the other changes.
+	Calculation func(pack.Calculation) error
+}
+
+// Repo keeps pack sizes, calculations, the audit log and API keys in memory. It implements pack.PackSizeRepo,
+// pack.CalculationRepo, pack.AuditRepo and pack.APIKeyRepo with the same semantics as the database
+// except that only the latest MaxCalculations calculations are kept, and is safe for concurrent use.
+type Repo struct {
+	mu      sync.RWMutex
+	state   Snapshot
+	persist func(Snapshot) error
+
+	calcMu      sync.RWMutex
+	calcs       []pack.Calculation
+	persistCalc func(pack.Calculation) error
+}
+
+// NewRepo creates an empty Repo
+func NewRepo() *Repo {
+	return &Repo{}
+}
+
+// NewRepoFromSnapshot creates a Repo with the given state and calculation history, the oldest calculation first.
+// The set functions of persistence are called on every change while the Repo is locked.
+func NewRepoFromSnapshot(state Snapshot, calcs []pack.Calculation, persistence Persistence) *Repo {
+	return &Repo{
+		state:       state,
+		persist:     persistence.Snapshot,
+		calcs:       slices.Clone(calcs[max(len(calcs)-MaxCalculations, 0):]),
+		persistCalc: persistence.Calculation,
+	}
+}
+
+func (r *Repo) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
+	return r.GetPackSizesAt(ctx, time.Now())
+}
+
+func (r *Repo) GetPackSizesAt(ctx context.Context, at time.Time) (pack.SizeSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return cloneSizeSet(r.effectiveSizeSet(at)), nil
+}
+
+func (r *Repo) GetPackSizeSet(ctx context.Context, version int) (pack.SizeSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set, ok := r.sizeSet(version)
+	if !ok {
+		return pack.SizeSet{}, fmt.Errorf("pack sizes version %d: %w", version, pack.ErrNotFound)
+	}
+
+	return cloneSizeSet(set), nil
+}
+
+func (r *Repo) GetPackSizeSets(ctx context.Context) ([]pack.SizeSet, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.sizeSets(), nil
+}
+
+func (r *Repo) GetNextEffectiveFrom(ctx context.Context, after time.Time) (time.Time, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var next time.Time
+	for _, s := range r.state.SizeSets {
+		if s.CancelledAt.IsZero() && s.EffectiveFrom.After(after) && (next.IsZero() || s.EffectiveFrom.Before(next)) {
+			next = s.EffectiveFrom
+		}
+	}
+
+	return next, nil
+}
+
+func (r *Repo) StorePackSizes(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.storePackSizes(ctx, set)
+}
+
+func (r *Repo) CompareAndStorePackSizes(ctx context.Context, expectedVersion int, set pack.SizeSet) (pack.SizeSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current := r.effectiveSizeSet(time.Now()).Version; current != expectedVersion {
+		return pack.SizeSet{}, fmt.Errorf("%w: expected version %d, current is %d", pack.ErrConflict, expectedVersion, current)
+	}
+
+	return r.storePackSizes(ctx, set)
+}
+
+func (r *Repo) UpdatePackSizes(
+	ctx context.Context,
+	author string,
+	update func(pack.SizeSet) ([]int, error),
+) (pack.SizeSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current := r.effectiveSizeSet(time.Now())
+
+	sizes, err := update(cloneSizeSet(current))
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+	if slices.Equal(slices.Sorted(slices.Values(sizes)), current.Sizes) {
+		return cloneSizeSet(current), nil
+	}
+
+	return r.storePackSizes(ctx, pack.SizeSet{Sizes: sizes, Author: author})
+}
+
+// storePackSizes appends a new version and its audit entry, expects the Repo to be locked
+func (r *Repo) storePackSizes(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+	sizes := slices.Sorted(slices.Values(set.Sizes))
+	for i, s := range sizes {
+		if s <= 0 {
+			return pack.SizeSet{}, &pack.FieldError{Field: "sizes", Reason: fmt.Sprintf("size amount is not positive: %d", s)}
+		}
+		if i > 0 && sizes[i-1] == s {
+			return pack.SizeSet{}, &pack.FieldError{Field: "sizes", Reason: fmt.Sprintf("duplicate size: %d", s)}
+		}
+	}
+
+	if set.RolledBackFrom != 0 {
+		if _, ok := r.sizeSet(set.RolledBackFrom); !ok {
+			return pack.SizeSet{}, fmt.Errorf("pack sizes version %d: %w", set.RolledBackFrom, pack.ErrNotFound)
+		}
+	}
+
+	now := time.Now()
+	old := r.effectiveSizeSet(now)
+
+	set.Version = r.latestVersion() + 1
+	set.Sizes = sizes
+	set.CreatedAt = now
+	set.CancelledAt = time.Time{}
+	if set.EffectiveFrom.IsZero() {
+		set.EffectiveFrom = now
+	}
+
+	state := r.state
+	state.SizeSets = append(slices.Clip(state.SizeSets), set)
+	state.AuditLog = append(slices.Clip(state.AuditLog), pack.AuditEntry{
+		CreatedAt:  set.CreatedAt,
+		Actor:      set.Author,
+		ClientIP:   pack.ClientIP(ctx),
+		OldVersion: old.Version,
+		OldSizes:   old.Sizes,
+		NewVersion: set.Version,
+		NewSizes:   sizes,
+	})
+	if err := r.commit(state); err != nil {
+		return pack.SizeSet{}, err
+	}
+
+	return cloneSizeSet(set), nil
+}
+
+func (r *Repo) CancelPackSizes(ctx context.Context, version int, author string) (pack.SizeSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.cancelPackSizes(ctx, version, author)
+}
+
+// cancelPackSizes marks a scheduled version as cancelled and appends its audit entry, expects the Repo to be locked
+func (r *Repo) cancelPackSizes(ctx context.Context, version int, author string) (pack.SizeSet, error) {
+	set, ok := r.sizeSet(version)
+	if !ok {
+		return pack.SizeSet{}, fmt.Errorf("pack sizes version %d: %w", version, pack.ErrNotFound)
+	}
+
+	now := time.Now()
+	if !set.IsScheduled(now) {
+		return pack.SizeSet{}, fmt.Errorf("%w: pack sizes version %d is not scheduled", pack.ErrConflict, version)
+	}
+
+	set.CancelledAt = now
+	current := r.effectiveSizeSet(now)
+
+	state := r.state
+	state.SizeSets = slices.Clone(state.SizeSets)
+	state.SizeSets[slices.IndexFunc(state.SizeSets, func(s pack.SizeSet) bool { return s.Version == version })] = set
+	state.AuditLog = append(slices.Clip(state.AuditLog), pack.AuditEntry{
+		CreatedAt:  now,
+		Actor:      author,
+		ClientIP:   pack.ClientIP(ctx),
+		OldVersion: current.Version,
+		OldSizes:   current.Sizes,
+		NewVersion: set.Version,
+		NewSizes:   set.Sizes,
+		Cancelled:  true,
+	})
+	if err := r.commit(state); err != nil {
+		return pack.SizeSet{}, err
+	}
+
+	return cloneSizeSet(set), nil
+}
+
+func (r *Repo) ApplyPackSizes(
+	ctx context.Context,
+	plan func([]pack.SizeSet) (pack.SizeSetChanges, error),
+) ([]pack.SizeSet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	changes, err := plan(r.sizeSets())
+	if err != nil {
+		return nil, err
+	}
+
+	// The changes are made one by one without persisting them, then the resulting state is either committed
+	// as a whole or discarded
+	prev, persist := r.state, r.persist
+	r.persist = nil
+	stored, err := r.applyPackSizes(ctx, changes)
+	r.persist = persist
+
+	state := r.state
+	r.state = prev
+	if err != nil {
+		return nil, err
+	}
+	if err := r.commit(state); err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+// applyPackSizes makes the changes one by one, expects the Repo to be locked
+func (r *Repo) applyPackSizes(ctx context.Context, changes pack.SizeSetChanges) ([]pack.SizeSet, error) {
+	for _, version := range changes.Cancel {
+		if _, err := r.cancelPackSizes(ctx, version, changes.Author); err != nil {
+			return nil, err
+		}
+	}
+
+	stored := make([]pack.SizeSet, 0, len(changes.Store))
+	for _, set := range changes.Store {
+		set, err := r.storePackSizes(ctx, set)
+		if err != nil {
+			return nil, err
+		}
+		stored = append(stored, set)
+	}
+
+	return stored, nil
+}
+
+func (r *Repo) StoreCalculation(ctx context.Context, calc pack.Calculation) error {
+	r.calcMu.Lock()
+	defer r.calcMu.Unlock()
+
+	calc.Sizes = slices.Clone(calc.Sizes)
+	calc.Packs = maps.Clone(calc.Packs)
+
+	if r.persistCalc != nil {
+		if err := r.persistCalc(calc); err != nil {
+			return err
+		}
+	}
+
+	// Dropping the oldest calculation from the front keeps the history bounded,
+	// append copies only the kept ones whenever it grows the array
+	if len(r.calcs) == MaxCalculations {
+		r.calcs = r.calcs[1:]
+	}
+	r.calcs = append(r.calcs, calc)
+
+	return nil
+}
+
+func (r *Repo) GetCalculations(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+	r.calcMu.RLock()
+	defer r.calcMu.RUnlock()
+
+	var calcs []pack.Calculation
+	for _, c := range r.calcs {
+		if !filter.From.IsZero() && c.CreatedAt.Before(filter.From) ||
+			!filter.To.IsZero() && !c.CreatedAt.Before(filter.To) ||
+			filter.MinOrder != 0 && c.Order < filter.MinOrder ||
+			filter.MaxOrder != 0 && c.Order > filter.MaxOrder {
+			continue
+		}
+		calcs = append(calcs, c)
+	}
+
+	// Newest first, the latest stored first among equal timestamps
+	slices.Reverse(calcs)
+	slices.SortStableFunc(calcs, func(a, b pack.Calculation) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+
+	calcs = calcs[min(filter.Offset, len(calcs)):]
+	if filter.Limit > 0 {
+		calcs = calcs[:min(filter.Limit, len(calcs))]
+	}
+
+	res := make([]pack.Calculation, 0, len(calcs))
+	for _, c := range calcs {
+		c.Sizes = slices.Clone(c.Sizes)
+		c.Packs = maps.Clone(c.Packs)
+		res = append(res, c)
+	}
+
+	return res, nil
+}
+
+func (r *Repo) GetAuditEntries(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var entries []pack.AuditEntry
+	for _, e := range slices.Backward(r.state.AuditLog) {
+		if !filter.From.IsZero() && e.CreatedAt.Before(filter.From) ||
+			!filter.To.IsZero() && !e.CreatedAt.Before(filter.To) ||
+			filter.Actor != "" && e.Actor != filter.Actor {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	entries = entries[min(filter.Offset, len(entries)):]
+	if filter.Limit > 0 {
+		entries = entries[:min(filter.Limit, len(entries))]
+	}
+
+	res := make([]pack.AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		e.OldSizes = slices.Clone(e.OldSizes)
+		e.NewSizes = slices.Clone(e.NewSizes)
+		res = append(res, e)
+	}
+
+	return res, nil
+}
+
+func (r *Repo) StoreAPIKey(ctx context.Context, key pack.APIKey) (pack.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.ID = len(r.state.APIKeys) + 1
+	key.CreatedAt = time.Now()
+	key.RevokedAt = time.Time{}
+
+	state := r.state
+	state.APIKeys = append(slices.Clip(state.APIKeys), key)
+	if err := r.commit(state); err != nil {
+		return pack.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (r *Repo) GetAPIKey(ctx context.Context, hash string) (pack.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := slices.IndexFunc(r.state.APIKeys, func(k pack.APIKey) bool { return k.Hash == hash })
+	if i < 0 {
+		return pack.APIKey{}, fmt.Errorf("API key: %w", pack.ErrNotFound)
+	}
+
+	return r.state.APIKeys[i], nil
+}
+
+func (r *Repo) GetAPIKeys(ctx context.Context) ([]pack.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Clone(r.state.APIKeys), nil
+}
+
+func (r *Repo) RevokeAPIKey(ctx context.Context, id int) (pack.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// IDs are assigned in order starting with 1 and keys are never removed
+	if id <= 0 || id > len(r.state.APIKeys) {
+		return pack.APIKey{}, fmt.Errorf("API key %d: %w", id, pack.ErrNotFound)
+	}
+
+	key := r.state.APIKeys[id-1]
+	if !key.RevokedAt.IsZero() {
+		return pack.APIKey{}, fmt.Errorf("%w: API key %d is already revoked", pack.ErrConflict, id)
+	}
+	key.RevokedAt = time.Now()
+
+	state := r.state
+	state.APIKeys = slices.Clone(state.APIKeys)
+	state.APIKeys[id-1] = key
+	if err := r.commit(state); err != nil {
+		return pack.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+// commit persists the new state if needed and makes it current, expects the Repo to be locked
+func (r *Repo) commit(state Snapshot) error {
+	if r.persist != nil {
+		if err := r.persist(state); err != nil {
+			return err
+		}
+	}
+
+	r.state = state
+
+	return nil
+}
+
+// sizeSets returns copies of all versions, the latest first, expects the Repo to be locked
+func (r *Repo) sizeSets() []pack.SizeSet {
+	var sets []pack.SizeSet
+	for _, set := range slices.Backward(r.state.SizeSets) {
+		sets = append(sets, cloneSizeSet(set))
+	}
+
+	return sets
+}
+
+// sizeSet finds a version, expects the Repo to be locked
+func (r *Repo) sizeSet(version int) (pack.SizeSet, bool) {
+	i, ok := slices.BinarySearchFunc(r.state.SizeSets, version, func(s pack.SizeSet, v int) int {
+		return cmp.Compare(s.Version, v)
+	})
+	if !ok {
+		return pack.SizeSet{}, false
+	}
+
+	return r.state.SizeSets[i], true
+}
+
+// effectiveSizeSet finds the version effective at the given time or returns an empty SizeSet,
+// expects the Repo to be locked
+func (r *Repo) effectiveSizeSet(at time.Time) pack.SizeSet {
+	var effective pack.SizeSet
+	for _, s := range r.state.SizeSets {
+		if !s.CancelledAt.IsZero() || s.EffectiveFrom.After(at) {
+			continue
+		}
+		// Versions are ordered, so a later one wins among equal EffectiveFrom
+		if effective.Version == 0 || !s.EffectiveFrom.Before(effective.EffectiveFrom) {
+			effective = s
+		}
+	}
+
+	return effective
+}
+
+// latestVersion returns the latest version or 0 if nothing was stored yet, expects the Repo to be locked
+func (r *Repo) latestVersion() int {
+	if len(r.state.SizeSets) == 0 {
+		return 0
+	}
+
+	return r.state.SizeSets[len(r.state.SizeSets)-1].Version
+}
+
+func cloneSizeSet(set pack.SizeSet) pack.SizeSet {
+	set.Sizes = slices.Clone(set.Sizes)
+	return set
+}
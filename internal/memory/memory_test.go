@@ -0,0 +1,43 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/memory"
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/achere/homework-pack-sizes/internal/repotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo(t *testing.T) {
+	repotest.TestPackSizeRepo(t, func(t *testing.T) pack.PackSizeRepo {
+		return memory.NewRepo()
+	})
+	repotest.TestCalculationRepo(t, func(t *testing.T) pack.CalculationRepo {
+		return memory.NewRepo()
+	})
+	repotest.TestAuditRepo(t, func(t *testing.T) repotest.AuditedRepo {
+		return memory.NewRepo()
+	})
+	repotest.TestAPIKeyRepo(t, func(t *testing.T) pack.APIKeyRepo {
+		return memory.NewRepo()
+	})
+}
+
+func TestRepo_MaxCalculations(t *testing.T) {
+	repo := memory.NewRepo()
+	ctx := context.Background()
+
+	for i := range memory.MaxCalculations + 10 {
+		require.NoError(t, repo.StoreCalculation(ctx, pack.Calculation{Order: i + 1}))
+	}
+
+	calcs, err := repo.GetCalculations(ctx, pack.CalculationFilter{})
+	require.NoError(t, err)
+	if assert.Len(t, calcs, memory.MaxCalculations) {
+		assert.Equal(t, memory.MaxCalculations+10, calcs[0].Order)
+		assert.Equal(t, 11, calcs[len(calcs)-1].Order)
+	}
+}
@@ -0,0 +1,111 @@
+package pack
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidKey means an API key is unknown or was revoked
+var ErrInvalidKey = fmt.Errorf("invalid API key")
+
+// Role grants access to a group of operations. Every role is allowed everything the roles before it are.
+type Role string
+
+const (
+	// RoleReader reads pack sizes, their versions, the calculation history and the audit log
+	RoleReader Role = "reader"
+	// RoleCalculator also calculates packs and evaluates pack sizes without changing them
+	RoleCalculator Role = "calculator"
+	// RoleAdmin also changes pack sizes and manages API keys
+	RoleAdmin Role = "admin"
+)
+
+// roles are ordered from the least to the most privileged
+var roles = []Role{RoleReader, RoleCalculator, RoleAdmin}
+
+// Allows determines if the role is allowed the operations of the required role
+func (r Role) Allows(required Role) bool {
+	i := slices.Index(roles, r)
+	return i >= 0 && i >= slices.Index(roles, required)
+}
+
+// apiKeyPrefix makes API keys easy to recognise, e.g. by secret scanners
+const apiKeyPrefix = "pk_"
+
+// APIKey grants its Role to whoever presents the key. Only the hash of the key is stored,
+// the key itself is returned once when it's created.
+type APIKey struct {
+	ID        int
+	Name      string // who the key was issued to, recorded as the author of changes
+	Role      Role
+	Hash      string
+	CreatedAt time.Time
+	RevokedAt time.Time // zero if the key wasn't revoked
+}
+
+// APIKeyRepo stores API keys.
+// StoreAPIKey stores the Name, Role and Hash of the key and returns it with the assigned ID and CreatedAt.
+// GetAPIKey finds a key by its hash, including revoked keys, and returns ErrNotFound for an unknown hash.
+// GetAPIKeys returns all keys ordered by ID.
+// RevokeAPIKey revokes a key, returns ErrNotFound for an unknown ID and ErrConflict if it's already revoked.
+type APIKeyRepo interface {
+	StoreAPIKey(context.Context, APIKey) (APIKey, error)
+	GetAPIKey(context.Context, string) (APIKey, error)
+	GetAPIKeys(context.Context) ([]APIKey, error)
+	RevokeAPIKey(context.Context, int) (APIKey, error)
+}
+
+// CreateAPIKey generates a new API key for name with the given role and stores its hash in the repository.
+// It returns the stored key and the key itself, which can't be retrieved later.
+func CreateAPIKey(ctx context.Context, repo APIKeyRepo, name string, role Role) (APIKey, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return APIKey{}, "", invalidField("name", "name is empty")
+	}
+	if !slices.Contains(roles, role) {
+		return APIKey{}, "", invalidField("role", "unknown role: %q", role)
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return APIKey{}, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	token := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key, err := repo.StoreAPIKey(ctx, APIKey{Name: name, Role: role, Hash: HashAPIKey(token)})
+	if err != nil {
+		return APIKey{}, "", err
+	}
+
+	return key, token, nil
+}
+
+// HashAPIKey returns the hash an API key is stored by. Generated keys are random enough for a fast hash,
+// so keys can be looked up by it on every request.
+func HashAPIKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate finds the key stored for token and returns ErrInvalidKey if there is none or it was revoked
+func Authenticate(ctx context.Context, repo APIKeyRepo, token string) (APIKey, error) {
+	key, err := repo.GetAPIKey(ctx, HashAPIKey(token))
+	if errors.Is(err, ErrNotFound) {
+		return APIKey{}, ErrInvalidKey
+	}
+	if err != nil {
+		return APIKey{}, fmt.Errorf("couldn't get API key: %w", err)
+	}
+	if !key.RevokedAt.IsZero() {
+		return APIKey{}, ErrInvalidKey
+	}
+
+	return key, nil
+}
@@ -0,0 +1,47 @@
+package pack
+
+import (
+	"context"
+	"time"
+)
+
+// AuditEntry records a single change of the stored pack sizes
+type AuditEntry struct {
+	CreatedAt  time.Time
+	Actor      string
+	ClientIP   string
+	OldVersion int // 0 if nothing was stored before
+	OldSizes   []int
+	NewVersion int
+	NewSizes   []int
+	Cancelled  bool // NewVersion was cancelled instead of stored, so OldVersion stays effective
+}
+
+// AuditFilter narrows down the audit entries returned by AuditRepo, newest first.
+// Zero values mean no restriction.
+type AuditFilter struct {
+	From   time.Time // inclusive
+	To     time.Time // exclusive
+	Actor  string
+	Limit  int
+	Offset int
+}
+
+// AuditRepo reads the append-only audit log. Entries are written by the PackSizeRepo
+// in the same transaction as the change they record, so there is no way to store them separately.
+type AuditRepo interface {
+	GetAuditEntries(context.Context, AuditFilter) ([]AuditEntry, error)
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a context carrying the address of the client making a change, for the audit log
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIP returns the client address set by WithClientIP, or an empty string
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -0,0 +1,129 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// ExportFormatVersion is the version of the Export document, changed whenever it changes incompatibly
+const ExportFormatVersion = 1
+
+// Export is the whole stored configuration that can be moved to another instance
+type Export struct {
+	FormatVersion int
+	ExportedAt    time.Time
+	SizeSets      []SizeSet // all versions of pack sizes, the latest first
+}
+
+// ImportDiff describes how an import changes the stored configuration
+type ImportDiff struct {
+	OldSizes  []int     // currently effective sizes before the import
+	NewSizes  []int     // currently effective sizes after the import, equal to OldSizes if they don't change
+	Scheduled []SizeSet // versions that are scheduled by the import
+	Cancelled []SizeSet // scheduled versions that are cancelled by the import
+	Stored    []SizeSet // created versions, only when the import is applied
+}
+
+// IsEmpty determines if the import changes nothing
+func (d ImportDiff) IsEmpty() bool {
+	return slices.Equal(d.OldSizes, d.NewSizes) && len(d.Scheduled) == 0 && len(d.Cancelled) == 0
+}
+
+// ExportConfig returns all stored configuration as an Export document
+func ExportConfig(ctx context.Context, repo PackSizeRepo) (Export, error) {
+	sets, err := repo.GetPackSizeSets(ctx)
+	if err != nil {
+		return Export{}, fmt.Errorf("couldn't get pack sizes versions: %w", err)
+	}
+
+	return Export{
+		FormatVersion: ExportFormatVersion,
+		ExportedAt:    time.Now(),
+		SizeSets:      sets,
+	}, nil
+}
+
+// ImportConfig makes the stored configuration match an Export document on behalf of author: the sizes effective
+// in the document now become the current sizes and the versions scheduled in it are scheduled, while the other
+// scheduled versions are cancelled. The history of the document isn't copied as the versions are local to
+// every instance. If nothing is effective in the document, the current sizes are kept.
+// All changes are applied atomically, and only returned without applying them if dryRun is set.
+func ImportConfig(ctx context.Context, repo PackSizeRepo, doc Export, author string, dryRun bool) (ImportDiff, error) {
+	if doc.FormatVersion != ExportFormatVersion {
+		return ImportDiff{}, invalidField("format_version", "unsupported format version %d, expected %d", doc.FormatVersion, ExportFormatVersion)
+	}
+	for _, set := range doc.SizeSets {
+		if err := validateSizes(set.Sizes); err != nil {
+			return ImportDiff{}, fmt.Errorf("pack sizes version %d: %w", set.Version, err)
+		}
+	}
+
+	now := time.Now()
+	if dryRun {
+		sets, err := repo.GetPackSizeSets(ctx)
+		if err != nil {
+			return ImportDiff{}, fmt.Errorf("couldn't get pack sizes versions: %w", err)
+		}
+
+		diff, _ := planImport(sets, doc.SizeSets, author, now)
+		return diff, nil
+	}
+
+	var diff ImportDiff
+	stored, err := repo.ApplyPackSizes(ctx, func(sets []SizeSet) (SizeSetChanges, error) {
+		var changes SizeSetChanges
+		diff, changes = planImport(sets, doc.SizeSets, author, now)
+		return changes, nil
+	})
+	if err != nil {
+		return ImportDiff{}, fmt.Errorf("couldn't apply the import: %w", err)
+	}
+	diff.Stored = stored
+
+	return diff, nil
+}
+
+// planImport works out the changes that make the stored versions match the imported ones at the given time
+func planImport(stored, imported []SizeSet, author string, now time.Time) (ImportDiff, SizeSetChanges) {
+	changes := SizeSetChanges{Author: author}
+
+	current := effectiveSizeSet(stored, now)
+	diff := ImportDiff{
+		OldSizes: current.Sizes,
+		NewSizes: current.Sizes,
+	}
+
+	if target := effectiveSizeSet(imported, now); target.Version != 0 {
+		sizes := slices.Sorted(slices.Values(target.Sizes))
+		if !slices.Equal(sizes, current.Sizes) {
+			diff.NewSizes = sizes
+			changes.Store = append(changes.Store, SizeSet{Sizes: sizes, Author: author})
+		}
+	}
+
+	scheduled := scheduledSizeSets(stored, now)
+	for _, target := range scheduledSizeSets(imported, now) {
+		sizes := slices.Sorted(slices.Values(target.Sizes))
+
+		i := slices.IndexFunc(scheduled, func(s SizeSet) bool {
+			return s.EffectiveFrom.Equal(target.EffectiveFrom) && slices.Equal(s.Sizes, sizes)
+		})
+		if i >= 0 {
+			scheduled = slices.Delete(scheduled, i, i+1)
+			continue
+		}
+
+		set := SizeSet{Sizes: sizes, Author: author, EffectiveFrom: target.EffectiveFrom}
+		diff.Scheduled = append(diff.Scheduled, set)
+		changes.Store = append(changes.Store, set)
+	}
+
+	for _, s := range scheduled {
+		diff.Cancelled = append(diff.Cancelled, s)
+		changes.Cancel = append(changes.Cancel, s.Version)
+	}
+
+	return diff, changes
+}
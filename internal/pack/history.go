@@ -0,0 +1,32 @@
+package pack
+
+import (
+	"context"
+	"time"
+)
+
+// Calculation is a record of a single pack calculation
+type Calculation struct {
+	CreatedAt time.Time
+	Order     int
+	Sizes     []int
+	Packs     map[int]int
+	Solver    Solver
+	Version   int // version of the stored pack sizes, 0 if sizes were provided with the request
+}
+
+// CalculationFilter narrows down the calculations returned by CalculationRepo, newest first.
+// Zero values mean no restriction.
+type CalculationFilter struct {
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	MinOrder int
+	MaxOrder int
+	Limit    int
+	Offset   int
+}
+
+type CalculationRepo interface {
+	StoreCalculation(context.Context, Calculation) error
+	GetCalculations(context.Context, CalculationFilter) ([]Calculation, error)
+}
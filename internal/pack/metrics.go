@@ -0,0 +1,29 @@
+package pack
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// Metrics of the calculations, see Collectors().
+// The solver metrics cover every calculation including simulations and recommendations,
+// the order sizes only the orders calculated with CalculatePacks(), Calculate() and CalculatePacksBatchWithRepo().
+var (
+	calculationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pack_calculation_duration_seconds",
+		Help:    "Time taken to calculate packs for an order, by the solver that produced the result.",
+		Buckets: prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"solver"})
+	dpTableSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pack_dp_table_entries",
+		Help:    "Entries of the table allocated by the DP solver, one for every amount of items up to the order plus the smallest pack size.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 6),
+	})
+	orderSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "pack_order_items",
+		Help:    "Items ordered in calculations.",
+		Buckets: prometheus.ExponentialBuckets(10, 10, 6),
+	})
+)
+
+// Collectors returns the metrics of the calculations to be registered with Prometheus
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{calculationDuration, dpTableSize, orderSize}
+}
@@ -3,53 +3,216 @@ package pack
 import (
 	"context"
 	"fmt"
-	"maps"
 	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-var ErrInvalidArg = fmt.Errorf("invalid arguments received")
+var (
+	ErrInvalidArg = fmt.Errorf("invalid arguments received")
+	ErrNotFound   = fmt.Errorf("not found")
+	ErrConflict   = fmt.Errorf("version conflict")
+	// ErrUnavailable means the repository can't be reached or doesn't respond in time, so the same call may succeed later
+	ErrUnavailable = fmt.Errorf("repository unavailable")
+)
 
-type PackSizeRepo interface {
-	GetPackSizes(context.Context) ([]int, error)
-	StorePackSizes(context.Context, []int) error
+// FieldError is an ErrInvalidArg caused by the value of a single input field
+type FieldError struct {
+	Field  string // name of the field in the API, e.g. "order" or "sizes"
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrInvalidArg, e.Reason)
 }
 
-type packSolution struct {
-	packs      map[int]int
-	totalItems int
-	totalPacks int
-	isValid    bool
+func (e *FieldError) Unwrap() error {
+	return ErrInvalidArg
+}
+
+// invalidField returns a FieldError for field with a formatted reason
+func invalidField(field, format string, args ...any) error {
+	return &FieldError{Field: field, Reason: fmt.Sprintf(format, args...)}
+}
+
+// Solver identifies the algorithm that produced a calculation result
+type Solver string
+
+const (
+	SolverDP     Solver = "dp"
+	SolverGreedy Solver = "greedy"
+)
+
+const (
+	// MaxPackSizes is the most sizes a set of pack sizes can have
+	MaxPackSizes = 100
+	// MaxPackSize is the largest pack size
+	MaxPackSize = 1_000_000
+	// MaxOrder is the largest order amount. Together with MaxPackSize it bounds a calculation
+	// to a table of MaxOrder+MaxPackSize entries of 8 bytes, filled in a step per entry and size.
+	MaxOrder = 1_000_000
+)
+
+// PackSizeRepo stores versioned sets of pack sizes.
+// GetPackSizesAt returns the version effective at the given time: the one with the latest EffectiveFrom
+// not after it among the versions that weren't cancelled, the highest version among equal EffectiveFrom.
+// It returns an empty SizeSet if no version was effective yet. GetPackSizes does the same for the current time.
+// StorePackSizes creates a new version from the Sizes, Author, RolledBackFrom and EffectiveFrom of the set
+// and returns it. A zero EffectiveFrom makes the version effective from its creation time.
+// CompareAndStorePackSizes does the same as StorePackSizes only if the currently effective version is still
+// the expected one (0 if nothing was stored yet) and returns ErrConflict otherwise, atomically.
+// UpdatePackSizes calls update with the currently effective version and stores the sizes it returns as a new version
+// by author atomically, so no other version can be stored in between. If the sizes don't change, nothing is stored
+// and the current version is returned. Errors returned by update are passed through as they are. update may be called
+// more than once if the repository retries the change.
+// CancelPackSizes cancels a version that is not effective yet by author and returns ErrConflict for any other version.
+// ApplyPackSizes calls plan with all versions, the latest first, and applies the changes it returns atomically:
+// either all of them or none. The Cancel versions are cancelled by the Author as with CancelPackSizes and then
+// the Store sets are stored in order as with StorePackSizes. It returns the stored versions. Errors returned by plan
+// are passed through as they are, and plan may be called more than once if the repository retries the change.
+// GetNextEffectiveFrom returns the earliest EffectiveFrom after the given time among the versions that weren't
+// cancelled, or a zero time if there is none, so the current version can be cached until the next one takes effect.
+// GetPackSizeSet and CancelPackSizes return ErrNotFound for an unknown version.
+// Every stored or cancelled version is recorded in the audit log with its author as the actor and ClientIP() of the context.
+type PackSizeRepo interface {
+	GetPackSizes(context.Context) (SizeSet, error)
+	GetPackSizesAt(context.Context, time.Time) (SizeSet, error)
+	StorePackSizes(context.Context, SizeSet) (SizeSet, error)
+	CompareAndStorePackSizes(context.Context, int, SizeSet) (SizeSet, error)
+	UpdatePackSizes(context.Context, string, func(SizeSet) ([]int, error)) (SizeSet, error)
+	CancelPackSizes(context.Context, int, string) (SizeSet, error)
+	ApplyPackSizes(context.Context, func([]SizeSet) (SizeSetChanges, error)) ([]SizeSet, error)
+	GetPackSizeSets(context.Context) ([]SizeSet, error)
+	GetPackSizeSet(context.Context, int) (SizeSet, error)
+	GetNextEffectiveFrom(context.Context, time.Time) (time.Time, error)
 }
 
 // CalculatePacksWithRepo calculates the number of packs for a given order, fetching pack sizes from a repository,
 // using the same logic as the CalculatePacks(). It respects the context passed as the first parameter.
-// It returns the calculated packs, a sorted slice of available pack sizes, and any error encountered.
-func CalculatePacksWithRepo(ctx context.Context, repo PackSizeRepo, order int) (map[int]int, []int, error) {
-	sizes, err := repo.GetPackSizes(ctx)
+// It returns a Calculation with the calculated packs, a sorted slice of available pack sizes, their version
+// and the solver used, and any error encountered.
+// The pack sizes are the ones effective at asOf, or the current ones if asOf is zero.
+// Getting the pack sizes and the calculation are traced as separate spans.
+func CalculatePacksWithRepo(ctx context.Context, repo PackSizeRepo, order int, asOf time.Time) (_ Calculation, err error) {
+	ctx, span := startSpan(ctx, "CalculatePacksWithRepo", attribute.Int("pack.order", order))
+	defer func() { endSpan(span, err) }()
+
+	set, err := getPackSizesAt(ctx, repo, asOf)
 	if err != nil {
-		return nil, nil, fmt.Errorf("couldn't get pack sizes: %w", err)
+		return Calculation{}, fmt.Errorf("couldn't get pack sizes: %w", err)
 	}
 
-	packs, err := CalculatePacks(sizes, order)
+	_, solveSpan := startSpan(ctx, "Calculate", attribute.Int("pack.sizes", len(set.Sizes)))
+	calc, err := Calculate(set.Sizes, order)
+	if err == nil {
+		solveSpan.SetAttributes(attribute.String("pack.solver", string(calc.Solver)))
+	}
+	endSpan(solveSpan, err)
 	if err != nil {
-		return nil, nil, fmt.Errorf("couldn't calculate packs: %w", err)
+		return Calculation{}, fmt.Errorf("couldn't calculate packs: %w", err)
 	}
+	calc.Version = set.Version
 
-	slices.Sort(sizes)
-
-	return packs, sizes, nil
+	return calc, nil
 }
 
-// SavePackSizes saves a new set of pack sizes to the repository.
-// It ensures that all provided pack sizes are positive integers.
-func SavePackSizes(ctx context.Context, repo PackSizeRepo, sizes []int) error {
-	for _, s := range sizes {
-		if s <= 0 {
-			return fmt.Errorf("%w: size amount is not positive: %d", ErrInvalidArg, s)
+// CalculatePacksBatchWithRepo calculates the packs for each of orders with the same version of pack sizes
+// from a repository, effective at asOf or the current ones if asOf is zero, using the same logic as CalculatePacks().
+// The orders share a single table up to the largest of them, so a batch takes as long as its largest order alone.
+// The calculations are passed to yield in the order of orders. Nothing is calculated if any of the orders
+// is invalid, and it stops at the first error yield returns.
+func CalculatePacksBatchWithRepo(
+	ctx context.Context,
+	repo PackSizeRepo,
+	orders []int,
+	asOf time.Time,
+	yield func(Calculation) error,
+) (err error) {
+	ctx, span := startSpan(ctx, "CalculatePacksBatchWithRepo", attribute.Int("pack.orders", len(orders)))
+	defer func() { endSpan(span, err) }()
+
+	for _, order := range orders {
+		if err := validateOrder(order); err != nil {
+			return fmt.Errorf("couldn't calculate packs for %d: %w", order, err)
 		}
 	}
 
-	return repo.StorePackSizes(ctx, sizes)
+	set, err := getPackSizesAt(ctx, repo, asOf)
+	if err != nil {
+		return fmt.Errorf("couldn't get pack sizes: %w", err)
+	}
+	if len(set.Sizes) == 0 {
+		return invalidField("sizes", "no pack sizes provided")
+	}
+	if err := validateSizes(set.Sizes); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	table := newOrdersTable(set.Sizes, slices.Max(orders))
+	dpTableSize.Observe(float64(len(table.last)))
+	calculationDuration.WithLabelValues(string(SolverDP)).Observe(time.Since(start).Seconds())
+
+	sizes := slices.Sorted(slices.Values(set.Sizes))
+	for _, order := range orders {
+		items, _ := table.fewestItems(order)
+		orderSize.Observe(float64(order))
+
+		calc := Calculation{
+			CreatedAt: time.Now(),
+			Order:     order,
+			Sizes:     slices.Clone(sizes),
+			Packs:     table.packs(items),
+			Solver:    SolverDP,
+			Version:   set.Version,
+		}
+		if err := yield(calc); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getPackSizesAt gets the pack sizes effective at asOf, or the current ones if it's zero, in a span of its own
+func getPackSizesAt(ctx context.Context, repo PackSizeRepo, asOf time.Time) (set SizeSet, err error) {
+	ctx, span := startSpan(ctx, "GetPackSizes")
+	defer func() {
+		span.SetAttributes(attribute.Int("pack.version", set.Version))
+		endSpan(span, err)
+	}()
+
+	if asOf.IsZero() {
+		return repo.GetPackSizes(ctx)
+	}
+	return repo.GetPackSizesAt(ctx, asOf)
+}
+
+// SavePackSizes saves a new version of pack sizes to the repository on behalf of author and returns it.
+// It ensures that the pack sizes are valid, see validateSizes().
+func SavePackSizes(ctx context.Context, repo PackSizeRepo, sizes []int, author string) (SizeSet, error) {
+	if err := validateSizes(sizes); err != nil {
+		return SizeSet{}, err
+	}
+
+	return repo.StorePackSizes(ctx, SizeSet{Sizes: sizes, Author: author})
+}
+
+// SavePackSizesIfVersion saves a new version of pack sizes the same way as SavePackSizes(),
+// but only if the currently effective version in the repository is still expectedVersion. Otherwise it returns ErrConflict.
+func SavePackSizesIfVersion(
+	ctx context.Context,
+	repo PackSizeRepo,
+	sizes []int,
+	author string,
+	expectedVersion int,
+) (SizeSet, error) {
+	if err := validateSizes(sizes); err != nil {
+		return SizeSet{}, err
+	}
+
+	return repo.CompareAndStorePackSizes(ctx, expectedVersion, SizeSet{Sizes: sizes, Author: author})
 }
 
 // CalculatePacks calculates the number of packs of different sizes to fulfill an order according to the following rules:
@@ -63,98 +226,144 @@ func SavePackSizes(ctx context.Context, repo PackSizeRepo, sizes []int) error {
 //
 // Returns:
 //   - A map where the keys are the pack sizes and the values are the number of packs of that size.
-//   - An error if the order amount or any of the pack sizes are not positive.
+//   - An error if the order amount or any of the pack sizes are not positive, or if no pack sizes are provided.
 func CalculatePacks(sizes []int, order int) (map[int]int, error) {
-	if order <= 0 {
-		return nil, fmt.Errorf("%w: order amount is not positive", ErrInvalidArg)
+	packs, _, err := calculatePacks(sizes, order)
+	return packs, err
+}
+
+// Calculate calculates the number of packs for a given order using the same logic as the CalculatePacks(),
+// without modifying sizes. It returns a Calculation with the calculated packs, a sorted copy of sizes
+// and the solver that produced the result.
+func Calculate(sizes []int, order int) (Calculation, error) {
+	sizes = slices.Clone(sizes)
+
+	packs, solver, err := calculatePacks(sizes, order)
+	if err != nil {
+		return Calculation{}, err
 	}
 
-	for _, s := range sizes {
-		if s <= 0 {
-			return nil, fmt.Errorf("%w: size amount is not positive: %d", ErrInvalidArg, s)
-		}
+	slices.Sort(sizes)
+
+	return Calculation{
+		CreatedAt: time.Now(),
+		Order:     order,
+		Sizes:     sizes,
+		Packs:     packs,
+		Solver:    solver,
+	}, nil
+}
+
+// calculatePacks implements CalculatePacks() additionally reporting the solver used
+func calculatePacks(sizes []int, order int) (map[int]int, Solver, error) {
+	if err := validateOrder(order); err != nil {
+		return nil, "", err
 	}
 
+	if len(sizes) == 0 {
+		return nil, "", invalidField("sizes", "no pack sizes provided")
+	}
+
+	if err := validateSizes(sizes); err != nil {
+		return nil, "", err
+	}
+	orderSize.Observe(float64(order))
+
 	slices.SortFunc(sizes, func(a, b int) int {
 		return b - a
 	})
 
+	start := time.Now()
+
 	res, valid := calculatePacksDp(sizes, order)
 
 	if valid {
-		return res, nil
+		calculationDuration.WithLabelValues(string(SolverDP)).Observe(time.Since(start).Seconds())
+		return res, SolverDP, nil
 	}
 
 	// If cannot find optimal solution, return the greedy solution
-	return calculatePacksGreedy(sizes, order), nil
+	res = calculatePacksGreedy(sizes, order)
+	calculationDuration.WithLabelValues(string(SolverGreedy)).Observe(time.Since(start).Seconds())
+
+	return res, SolverGreedy, nil
+}
+
+// validateOrder ensures that the order amount is positive and not more than MaxOrder
+func validateOrder(order int) error {
+	if order <= 0 {
+		return invalidField("order", "order amount is not positive")
+	}
+	if order > MaxOrder {
+		return invalidField("order", "order amount is more than %d: %d", MaxOrder, order)
+	}
+	return nil
 }
 
 // calculatePacksDp uses dynamic programming to calculate optimal pack sizes
 // Expects sizes to be in descending order
 func calculatePacksDp(sizes []int, order int) (map[int]int, bool) {
-	// Calculate best solution for each order amount from 1 till max allowing overflow by largest size
-	// dp[i] represents the best solution for i items
-	maxItems := order + sizes[len(sizes)-1]
-	dp := make([]packSolution, maxItems+1)
+	// Calculate best solution for each order amount from 1 till max allowing overflow by smallest size
+	table := newPackTable(sizes, order+sizes[len(sizes)-1])
+	dpTableSize.Observe(float64(len(table.last)))
 
-	// Initialize: 0 items requires 0 packs (valid base case)
-	dp[0] = packSolution{
-		packs:      make(map[int]int),
-		totalItems: 0,
-		totalPacks: 0,
-		isValid:    true,
+	items, ok := table.fewestItems(order)
+	if !ok {
+		return nil, false
 	}
 
+	return table.packs(items), true
+}
+
+// packTable holds the best solution for every number of items up to its length: the fewest packs
+// that add up to it exactly and the size of the last of them, so the packs can be followed back.
+// A last size of 0 means there is no solution. Sizes are int32 to halve the memory of large orders.
+type packTable struct {
+	count []int32
+	last  []int32
+}
+
+// newPackTable fills a packTable up to maxItems. Expects sizes to be in descending order,
+// so the largest size wins when several give the same number of packs.
+func newPackTable(sizes []int, maxItems int) packTable {
+	t := packTable{count: make([]int32, maxItems+1), last: make([]int32, maxItems+1)}
+
 	for items := 1; items <= maxItems; items++ {
-		dp[items] = packSolution{isValid: false}
-
-		for _, packSize := range sizes {
-			// If a valid solution that accomodates current packSize exists,
-			// use it as current solution and increment packs and count of packs of current size
-			if packSize <= items && dp[items-packSize].isValid {
-				packs := make(map[int]int)
-				maps.Copy(packs, dp[items-packSize].packs)
-				packs[packSize]++
-
-				newSolution := packSolution{
-					packs:      packs,
-					totalItems: items,
-					totalPacks: dp[items-packSize].totalPacks + 1,
-					isValid:    true,
-				}
+		for _, size := range sizes {
+			// 0 items requires 0 packs, every other number only has a solution if it was found
+			rest := items - size
+			if rest < 0 || (rest > 0 && t.last[rest] == 0) {
+				continue
+			}
 
-				// If current solution is better than existing, update to current
-				if !dp[items].isValid || isBetterSolution(newSolution, dp[items]) {
-					dp[items] = newSolution
-				}
+			// If current solution is better than existing, update to current
+			if t.last[items] == 0 || t.count[rest]+1 < t.count[items] {
+				t.count[items] = t.count[rest] + 1
+				t.last[items] = int32(size)
 			}
 		}
 	}
 
-	// Find the best solution that satisfies the order (>= order items)
-	var bestSolution packSolution
-	bestSolution.isValid = false
-
-	for items := order; items <= maxItems; items++ {
-		if !dp[items].isValid {
-			continue
-		}
+	return t
+}
 
-		if !bestSolution.isValid || isBetterSolution(dp[items], bestSolution) {
-			bestSolution = dp[items]
-			break
+// fewestItems finds the fewest items of at least order that have a solution
+func (t packTable) fewestItems(order int) (int, bool) {
+	for items := order; items < len(t.last); items++ {
+		if t.last[items] != 0 {
+			return items, true
 		}
 	}
-
-	return bestSolution.packs, bestSolution.isValid
+	return 0, false
 }
 
-// isBetterSolution determines if solution A is better than solution B
-func isBetterSolution(a, b packSolution) bool {
-	if a.totalItems != b.totalItems {
-		return a.totalItems < b.totalItems
+// packs follows the solution for items back to the number of packs of every size
+func (t packTable) packs(items int) map[int]int {
+	packs := make(map[int]int)
+	for ; items > 0; items -= int(t.last[items]) {
+		packs[int(t.last[items])]++
 	}
-	return a.totalPacks < b.totalPacks
+	return packs
 }
 
 // calculatePacksGreedy implemets a greedy strategy for calculating packs while handling some edge cases.
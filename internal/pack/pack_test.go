@@ -1,11 +1,17 @@
 package pack_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCalculatePacks(t *testing.T) {
@@ -62,11 +68,17 @@ func TestCalculatePacksBadInput(t *testing.T) {
 		name  string
 		order int
 		sizes []int
+		field string
 	}{
-		{"Negative order", -2, []int{5, 10}},
-		{"Negative size", -2, []int{5, 10}},
-		{"Zero order", 0, []int{5, 10}},
-		{"Zero size", 2, []int{0, 10}},
+		{"Negative order", -2, []int{5, 10}, "order"},
+		{"Negative size", 2, []int{-5, 10}, "sizes"},
+		{"Zero order", 0, []int{5, 10}, "order"},
+		{"Too large order", pack.MaxOrder + 1, []int{5, 10}, "order"},
+		{"Zero size", 2, []int{0, 10}, "sizes"},
+		{"No sizes", 2, nil, "sizes"},
+		{"Duplicate size", 2, []int{5, 10, 5}, "sizes"},
+		{"Too large size", 2, []int{5, pack.MaxPackSize + 1}, "sizes"},
+		{"Too many sizes", 2, make([]int, pack.MaxPackSizes+1), "sizes"},
 	}
 
 	for _, test := range tests {
@@ -75,7 +87,629 @@ func TestCalculatePacksBadInput(t *testing.T) {
 			_, err := pack.CalculatePacks(test.sizes, test.order)
 			if assert.Error(t, err) {
 				assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+				var fieldErr *pack.FieldError
+				if assert.ErrorAs(t, err, &fieldErr) {
+					assert.Equal(t, test.field, fieldErr.Field)
+				}
+			}
+		})
+	}
+}
+
+func TestRecommendPackSizes(t *testing.T) {
+	tests := []struct {
+		name        string
+		histogram   map[int]int
+		maxSizes    int
+		sizes       []int
+		avgOverfill float64
+	}{
+		{"Exact fit", map[int]int{250: 10, 500: 5}, 2, []int{250, 500}, 0},
+		{"Smaller size covers both", map[int]int{250: 1, 500: 1}, 1, []int{250}, 0},
+		{"Frequent order wins", map[int]int{100: 1, 350: 9}, 1, []int{350}, 25},
+		{"Fewer orders than max sizes", map[int]int{10: 3, 20: 1, 30: 1}, 5, []int{10, 20, 30}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			rec, err := pack.RecommendPackSizes(context.Background(), test.histogram, test.maxSizes)
+			assert.NoError(t, err)
+			assert.Equal(t, test.sizes, rec.Sizes)
+			assert.Equal(t, test.avgOverfill, rec.AvgOverfill)
+		})
+	}
+}
+
+func TestRecommendPackSizesBadInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram map[int]int
+		maxSizes  int
+	}{
+		{"Empty histogram", map[int]int{}, 3},
+		{"Zero max sizes", map[int]int{250: 1}, 0},
+		{"Negative order", map[int]int{-250: 1}, 3},
+		{"Zero count", map[int]int{250: 0}, 3},
+		{"Too many max sizes", map[int]int{250: 1}, pack.MaxPackSizes + 1},
+		{"Too large order", map[int]int{pack.MaxPackSize + 1: 1}, 3},
+		{"Too much work", largeHistogram(100, pack.MaxOrder), 10},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+			_, err := pack.RecommendPackSizes(context.Background(), test.histogram, test.maxSizes)
+			if assert.Error(t, err) {
+				assert.ErrorIs(t, err, pack.ErrInvalidArg)
+			}
+		})
+	}
+}
+
+func TestRecommendPackSizesWorkLimit(t *testing.T) {
+	start := time.Now()
+	_, err := pack.RecommendPackSizes(context.Background(), largeHistogram(100, pack.MaxOrder), 10)
+	var fieldErr *pack.FieldError
+	if assert.ErrorAs(t, err, &fieldErr) {
+		assert.Equal(t, "histogram", fieldErr.Field)
+	}
+	assert.Less(t, time.Since(start), time.Second, "the work is estimated before scoring")
+
+	// Large orders still fit in the limit with few candidates
+	rec, err := pack.RecommendPackSizes(context.Background(), largeHistogram(3, pack.MaxOrder), 2)
+	assert.NoError(t, err)
+	assert.Len(t, rec.Sizes, 2)
+}
+
+// largeHistogram has n orders spread evenly up to largest, each occurring once
+func largeHistogram(n, largest int) map[int]int {
+	histogram := make(map[int]int, n)
+	for i := 1; i <= n; i++ {
+		histogram[largest/n*i] = 1
+	}
+	return histogram
+}
+
+func TestSimulatePackSizes(t *testing.T) {
+	current := []int{250, 500, 1000, 2000, 5000}
+	proposed := []int{500, 1000, 2000, 5000}
+	orders := []int{251, 501, 1000}
+
+	report, err := pack.SimulatePackSizes(context.Background(), current, proposed, orders)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, report.Orders)
+	assert.Equal(t, []pack.OrderChange{
+		{
+			Order:         501,
+			CurrentPacks:  map[int]int{500: 1, 250: 1},
+			ProposedPacks: map[int]int{1000: 1},
+			OverfillDelta: 250,
+			PacksDelta:    -1,
+		},
+	}, report.Changes)
+	assert.Equal(t, 250, report.OverfillDelta)
+	assert.Equal(t, -1, report.PacksDelta)
+	assert.Equal(t, []int{250, 500, 1000, 2000, 5000}, current, "sizes must not be modified")
+}
+
+func TestSimulatePackSizesSkipped(t *testing.T) {
+	report, err := pack.SimulatePackSizes(context.Background(), []int{250, 500}, []int{1000}, []int{251, pack.MaxOrder + 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Orders)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 500, report.OverfillDelta)
+
+	// Without current sizes there is nothing to compare with
+	report, err = pack.SimulatePackSizes(context.Background(), nil, []int{500}, []int{251, 501})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Skipped)
+	assert.Empty(t, report.Changes)
+}
+
+func TestSimulatePackSizesWorkLimit(t *testing.T) {
+	proposed := make([]int, pack.MaxPackSizes)
+	for i := range proposed {
+		proposed[i] = 1000 * (i + 1)
+	}
+
+	_, err := pack.SimulatePackSizes(context.Background(), []int{250}, proposed, []int{251, pack.MaxOrder})
+	var fieldErr *pack.FieldError
+	if assert.ErrorAs(t, err, &fieldErr) {
+		assert.Equal(t, "sizes", fieldErr.Field)
+	}
+
+	_, err = pack.SimulatePackSizes(context.Background(), []int{250}, proposed, []int{251, 100_000})
+	assert.NoError(t, err)
+}
+
+func TestSimulatePackSizesBadInput(t *testing.T) {
+	_, err := pack.SimulatePackSizes(context.Background(), []int{250}, nil, []int{251})
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, pack.ErrInvalidArg)
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	sizes := []int{500, 250, 1000}
+
+	calc, err := pack.Calculate(sizes, 251)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 251, calc.Order)
+	assert.Equal(t, map[int]int{500: 1}, calc.Packs)
+	assert.Equal(t, []int{250, 500, 1000}, calc.Sizes)
+	assert.Equal(t, pack.SolverDP, calc.Solver)
+	assert.False(t, calc.CreatedAt.IsZero())
+	assert.Equal(t, []int{500, 250, 1000}, sizes, "sizes must not be modified")
+}
+
+func TestMetrics(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(pack.Collectors()...)
+
+	// The metrics are shared by all tests, so only the changes count
+	before := gatherHistograms(t, reg)
+
+	_, err := pack.Calculate([]int{500, 250, 1000}, 251)
+	assert.NoError(t, err)
+	_, err = pack.CalculatePacks([]int{500, 250, 1000}, 1000)
+	assert.NoError(t, err)
+
+	after := gatherHistograms(t, reg)
+
+	assert.Equal(t, uint64(2), after["pack_calculation_duration_seconds"].count-before["pack_calculation_duration_seconds"].count)
+	assert.Equal(t, uint64(2), after["pack_dp_table_entries"].count-before["pack_dp_table_entries"].count)
+	assert.Equal(t, float64(502+1251), after["pack_dp_table_entries"].sum-before["pack_dp_table_entries"].sum)
+	assert.Equal(t, uint64(2), after["pack_order_items"].count-before["pack_order_items"].count)
+	assert.Equal(t, float64(251+1000), after["pack_order_items"].sum-before["pack_order_items"].sum)
+}
+
+type histogramTotals struct {
+	count uint64
+	sum   float64
+}
+
+// gatherHistograms returns the totals of the histograms in reg by name, summed over their labels
+func gatherHistograms(t *testing.T, reg prometheus.Gatherer) map[string]histogramTotals {
+	t.Helper()
+
+	families, err := reg.Gather()
+	assert.NoError(t, err)
+
+	totals := map[string]histogramTotals{}
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			if h := m.GetHistogram(); h != nil {
+				total := totals[family.GetName()]
+				total.count += h.GetSampleCount()
+				total.sum += h.GetSampleSum()
+				totals[family.GetName()] = total
+			}
+		}
+	}
+
+	return totals
+}
+
+type sizeRepoStub struct {
+	sets []pack.SizeSet
+}
+
+func (sr *sizeRepoStub) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
+	return sr.GetPackSizesAt(ctx, time.Now())
+}
+
+func (sr *sizeRepoStub) GetPackSizesAt(ctx context.Context, at time.Time) (pack.SizeSet, error) {
+	var effective pack.SizeSet
+	for _, s := range sr.sets {
+		if s.CancelledAt.IsZero() && !s.EffectiveFrom.After(at) && !s.EffectiveFrom.Before(effective.EffectiveFrom) {
+			effective = s
+		}
+	}
+	return effective, nil
+}
+
+func (sr *sizeRepoStub) StorePackSizes(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+	set.Version = len(sr.sets) + 1
+	sr.sets = append(sr.sets, set)
+	return set, nil
+}
+
+func (sr *sizeRepoStub) CompareAndStorePackSizes(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error) {
+	if current, _ := sr.GetPackSizes(ctx); expected != current.Version {
+		return pack.SizeSet{}, pack.ErrConflict
+	}
+	return sr.StorePackSizes(ctx, set)
+}
+
+func (sr *sizeRepoStub) UpdatePackSizes(
+	ctx context.Context,
+	author string,
+	update func(pack.SizeSet) ([]int, error),
+) (pack.SizeSet, error) {
+	current, _ := sr.GetPackSizes(ctx)
+	sizes, err := update(current)
+	if err != nil {
+		return pack.SizeSet{}, err
+	}
+	if slices.Equal(sizes, current.Sizes) {
+		return current, nil
+	}
+	return sr.StorePackSizes(ctx, pack.SizeSet{Sizes: sizes, Author: author})
+}
+
+func (sr *sizeRepoStub) GetNextEffectiveFrom(ctx context.Context, after time.Time) (time.Time, error) {
+	var next time.Time
+	for _, s := range sr.sets {
+		if s.CancelledAt.IsZero() && s.EffectiveFrom.After(after) && (next.IsZero() || s.EffectiveFrom.Before(next)) {
+			next = s.EffectiveFrom
+		}
+	}
+	return next, nil
+}
+
+func (sr *sizeRepoStub) CancelPackSizes(ctx context.Context, version int, author string) (pack.SizeSet, error) {
+	if version <= 0 || version > len(sr.sets) {
+		return pack.SizeSet{}, pack.ErrNotFound
+	}
+	if !sr.sets[version-1].IsScheduled(time.Now()) {
+		return pack.SizeSet{}, pack.ErrConflict
+	}
+	sr.sets[version-1].CancelledAt = time.Now()
+	return sr.sets[version-1], nil
+}
+
+func (sr *sizeRepoStub) ApplyPackSizes(
+	ctx context.Context,
+	plan func([]pack.SizeSet) (pack.SizeSetChanges, error),
+) ([]pack.SizeSet, error) {
+	sets, _ := sr.GetPackSizeSets(ctx)
+	changes, err := plan(slices.Clone(sets))
+	if err != nil {
+		return nil, err
+	}
+
+	prev := slices.Clone(sr.sets)
+	for _, version := range changes.Cancel {
+		if _, err := sr.CancelPackSizes(ctx, version, changes.Author); err != nil {
+			sr.sets = prev
+			return nil, err
+		}
+	}
+
+	var stored []pack.SizeSet
+	for _, set := range changes.Store {
+		set, _ := sr.StorePackSizes(ctx, set)
+		stored = append(stored, set)
+	}
+	return stored, nil
+}
+
+func (sr *sizeRepoStub) GetPackSizeSets(ctx context.Context) ([]pack.SizeSet, error) {
+	return sr.sets, nil
+}
+
+func (sr *sizeRepoStub) GetPackSizeSet(ctx context.Context, version int) (pack.SizeSet, error) {
+	if version <= 0 || version > len(sr.sets) {
+		return pack.SizeSet{}, pack.ErrNotFound
+	}
+	return sr.sets[version-1], nil
+}
+
+func TestPackSizeVersions(t *testing.T) {
+	ctx := context.Background()
+	repo := &sizeRepoStub{}
+
+	_, err := pack.SavePackSizes(ctx, repo, []int{250, 500}, "john")
+	assert.NoError(t, err)
+	_, err = pack.SavePackSizes(ctx, repo, []int{1000}, "jane")
+	assert.NoError(t, err)
+
+	_, err = pack.SavePackSizes(ctx, repo, []int{0}, "jane")
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+	calc, err := pack.CalculatePacksWithRepo(ctx, repo, 251, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calc.Version)
+	assert.Equal(t, map[int]int{1000: 1}, calc.Packs)
+
+	set, err := pack.RollbackPackSizes(ctx, repo, 1, "jane")
+	assert.NoError(t, err)
+	assert.Equal(t, pack.SizeSet{Version: 3, Sizes: []int{250, 500}, Author: "jane", RolledBackFrom: 1}, set)
+
+	calc, err = pack.CalculatePacksWithRepo(ctx, repo, 251, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calc.Version)
+	assert.Equal(t, map[int]int{500: 1}, calc.Packs)
+
+	_, err = pack.RollbackPackSizes(ctx, repo, 10, "jane")
+	assert.ErrorIs(t, err, pack.ErrNotFound)
+
+	_, err = pack.SavePackSizesIfVersion(ctx, repo, []int{250}, "john", 2)
+	assert.ErrorIs(t, err, pack.ErrConflict)
+
+	set, err = pack.SavePackSizesIfVersion(ctx, repo, []int{250}, "john", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, set.Version)
+}
+
+func TestCalculatePacksBatchWithRepo(t *testing.T) {
+	ctx := context.Background()
+	repo := &sizeRepoStub{}
+
+	_, err := pack.SavePackSizes(ctx, repo, []int{250, 500}, "john")
+	assert.NoError(t, err)
+
+	var calcs []pack.Calculation
+	collect := func(calc pack.Calculation) error {
+		calcs = append(calcs, calc)
+		return nil
+	}
+
+	err = pack.CalculatePacksBatchWithRepo(ctx, repo, []int{251, 1, 750}, time.Time{}, collect)
+	assert.NoError(t, err)
+	require.Len(t, calcs, 3)
+	assert.Equal(t, map[int]int{500: 1}, calcs[0].Packs)
+	assert.Equal(t, map[int]int{250: 1}, calcs[1].Packs)
+	assert.Equal(t, map[int]int{250: 1, 500: 1}, calcs[2].Packs)
+	for _, calc := range calcs {
+		assert.Equal(t, 1, calc.Version)
+	}
+
+	calcs = nil
+	err = pack.CalculatePacksBatchWithRepo(ctx, repo, []int{251, 0, 750}, time.Time{}, collect)
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+	assert.Empty(t, calcs, "nothing is calculated if any order is invalid")
+
+	err = pack.CalculatePacksBatchWithRepo(ctx, repo, []int{251, pack.MaxOrder + 1}, time.Time{}, collect)
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+	assert.Empty(t, calcs)
+
+	stop := errors.New("stop")
+	err = pack.CalculatePacksBatchWithRepo(ctx, repo, []int{251, 750}, time.Time{}, func(pack.Calculation) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+}
+
+func TestSchedulePackSizes(t *testing.T) {
+	ctx := context.Background()
+	repo := &sizeRepoStub{}
+	now := time.Now()
+
+	_, err := pack.SavePackSizes(ctx, repo, []int{250, 500}, "john")
+	assert.NoError(t, err)
+
+	_, err = pack.SchedulePackSizes(ctx, repo, []int{500}, "jane", now.Add(-time.Hour))
+	assert.ErrorIs(t, err, pack.ErrInvalidArg, "effective from must be in the future")
+	_, err = pack.SchedulePackSizes(ctx, repo, []int{0}, "jane", now.Add(time.Hour))
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+	later, err := pack.SchedulePackSizes(ctx, repo, []int{1000}, "jane", now.Add(48*time.Hour))
+	assert.NoError(t, err)
+	sooner, err := pack.SchedulePackSizes(ctx, repo, []int{500}, "jane", now.Add(24*time.Hour))
+	assert.NoError(t, err)
+
+	scheduled, err := pack.ScheduledPackSizes(ctx, repo)
+	assert.NoError(t, err)
+	assert.Equal(t, []pack.SizeSet{sooner, later}, scheduled)
+
+	calc, err := pack.CalculatePacksWithRepo(ctx, repo, 251, time.Time{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, calc.Version)
+	assert.Equal(t, map[int]int{500: 1}, calc.Packs)
+
+	calc, err = pack.CalculatePacksWithRepo(ctx, repo, 251, now.Add(36*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, sooner.Version, calc.Version)
+	assert.Equal(t, map[int]int{500: 1}, calc.Packs)
+
+	calc, err = pack.CalculatePacksWithRepo(ctx, repo, 251, now.Add(72*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, later.Version, calc.Version)
+	assert.Equal(t, map[int]int{1000: 1}, calc.Packs)
+
+	_, err = repo.CancelPackSizes(ctx, later.Version, "john")
+	assert.NoError(t, err)
+
+	scheduled, err = pack.ScheduledPackSizes(ctx, repo)
+	assert.NoError(t, err)
+	assert.Equal(t, []pack.SizeSet{sooner}, scheduled)
+}
+
+func TestAddRemovePackSize(t *testing.T) {
+	ctx := context.Background()
+	repo := &sizeRepoStub{}
+
+	set, err := pack.AddPackSize(ctx, repo, 500, "john")
+	assert.NoError(t, err)
+	assert.Equal(t, pack.SizeSet{Version: 1, Sizes: []int{500}, Author: "john"}, set)
+
+	set, err = pack.AddPackSize(ctx, repo, 250, "jane")
+	assert.NoError(t, err)
+	assert.Equal(t, pack.SizeSet{Version: 2, Sizes: []int{250, 500}, Author: "jane"}, set)
+
+	set, err = pack.AddPackSize(ctx, repo, 250, "jane")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, set.Version, "adding an existing size changes nothing")
+
+	_, err = pack.AddPackSize(ctx, repo, 0, "jane")
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+	_, err = pack.RemovePackSize(ctx, repo, 1000, "jane")
+	assert.ErrorIs(t, err, pack.ErrNotFound)
+
+	set, err = pack.RemovePackSize(ctx, repo, 250, "john")
+	assert.NoError(t, err)
+	assert.Equal(t, pack.SizeSet{Version: 3, Sizes: []int{500}, Author: "john"}, set)
+
+	_, err = pack.UpdatePackSizes(ctx, repo, "john", func(pack.SizeSet) ([]int, error) {
+		return []int{500, 500}, nil
+	})
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+	assert.Len(t, repo.sets, 3)
+}
+
+func TestExportImportConfig(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	source := &sizeRepoStub{}
+	_, err := pack.SavePackSizes(ctx, source, []int{250, 500}, "john")
+	assert.NoError(t, err)
+	_, err = pack.SchedulePackSizes(ctx, source, []int{1000}, "john", now.Add(24*time.Hour))
+	assert.NoError(t, err)
+	cancelled, err := pack.SchedulePackSizes(ctx, source, []int{500}, "john", now.Add(48*time.Hour))
+	assert.NoError(t, err)
+	_, err = source.CancelPackSizes(ctx, cancelled.Version, "john")
+	assert.NoError(t, err)
+	_, err = pack.SchedulePackSizes(ctx, source, []int{2000}, "john", now.Add(72*time.Hour))
+	assert.NoError(t, err)
+
+	target := &sizeRepoStub{}
+	_, err = pack.SavePackSizes(ctx, target, []int{100}, "jane")
+	assert.NoError(t, err)
+	_, err = pack.SchedulePackSizes(ctx, target, []int{1000}, "jane", now.Add(24*time.Hour))
+	assert.NoError(t, err)
+	obsolete, err := pack.SchedulePackSizes(ctx, target, []int{200}, "jane", now.Add(12*time.Hour))
+	assert.NoError(t, err)
+
+	doc, err := pack.ExportConfig(ctx, source)
+	assert.NoError(t, err)
+	assert.Equal(t, pack.ExportFormatVersion, doc.FormatVersion)
+	assert.Len(t, doc.SizeSets, 4)
+
+	diff, err := pack.ImportConfig(ctx, target, doc, "admin", true)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{100}, diff.OldSizes)
+	assert.Equal(t, []int{250, 500}, diff.NewSizes)
+	assert.Equal(t, []pack.SizeSet{{Sizes: []int{2000}, Author: "admin", EffectiveFrom: now.Add(72 * time.Hour)}}, diff.Scheduled)
+	assert.Equal(t, []pack.SizeSet{obsolete}, diff.Cancelled)
+	assert.Empty(t, diff.Stored)
+	assert.Len(t, target.sets, 3, "dry run changes nothing")
+
+	diff, err = pack.ImportConfig(ctx, target, doc, "admin", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{250, 500}, diff.NewSizes)
+	assert.Len(t, diff.Stored, 2)
+
+	set, err := target.GetPackSizes(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{250, 500}, set.Sizes)
+
+	scheduled, err := pack.ScheduledPackSizes(ctx, target)
+	assert.NoError(t, err)
+	if assert.Len(t, scheduled, 2) {
+		assert.Equal(t, []int{1000}, scheduled[0].Sizes)
+		assert.Equal(t, []int{2000}, scheduled[1].Sizes)
+	}
+
+	diff, err = pack.ImportConfig(ctx, target, doc, "admin", true)
+	assert.NoError(t, err)
+	assert.True(t, diff.IsEmpty(), "importing the same configuration again changes nothing")
+
+	_, err = pack.ImportConfig(ctx, target, pack.Export{FormatVersion: 2}, "admin", true)
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+	doc.SizeSets[0].Sizes = []int{0}
+	_, err = pack.ImportConfig(ctx, target, doc, "admin", false)
+	assert.ErrorIs(t, err, pack.ErrInvalidArg)
+	assert.Len(t, target.sets, 5)
+}
+
+func TestRoleAllows(t *testing.T) {
+	assert.True(t, pack.RoleReader.Allows(pack.RoleReader))
+	assert.False(t, pack.RoleReader.Allows(pack.RoleCalculator))
+	assert.True(t, pack.RoleCalculator.Allows(pack.RoleReader))
+	assert.False(t, pack.RoleCalculator.Allows(pack.RoleAdmin))
+	assert.True(t, pack.RoleAdmin.Allows(pack.RoleCalculator))
+	assert.False(t, pack.Role("root").Allows(pack.RoleReader))
+}
+
+type apiKeyRepoStub struct {
+	keys []pack.APIKey
+}
+
+func (kr *apiKeyRepoStub) StoreAPIKey(ctx context.Context, key pack.APIKey) (pack.APIKey, error) {
+	key.ID = len(kr.keys) + 1
+	key.CreatedAt = time.Now()
+	kr.keys = append(kr.keys, key)
+	return key, nil
+}
+
+func (kr *apiKeyRepoStub) GetAPIKey(ctx context.Context, hash string) (pack.APIKey, error) {
+	i := slices.IndexFunc(kr.keys, func(k pack.APIKey) bool { return k.Hash == hash })
+	if i < 0 {
+		return pack.APIKey{}, pack.ErrNotFound
+	}
+	return kr.keys[i], nil
+}
+
+func (kr *apiKeyRepoStub) GetAPIKeys(ctx context.Context) ([]pack.APIKey, error) {
+	return kr.keys, nil
+}
+
+func (kr *apiKeyRepoStub) RevokeAPIKey(ctx context.Context, id int) (pack.APIKey, error) {
+	kr.keys[id-1].RevokedAt = time.Now()
+	return kr.keys[id-1], nil
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := &apiKeyRepoStub{}
+
+	key, token, err := pack.CreateAPIKey(ctx, repo, "jane", pack.RoleAdmin)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, key.ID)
+	assert.Equal(t, "jane", key.Name)
+	assert.Equal(t, pack.RoleAdmin, key.Role)
+	assert.Equal(t, pack.HashAPIKey(token), key.Hash)
+	assert.NotContains(t, key.Hash, token, "the key itself isn't stored")
+
+	_, other, err := pack.CreateAPIKey(ctx, repo, "john", pack.RoleReader)
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+
+	authenticated, err := pack.Authenticate(ctx, repo, token)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, authenticated.ID)
+
+	_, err = pack.Authenticate(ctx, repo, token+"x")
+	assert.ErrorIs(t, err, pack.ErrInvalidKey)
+
+	_, err = repo.RevokeAPIKey(ctx, key.ID)
+	assert.NoError(t, err)
+	_, err = pack.Authenticate(ctx, repo, token)
+	assert.ErrorIs(t, err, pack.ErrInvalidKey)
+}
+
+func TestCreateAPIKeyBadInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyName string
+		role    pack.Role
+		field   string
+	}{
+		{"No name", " ", pack.RoleReader, "name"},
+		{"Unknown role", "jane", "root", "role"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &apiKeyRepoStub{}
+
+			_, _, err := pack.CreateAPIKey(context.Background(), repo, tt.keyName, tt.role)
+			assert.ErrorIs(t, err, pack.ErrInvalidArg)
+
+			var fieldErr *pack.FieldError
+			if assert.ErrorAs(t, err, &fieldErr) {
+				assert.Equal(t, tt.field, fieldErr.Field)
 			}
+			assert.Empty(t, repo.keys)
 		})
 	}
 }
@@ -0,0 +1,193 @@
+package pack
+
+import (
+	"context"
+	"maps"
+	"slices"
+)
+
+// Recommendation is a proposed set of pack sizes together with its score against an order histogram.
+type Recommendation struct {
+	Sizes       []int
+	AvgOverfill float64
+	AvgPacks    float64
+}
+
+// setScore holds the totals of packing every order of a histogram with a given set of sizes.
+// Totals are compared instead of averages to avoid floating point comparisons.
+type setScore struct {
+	overfill int
+	packs    int
+}
+
+// isBetterScore determines if score A is better than score B following the same rules as the calculation:
+// fewer items and then fewer packs
+func isBetterScore(a, b setScore) bool {
+	if a.overfill != b.overfill {
+		return a.overfill < b.overfill
+	}
+	return a.packs < b.packs
+}
+
+// MaxRecommendationWork bounds the steps of the tables filled to score candidate sets by RecommendPackSizes(),
+// which take about a second. Every candidate set fills a table up to the largest order, a step per entry and size.
+const MaxRecommendationWork = 500_000_000
+
+// RecommendPackSizes proposes a set of at most maxSizes pack sizes that minimises the average overfill
+// and then the average number of packs for the orders in histogram, scoring every candidate set with CalculatePacks().
+// It respects the context passed as the first parameter.
+//
+// Parameters:
+//   - histogram: A map where the keys are historical order amounts and the values are how many times they occurred.
+//   - maxSizes: The maximum number of pack sizes in the proposed set.
+//
+// Candidate sizes are the order amounts from the histogram. The set is built greedily by adding the candidate
+// that improves the score the most and then refined by swapping single sizes while the score keeps improving.
+// Histograms whose greedy phase alone would take more than MaxRecommendationWork steps are rejected,
+// and the refinement stops early once the steps run out.
+func RecommendPackSizes(ctx context.Context, histogram map[int]int, maxSizes int) (Recommendation, error) {
+	if maxSizes <= 0 {
+		return Recommendation{}, invalidField("max_sizes", "max sizes is not positive")
+	}
+	if maxSizes > MaxPackSizes {
+		return Recommendation{}, invalidField("max_sizes", "max sizes is more than %d: %d", MaxPackSizes, maxSizes)
+	}
+	if len(histogram) == 0 {
+		return Recommendation{}, invalidField("histogram", "histogram is empty")
+	}
+
+	totalOrders := 0
+	for order, count := range histogram {
+		if order <= 0 {
+			return Recommendation{}, invalidField("histogram", "order amount is not positive: %d", order)
+		}
+		// Order amounts are the candidate sizes
+		if order > MaxPackSize {
+			return Recommendation{}, invalidField("histogram", "order amount is more than %d: %d", MaxPackSize, order)
+		}
+		if count <= 0 {
+			return Recommendation{}, invalidField("histogram", "order count is not positive: %d", count)
+		}
+		totalOrders += count
+	}
+
+	candidates := slices.Sorted(maps.Keys(histogram))
+	largestOrder := candidates[len(candidates)-1]
+
+	// Adding the k-th size scores the remaining candidates with sets of k sizes
+	greedyWork := 0
+	for k := 1; k <= min(maxSizes, len(candidates)); k++ {
+		greedyWork += (len(candidates) - k + 1) * k * tableLen(largestOrder, largestOrder)
+	}
+	if greedyWork > MaxRecommendationWork {
+		return Recommendation{}, invalidField("histogram",
+			"scoring the candidate sets takes too long, reduce max sizes or leave out the largest orders")
+	}
+	work := 0
+
+	var best []int
+	var bestScore setScore
+
+	// Greedy forward selection: add the candidate that improves the score the most
+	for len(best) < maxSizes && len(best) < len(candidates) {
+		var stepSet []int
+		var stepScore setScore
+
+		for _, c := range candidates {
+			if slices.Contains(best, c) {
+				continue
+			}
+
+			set := append(slices.Clone(best), c)
+			work += scoreWork(set, largestOrder)
+			score, err := scoreSizes(ctx, set, histogram, largestOrder)
+			if err != nil {
+				return Recommendation{}, err
+			}
+
+			if stepSet == nil || isBetterScore(score, stepScore) {
+				stepSet, stepScore = set, score
+			}
+		}
+
+		if best != nil && !isBetterScore(stepScore, bestScore) {
+			break
+		}
+		best, bestScore = stepSet, stepScore
+	}
+
+	// Local search: replace single sizes while it improves the score and there are steps left
+search:
+	for improved := true; improved; {
+		improved = false
+
+		for i := range best {
+			for _, c := range candidates {
+				if slices.Contains(best, c) {
+					continue
+				}
+
+				set := slices.Clone(best)
+				set[i] = c
+				if work += scoreWork(set, largestOrder); work > MaxRecommendationWork {
+					break search
+				}
+				score, err := scoreSizes(ctx, set, histogram, largestOrder)
+				if err != nil {
+					return Recommendation{}, err
+				}
+
+				if isBetterScore(score, bestScore) {
+					best, bestScore = set, score
+					improved = true
+				}
+			}
+		}
+	}
+
+	slices.Sort(best)
+
+	return Recommendation{
+		Sizes:       best,
+		AvgOverfill: float64(bestScore.overfill) / float64(totalOrders),
+		AvgPacks:    float64(bestScore.packs) / float64(totalOrders),
+	}, nil
+}
+
+// scoreSizes packs every order of the histogram with sizes and sums up overfill and packs weighted by order count.
+// A single table up to the largest order gives the same packs as CalculatePacks() does for every order.
+func scoreSizes(ctx context.Context, sizes []int, histogram map[int]int, largestOrder int) (setScore, error) {
+	if err := ctx.Err(); err != nil {
+		return setScore{}, err
+	}
+
+	table := newOrdersTable(sizes, largestOrder)
+
+	var score setScore
+	for order, count := range histogram {
+		items, _ := table.fewestItems(order)
+
+		score.overfill += (items - order) * count
+		score.packs += int(table.count[items]) * count
+	}
+
+	return score, nil
+}
+
+// newOrdersTable fills a packTable with sizes in any order that packs every order up to largestOrder
+func newOrdersTable(sizes []int, largestOrder int) packTable {
+	sizes = slices.Sorted(slices.Values(sizes))
+	slices.Reverse(sizes)
+
+	return newPackTable(sizes, tableLen(largestOrder, sizes[len(sizes)-1])-1)
+}
+
+// scoreWork is the number of steps scoreSizes() takes for sizes
+func scoreWork(sizes []int, largestOrder int) int {
+	return tableLen(largestOrder, slices.Min(sizes)) * len(sizes)
+}
+
+// tableLen is the length of the table that packs orders up to largestOrder with the smallest size
+func tableLen(largestOrder, smallestSize int) int {
+	return largestOrder + smallestSize + 1
+}
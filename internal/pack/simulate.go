@@ -0,0 +1,126 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// OrderChange describes how packing of a single order changes between two sets of pack sizes
+type OrderChange struct {
+	Order         int
+	CurrentPacks  map[int]int
+	ProposedPacks map[int]int
+	OverfillDelta int
+	PacksDelta    int
+}
+
+// SimulationReport summarises the difference of packing a list of orders with the proposed pack sizes
+// instead of the current ones. Deltas are proposed minus current, so negative values are improvements.
+// Skipped counts the orders that couldn't be packed with the current sizes and aren't compared.
+type SimulationReport struct {
+	Orders        int
+	Skipped       int
+	Changes       []OrderChange
+	OverfillDelta int
+	PacksDelta    int
+}
+
+// MaxSimulationWork bounds the steps of the tables filled by SimulatePackSizes(), which take about a fifth
+// of a second. Both sets of sizes fill a table up to the largest order, a step per entry and size.
+const MaxSimulationWork = 100_000_000
+
+// SimulatePackSizesWithRepo replays the orders of past calculations from calcRepo against the pack sizes
+// from sizeRepo and the proposed ones, using the same logic as the SimulatePackSizes().
+// It respects the context passed as the first parameter.
+func SimulatePackSizesWithRepo(
+	ctx context.Context,
+	sizeRepo PackSizeRepo,
+	calcRepo CalculationRepo,
+	proposed []int,
+	filter CalculationFilter,
+) (SimulationReport, error) {
+	current, err := sizeRepo.GetPackSizes(ctx)
+	if err != nil {
+		return SimulationReport{}, fmt.Errorf("couldn't get pack sizes: %w", err)
+	}
+
+	calcs, err := calcRepo.GetCalculations(ctx, filter)
+	if err != nil {
+		return SimulationReport{}, fmt.Errorf("couldn't get calculations: %w", err)
+	}
+
+	orders := make([]int, 0, len(calcs))
+	for _, c := range calcs {
+		orders = append(orders, c.Order)
+	}
+
+	return SimulatePackSizes(ctx, current.Sizes, proposed, orders)
+}
+
+// SimulatePackSizes packs every order with both current and proposed pack sizes the same way as CalculatePacks().
+// It returns a report listing the orders whose packing changed along with the total overfill and pack count deltas.
+// Orders that aren't positive or are more than MaxOrder, and all orders if there are no current sizes,
+// are skipped. Orders whose tables would take more than MaxSimulationWork steps are rejected.
+func SimulatePackSizes(ctx context.Context, current, proposed []int, orders []int) (SimulationReport, error) {
+	if len(proposed) == 0 {
+		return SimulationReport{}, invalidField("sizes", "no proposed pack sizes provided")
+	}
+	if err := validateSizes(proposed); err != nil {
+		return SimulationReport{}, err
+	}
+
+	report := SimulationReport{Orders: len(orders)}
+
+	replayed := make([]int, 0, len(orders))
+	for _, order := range orders {
+		if order <= 0 || order > MaxOrder || len(current) == 0 {
+			report.Skipped++
+			continue
+		}
+		replayed = append(replayed, order)
+	}
+	if len(replayed) == 0 {
+		return report, nil
+	}
+
+	largestOrder := slices.Max(replayed)
+	if scoreWork(current, largestOrder)+scoreWork(proposed, largestOrder) > MaxSimulationWork {
+		return SimulationReport{}, invalidField("sizes",
+			"replaying the orders takes too long, propose fewer or larger sizes or replay fewer orders")
+	}
+
+	// A single table up to the largest order gives the same packs as CalculatePacks() does for every order
+	currentTable := newOrdersTable(current, largestOrder)
+	proposedTable := newOrdersTable(proposed, largestOrder)
+
+	for _, order := range replayed {
+		if err := ctx.Err(); err != nil {
+			return SimulationReport{}, err
+		}
+
+		currentItems, _ := currentTable.fewestItems(order)
+		proposedItems, _ := proposedTable.fewestItems(order)
+
+		overfillDelta := proposedItems - currentItems
+		packsDelta := int(proposedTable.count[proposedItems]) - int(currentTable.count[currentItems])
+
+		report.OverfillDelta += overfillDelta
+		report.PacksDelta += packsDelta
+
+		currentPacks := currentTable.packs(currentItems)
+		proposedPacks := proposedTable.packs(proposedItems)
+		if !maps.Equal(currentPacks, proposedPacks) {
+			report.Changes = append(report.Changes, OrderChange{
+				Order:         order,
+				CurrentPacks:  currentPacks,
+				ProposedPacks: proposedPacks,
+				OverfillDelta: overfillDelta,
+				PacksDelta:    packsDelta,
+			})
+		}
+	}
+
+	return report, nil
+}
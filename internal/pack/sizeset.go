@@ -0,0 +1,179 @@
+package pack
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SizeSet is an immutable version of pack sizes. Every save creates a new version
+// and the latest version effective at the time of a calculation is the one used for it.
+type SizeSet struct {
+	Version        int
+	Sizes          []int
+	Author         string
+	CreatedAt      time.Time
+	RolledBackFrom int       // version the sizes were copied from by a rollback, 0 otherwise
+	EffectiveFrom  time.Time // when the sizes take effect, later than CreatedAt for scheduled versions
+	CancelledAt    time.Time // when a scheduled version was cancelled before taking effect, zero otherwise
+}
+
+// SizeSetChanges are applied to the versions of pack sizes together
+type SizeSetChanges struct {
+	Cancel []int     // scheduled versions to cancel
+	Store  []SizeSet // new versions to store
+	Author string    // who cancels the Cancel versions, recorded in the audit log
+}
+
+// IsEmpty determines if there is nothing to change
+func (c SizeSetChanges) IsEmpty() bool {
+	return len(c.Cancel) == 0 && len(c.Store) == 0
+}
+
+// IsScheduled determines if the version takes effect after now and wasn't cancelled
+func (s SizeSet) IsScheduled(now time.Time) bool {
+	return s.CancelledAt.IsZero() && s.EffectiveFrom.After(now)
+}
+
+// RollbackPackSizes makes the sizes of a previous version current again by saving them as a new version,
+// so the history stays append-only. It returns the created version.
+func RollbackPackSizes(ctx context.Context, repo PackSizeRepo, version int, author string) (SizeSet, error) {
+	prev, err := repo.GetPackSizeSet(ctx, version)
+	if err != nil {
+		return SizeSet{}, fmt.Errorf("couldn't get pack sizes version %d: %w", version, err)
+	}
+
+	return repo.StorePackSizes(ctx, SizeSet{
+		Sizes:          prev.Sizes,
+		Author:         author,
+		RolledBackFrom: prev.Version,
+	})
+}
+
+// SchedulePackSizes saves a new version of pack sizes on behalf of author that takes effect at effectiveFrom
+// and returns it. It ensures that the pack sizes are valid, see validateSizes(), and effectiveFrom is in the future.
+func SchedulePackSizes(
+	ctx context.Context,
+	repo PackSizeRepo,
+	sizes []int,
+	author string,
+	effectiveFrom time.Time,
+) (SizeSet, error) {
+	if !effectiveFrom.After(time.Now()) {
+		return SizeSet{}, invalidField("effective_from", "effective from is not in the future: %s", effectiveFrom)
+	}
+	if err := validateSizes(sizes); err != nil {
+		return SizeSet{}, err
+	}
+
+	return repo.StorePackSizes(ctx, SizeSet{Sizes: sizes, Author: author, EffectiveFrom: effectiveFrom})
+}
+
+// ScheduledPackSizes returns the versions of pack sizes that are still to take effect, the soonest first
+func ScheduledPackSizes(ctx context.Context, repo PackSizeRepo) ([]SizeSet, error) {
+	sets, err := repo.GetPackSizeSets(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get pack sizes versions: %w", err)
+	}
+
+	return scheduledSizeSets(sets, time.Now()), nil
+}
+
+// UpdatePackSizes atomically replaces the current pack sizes with the ones returned by update on behalf of author
+// and returns the resulting version. It ensures that the new pack sizes are unique positive integers.
+func UpdatePackSizes(ctx context.Context, repo PackSizeRepo, author string, update func(SizeSet) ([]int, error)) (SizeSet, error) {
+	return repo.UpdatePackSizes(ctx, author, func(current SizeSet) ([]int, error) {
+		sizes, err := update(current)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := validateSizes(sizes); err != nil {
+			return nil, err
+		}
+
+		return slices.Sorted(slices.Values(sizes)), nil
+	})
+}
+
+// AddPackSize adds a single size to the current pack sizes on behalf of author and returns the resulting version.
+// Adding a size that is already there changes nothing.
+func AddPackSize(ctx context.Context, repo PackSizeRepo, size int, author string) (SizeSet, error) {
+	return UpdatePackSizes(ctx, repo, author, func(current SizeSet) ([]int, error) {
+		if slices.Contains(current.Sizes, size) {
+			return current.Sizes, nil
+		}
+		return append(slices.Clone(current.Sizes), size), nil
+	})
+}
+
+// RemovePackSize removes a single size from the current pack sizes on behalf of author
+// and returns the resulting version. It returns ErrNotFound if the size isn't there.
+func RemovePackSize(ctx context.Context, repo PackSizeRepo, size int, author string) (SizeSet, error) {
+	return UpdatePackSizes(ctx, repo, author, func(current SizeSet) ([]int, error) {
+		i := slices.Index(current.Sizes, size)
+		if i < 0 {
+			return nil, fmt.Errorf("pack size %d: %w", size, ErrNotFound)
+		}
+		return slices.Delete(slices.Clone(current.Sizes), i, i+1), nil
+	})
+}
+
+// effectiveSizeSet finds the version effective at the given time among sets
+// or returns an empty SizeSet, following the rules of PackSizeRepo.GetPackSizesAt
+func effectiveSizeSet(sets []SizeSet, at time.Time) SizeSet {
+	var effective SizeSet
+	for _, s := range sets {
+		if !s.CancelledAt.IsZero() || s.EffectiveFrom.After(at) {
+			continue
+		}
+		if effective.Version == 0 || s.EffectiveFrom.After(effective.EffectiveFrom) ||
+			s.EffectiveFrom.Equal(effective.EffectiveFrom) && s.Version > effective.Version {
+			effective = s
+		}
+	}
+
+	return effective
+}
+
+// scheduledSizeSets returns the versions among sets that are still to take effect, the soonest first
+func scheduledSizeSets(sets []SizeSet, now time.Time) []SizeSet {
+	scheduled := make([]SizeSet, 0)
+	for _, s := range sets {
+		if s.IsScheduled(now) {
+			scheduled = append(scheduled, s)
+		}
+	}
+
+	slices.SortFunc(scheduled, func(a, b SizeSet) int {
+		if c := a.EffectiveFrom.Compare(b.EffectiveFrom); c != 0 {
+			return c
+		}
+		return a.Version - b.Version
+	})
+
+	return scheduled
+}
+
+// validateSizes ensures that there are at most MaxPackSizes sizes and they are unique integers from 1 to MaxPackSize
+func validateSizes(sizes []int) error {
+	if len(sizes) > MaxPackSizes {
+		return invalidField("sizes", "more than %d pack sizes: %d", MaxPackSizes, len(sizes))
+	}
+
+	sorted := slices.Sorted(slices.Values(sizes))
+	for i, s := range sorted {
+		if s <= 0 {
+			return invalidField("sizes", "size amount is not positive: %d", s)
+		}
+		if s > MaxPackSize {
+			return invalidField("sizes", "size amount is more than %d: %d", MaxPackSize, s)
+		}
+		if i > 0 && sorted[i-1] == s {
+			return invalidField("sizes", "duplicate size: %d", s)
+		}
+	}
+
+	return nil
+}
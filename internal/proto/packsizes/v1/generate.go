@@ -0,0 +1,4 @@
+// Package packsizesv1 is the gRPC API of the pack sizes, generated from packsizes.proto
+package packsizesv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative packsizes.proto
@@ -0,0 +1,515 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: packsizes.proto
+
+package packsizesv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CalculatePacksRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// order is the number of items ordered, from 1 to 1000000
+	Order int64 `protobuf:"varint,1,opt,name=order,proto3" json:"order,omitempty"`
+	// as_of selects the pack sizes effective at that time, the current ones are used if it's not set
+	AsOf          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=as_of,json=asOf,proto3" json:"as_of,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculatePacksRequest) Reset() {
+	*x = CalculatePacksRequest{}
+	mi := &file_packsizes_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculatePacksRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculatePacksRequest) ProtoMessage() {}
+
+func (x *CalculatePacksRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculatePacksRequest.ProtoReflect.Descriptor instead.
+func (*CalculatePacksRequest) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CalculatePacksRequest) GetOrder() int64 {
+	if x != nil {
+		return x.Order
+	}
+	return 0
+}
+
+func (x *CalculatePacksRequest) GetAsOf() *timestamppb.Timestamp {
+	if x != nil {
+		return x.AsOf
+	}
+	return nil
+}
+
+type CalculatePacksResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Order int64                  `protobuf:"varint,1,opt,name=order,proto3" json:"order,omitempty"`
+	// packs are the number of packs to ship by pack size
+	Packs map[int64]int64 `protobuf:"bytes,2,rep,name=packs,proto3" json:"packs,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	// sizes are the pack sizes the packs were calculated with, in ascending order
+	Sizes []int64 `protobuf:"varint,3,rep,packed,name=sizes,proto3" json:"sizes,omitempty"`
+	// version is the version of the pack sizes
+	Version       int64 `protobuf:"varint,4,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculatePacksResponse) Reset() {
+	*x = CalculatePacksResponse{}
+	mi := &file_packsizes_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculatePacksResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculatePacksResponse) ProtoMessage() {}
+
+func (x *CalculatePacksResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculatePacksResponse.ProtoReflect.Descriptor instead.
+func (*CalculatePacksResponse) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CalculatePacksResponse) GetOrder() int64 {
+	if x != nil {
+		return x.Order
+	}
+	return 0
+}
+
+func (x *CalculatePacksResponse) GetPacks() map[int64]int64 {
+	if x != nil {
+		return x.Packs
+	}
+	return nil
+}
+
+func (x *CalculatePacksResponse) GetSizes() []int64 {
+	if x != nil {
+		return x.Sizes
+	}
+	return nil
+}
+
+func (x *CalculatePacksResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type CalculatePacksBatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// orders are calculated in the given order, 1000 at most, each from 1 to 1000000
+	Orders []int64 `protobuf:"varint,1,rep,packed,name=orders,proto3" json:"orders,omitempty"`
+	// as_of selects the pack sizes effective at that time, the current ones are used if it's not set
+	AsOf          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=as_of,json=asOf,proto3" json:"as_of,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CalculatePacksBatchRequest) Reset() {
+	*x = CalculatePacksBatchRequest{}
+	mi := &file_packsizes_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CalculatePacksBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CalculatePacksBatchRequest) ProtoMessage() {}
+
+func (x *CalculatePacksBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CalculatePacksBatchRequest.ProtoReflect.Descriptor instead.
+func (*CalculatePacksBatchRequest) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CalculatePacksBatchRequest) GetOrders() []int64 {
+	if x != nil {
+		return x.Orders
+	}
+	return nil
+}
+
+func (x *CalculatePacksBatchRequest) GetAsOf() *timestamppb.Timestamp {
+	if x != nil {
+		return x.AsOf
+	}
+	return nil
+}
+
+type GetSizesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSizesRequest) Reset() {
+	*x = GetSizesRequest{}
+	mi := &file_packsizes_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSizesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSizesRequest) ProtoMessage() {}
+
+func (x *GetSizesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSizesRequest.ProtoReflect.Descriptor instead.
+func (*GetSizesRequest) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{3}
+}
+
+type GetSizesResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// sizes are empty if none were stored yet
+	Sizes         []int64 `protobuf:"varint,1,rep,packed,name=sizes,proto3" json:"sizes,omitempty"`
+	Version       int64   `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetSizesResponse) Reset() {
+	*x = GetSizesResponse{}
+	mi := &file_packsizes_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetSizesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetSizesResponse) ProtoMessage() {}
+
+func (x *GetSizesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetSizesResponse.ProtoReflect.Descriptor instead.
+func (*GetSizesResponse) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *GetSizesResponse) GetSizes() []int64 {
+	if x != nil {
+		return x.Sizes
+	}
+	return nil
+}
+
+func (x *GetSizesResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+type StoreSizesRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Sizes []int64                `protobuf:"varint,1,rep,packed,name=sizes,proto3" json:"sizes,omitempty"`
+	// expected_version is the version the change is based on, 0 if nothing was stored yet.
+	// The change fails with ABORTED if it isn't the current version anymore, like If-Match of the HTTP API.
+	ExpectedVersion *int64 `protobuf:"varint,2,opt,name=expected_version,json=expectedVersion,proto3,oneof" json:"expected_version,omitempty"`
+	// any_version stores the sizes whatever the current version is, like If-Match: * of the HTTP API.
+	// Either expected_version or any_version is required.
+	AnyVersion    bool `protobuf:"varint,3,opt,name=any_version,json=anyVersion,proto3" json:"any_version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StoreSizesRequest) Reset() {
+	*x = StoreSizesRequest{}
+	mi := &file_packsizes_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StoreSizesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreSizesRequest) ProtoMessage() {}
+
+func (x *StoreSizesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoreSizesRequest.ProtoReflect.Descriptor instead.
+func (*StoreSizesRequest) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *StoreSizesRequest) GetSizes() []int64 {
+	if x != nil {
+		return x.Sizes
+	}
+	return nil
+}
+
+func (x *StoreSizesRequest) GetExpectedVersion() int64 {
+	if x != nil && x.ExpectedVersion != nil {
+		return *x.ExpectedVersion
+	}
+	return 0
+}
+
+func (x *StoreSizesRequest) GetAnyVersion() bool {
+	if x != nil {
+		return x.AnyVersion
+	}
+	return false
+}
+
+type StoreSizesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Sizes         []int64                `protobuf:"varint,1,rep,packed,name=sizes,proto3" json:"sizes,omitempty"`
+	Version       int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StoreSizesResponse) Reset() {
+	*x = StoreSizesResponse{}
+	mi := &file_packsizes_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StoreSizesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreSizesResponse) ProtoMessage() {}
+
+func (x *StoreSizesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_packsizes_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoreSizesResponse.ProtoReflect.Descriptor instead.
+func (*StoreSizesResponse) Descriptor() ([]byte, []int) {
+	return file_packsizes_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StoreSizesResponse) GetSizes() []int64 {
+	if x != nil {
+		return x.Sizes
+	}
+	return nil
+}
+
+func (x *StoreSizesResponse) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+var File_packsizes_proto protoreflect.FileDescriptor
+
+const file_packsizes_proto_rawDesc = "" +
+	"\n" +
+	"\x0fpacksizes.proto\x12\fpacksizes.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"^\n" +
+	"\x15CalculatePacksRequest\x12\x14\n" +
+	"\x05order\x18\x01 \x01(\x03R\x05order\x12/\n" +
+	"\x05as_of\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04asOf\"\xdf\x01\n" +
+	"\x16CalculatePacksResponse\x12\x14\n" +
+	"\x05order\x18\x01 \x01(\x03R\x05order\x12E\n" +
+	"\x05packs\x18\x02 \x03(\v2/.packsizes.v1.CalculatePacksResponse.PacksEntryR\x05packs\x12\x14\n" +
+	"\x05sizes\x18\x03 \x03(\x03R\x05sizes\x12\x18\n" +
+	"\aversion\x18\x04 \x01(\x03R\aversion\x1a8\n" +
+	"\n" +
+	"PacksEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x03R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"e\n" +
+	"\x1aCalculatePacksBatchRequest\x12\x16\n" +
+	"\x06orders\x18\x01 \x03(\x03R\x06orders\x12/\n" +
+	"\x05as_of\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04asOf\"\x11\n" +
+	"\x0fGetSizesRequest\"B\n" +
+	"\x10GetSizesResponse\x12\x14\n" +
+	"\x05sizes\x18\x01 \x03(\x03R\x05sizes\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\"\x8f\x01\n" +
+	"\x11StoreSizesRequest\x12\x14\n" +
+	"\x05sizes\x18\x01 \x03(\x03R\x05sizes\x12.\n" +
+	"\x10expected_version\x18\x02 \x01(\x03H\x00R\x0fexpectedVersion\x88\x01\x01\x12\x1f\n" +
+	"\vany_version\x18\x03 \x01(\bR\n" +
+	"anyVersionB\x13\n" +
+	"\x11_expected_version\"D\n" +
+	"\x12StoreSizesResponse\x12\x14\n" +
+	"\x05sizes\x18\x01 \x03(\x03R\x05sizes\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion2\xed\x02\n" +
+	"\tPackSizes\x12[\n" +
+	"\x0eCalculatePacks\x12#.packsizes.v1.CalculatePacksRequest\x1a$.packsizes.v1.CalculatePacksResponse\x12g\n" +
+	"\x13CalculatePacksBatch\x12(.packsizes.v1.CalculatePacksBatchRequest\x1a$.packsizes.v1.CalculatePacksResponse0\x01\x12I\n" +
+	"\bGetSizes\x12\x1d.packsizes.v1.GetSizesRequest\x1a\x1e.packsizes.v1.GetSizesResponse\x12O\n" +
+	"\n" +
+	"StoreSizes\x12\x1f.packsizes.v1.StoreSizesRequest\x1a .packsizes.v1.StoreSizesResponseBOZMgithub.com/achere/homework-pack-sizes/internal/proto/packsizes/v1;packsizesv1b\x06proto3"
+
+var (
+	file_packsizes_proto_rawDescOnce sync.Once
+	file_packsizes_proto_rawDescData []byte
+)
+
+func file_packsizes_proto_rawDescGZIP() []byte {
+	file_packsizes_proto_rawDescOnce.Do(func() {
+		file_packsizes_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_packsizes_proto_rawDesc), len(file_packsizes_proto_rawDesc)))
+	})
+	return file_packsizes_proto_rawDescData
+}
+
+var file_packsizes_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_packsizes_proto_goTypes = []any{
+	(*CalculatePacksRequest)(nil),      // 0: packsizes.v1.CalculatePacksRequest
+	(*CalculatePacksResponse)(nil),     // 1: packsizes.v1.CalculatePacksResponse
+	(*CalculatePacksBatchRequest)(nil), // 2: packsizes.v1.CalculatePacksBatchRequest
+	(*GetSizesRequest)(nil),            // 3: packsizes.v1.GetSizesRequest
+	(*GetSizesResponse)(nil),           // 4: packsizes.v1.GetSizesResponse
+	(*StoreSizesRequest)(nil),          // 5: packsizes.v1.StoreSizesRequest
+	(*StoreSizesResponse)(nil),         // 6: packsizes.v1.StoreSizesResponse
+	nil,                                // 7: packsizes.v1.CalculatePacksResponse.PacksEntry
+	(*timestamppb.Timestamp)(nil),      // 8: google.protobuf.Timestamp
+}
+var file_packsizes_proto_depIdxs = []int32{
+	8, // 0: packsizes.v1.CalculatePacksRequest.as_of:type_name -> google.protobuf.Timestamp
+	7, // 1: packsizes.v1.CalculatePacksResponse.packs:type_name -> packsizes.v1.CalculatePacksResponse.PacksEntry
+	8, // 2: packsizes.v1.CalculatePacksBatchRequest.as_of:type_name -> google.protobuf.Timestamp
+	0, // 3: packsizes.v1.PackSizes.CalculatePacks:input_type -> packsizes.v1.CalculatePacksRequest
+	2, // 4: packsizes.v1.PackSizes.CalculatePacksBatch:input_type -> packsizes.v1.CalculatePacksBatchRequest
+	3, // 5: packsizes.v1.PackSizes.GetSizes:input_type -> packsizes.v1.GetSizesRequest
+	5, // 6: packsizes.v1.PackSizes.StoreSizes:input_type -> packsizes.v1.StoreSizesRequest
+	1, // 7: packsizes.v1.PackSizes.CalculatePacks:output_type -> packsizes.v1.CalculatePacksResponse
+	1, // 8: packsizes.v1.PackSizes.CalculatePacksBatch:output_type -> packsizes.v1.CalculatePacksResponse
+	4, // 9: packsizes.v1.PackSizes.GetSizes:output_type -> packsizes.v1.GetSizesResponse
+	6, // 10: packsizes.v1.PackSizes.StoreSizes:output_type -> packsizes.v1.StoreSizesResponse
+	7, // [7:11] is the sub-list for method output_type
+	3, // [3:7] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_packsizes_proto_init() }
+func file_packsizes_proto_init() {
+	if File_packsizes_proto != nil {
+		return
+	}
+	file_packsizes_proto_msgTypes[5].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_packsizes_proto_rawDesc), len(file_packsizes_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_packsizes_proto_goTypes,
+		DependencyIndexes: file_packsizes_proto_depIdxs,
+		MessageInfos:      file_packsizes_proto_msgTypes,
+	}.Build()
+	File_packsizes_proto = out.File
+	file_packsizes_proto_goTypes = nil
+	file_packsizes_proto_depIdxs = nil
+}
@@ -0,0 +1,259 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: packsizes.proto
+
+package packsizesv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PackSizes_CalculatePacks_FullMethodName      = "/packsizes.v1.PackSizes/CalculatePacks"
+	PackSizes_CalculatePacksBatch_FullMethodName = "/packsizes.v1.PackSizes/CalculatePacksBatch"
+	PackSizes_GetSizes_FullMethodName            = "/packsizes.v1.PackSizes/GetSizes"
+	PackSizes_StoreSizes_FullMethodName          = "/packsizes.v1.PackSizes/StoreSizes"
+)
+
+// PackSizesClient is the client API for PackSizes service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PackSizes mirrors the v2 HTTP API. When the server runs with AUTH_ENABLED=true, every call requires an API key
+// sent as "Bearer <key>" in the authorization metadata, with the same roles as the HTTP API.
+// Errors have an ErrorInfo detail with the problem code of the HTTP API as the reason, and a BadRequest detail
+// with the fields at fault if they are known.
+type PackSizesClient interface {
+	// CalculatePacks calculates the packs to ship for an order. Requires the calculator role.
+	CalculatePacks(ctx context.Context, in *CalculatePacksRequest, opts ...grpc.CallOption) (*CalculatePacksResponse, error)
+	// CalculatePacksBatch calculates the packs for many orders with the same version of pack sizes, streaming
+	// the results in the order of the request. Requires the calculator role.
+	CalculatePacksBatch(ctx context.Context, in *CalculatePacksBatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CalculatePacksResponse], error)
+	// GetSizes returns the current pack sizes. Requires the reader role.
+	GetSizes(ctx context.Context, in *GetSizesRequest, opts ...grpc.CallOption) (*GetSizesResponse, error)
+	// StoreSizes stores a new version of pack sizes. Requires the admin role.
+	StoreSizes(ctx context.Context, in *StoreSizesRequest, opts ...grpc.CallOption) (*StoreSizesResponse, error)
+}
+
+type packSizesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPackSizesClient(cc grpc.ClientConnInterface) PackSizesClient {
+	return &packSizesClient{cc}
+}
+
+func (c *packSizesClient) CalculatePacks(ctx context.Context, in *CalculatePacksRequest, opts ...grpc.CallOption) (*CalculatePacksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CalculatePacksResponse)
+	err := c.cc.Invoke(ctx, PackSizes_CalculatePacks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packSizesClient) CalculatePacksBatch(ctx context.Context, in *CalculatePacksBatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[CalculatePacksResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PackSizes_ServiceDesc.Streams[0], PackSizes_CalculatePacksBatch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CalculatePacksBatchRequest, CalculatePacksResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PackSizes_CalculatePacksBatchClient = grpc.ServerStreamingClient[CalculatePacksResponse]
+
+func (c *packSizesClient) GetSizes(ctx context.Context, in *GetSizesRequest, opts ...grpc.CallOption) (*GetSizesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetSizesResponse)
+	err := c.cc.Invoke(ctx, PackSizes_GetSizes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *packSizesClient) StoreSizes(ctx context.Context, in *StoreSizesRequest, opts ...grpc.CallOption) (*StoreSizesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StoreSizesResponse)
+	err := c.cc.Invoke(ctx, PackSizes_StoreSizes_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PackSizesServer is the server API for PackSizes service.
+// All implementations must embed UnimplementedPackSizesServer
+// for forward compatibility.
+//
+// PackSizes mirrors the v2 HTTP API. When the server runs with AUTH_ENABLED=true, every call requires an API key
+// sent as "Bearer <key>" in the authorization metadata, with the same roles as the HTTP API.
+// Errors have an ErrorInfo detail with the problem code of the HTTP API as the reason, and a BadRequest detail
+// with the fields at fault if they are known.
+type PackSizesServer interface {
+	// CalculatePacks calculates the packs to ship for an order. Requires the calculator role.
+	CalculatePacks(context.Context, *CalculatePacksRequest) (*CalculatePacksResponse, error)
+	// CalculatePacksBatch calculates the packs for many orders with the same version of pack sizes, streaming
+	// the results in the order of the request. Requires the calculator role.
+	CalculatePacksBatch(*CalculatePacksBatchRequest, grpc.ServerStreamingServer[CalculatePacksResponse]) error
+	// GetSizes returns the current pack sizes. Requires the reader role.
+	GetSizes(context.Context, *GetSizesRequest) (*GetSizesResponse, error)
+	// StoreSizes stores a new version of pack sizes. Requires the admin role.
+	StoreSizes(context.Context, *StoreSizesRequest) (*StoreSizesResponse, error)
+	mustEmbedUnimplementedPackSizesServer()
+}
+
+// UnimplementedPackSizesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPackSizesServer struct{}
+
+func (UnimplementedPackSizesServer) CalculatePacks(context.Context, *CalculatePacksRequest) (*CalculatePacksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CalculatePacks not implemented")
+}
+func (UnimplementedPackSizesServer) CalculatePacksBatch(*CalculatePacksBatchRequest, grpc.ServerStreamingServer[CalculatePacksResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CalculatePacksBatch not implemented")
+}
+func (UnimplementedPackSizesServer) GetSizes(context.Context, *GetSizesRequest) (*GetSizesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSizes not implemented")
+}
+func (UnimplementedPackSizesServer) StoreSizes(context.Context, *StoreSizesRequest) (*StoreSizesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StoreSizes not implemented")
+}
+func (UnimplementedPackSizesServer) mustEmbedUnimplementedPackSizesServer() {}
+func (UnimplementedPackSizesServer) testEmbeddedByValue()                   {}
+
+// UnsafePackSizesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PackSizesServer will
+// result in compilation errors.
+type UnsafePackSizesServer interface {
+	mustEmbedUnimplementedPackSizesServer()
+}
+
+func RegisterPackSizesServer(s grpc.ServiceRegistrar, srv PackSizesServer) {
+	// If the following call pancis, it indicates UnimplementedPackSizesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PackSizes_ServiceDesc, srv)
+}
+
+func _PackSizes_CalculatePacks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CalculatePacksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackSizesServer).CalculatePacks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackSizes_CalculatePacks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackSizesServer).CalculatePacks(ctx, req.(*CalculatePacksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackSizes_CalculatePacksBatch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CalculatePacksBatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PackSizesServer).CalculatePacksBatch(m, &grpc.GenericServerStream[CalculatePacksBatchRequest, CalculatePacksResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PackSizes_CalculatePacksBatchServer = grpc.ServerStreamingServer[CalculatePacksResponse]
+
+func _PackSizes_GetSizes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSizesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackSizesServer).GetSizes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackSizes_GetSizes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackSizesServer).GetSizes(ctx, req.(*GetSizesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PackSizes_StoreSizes_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StoreSizesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PackSizesServer).StoreSizes(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PackSizes_StoreSizes_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PackSizesServer).StoreSizes(ctx, req.(*StoreSizesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PackSizes_ServiceDesc is the grpc.ServiceDesc for PackSizes service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PackSizes_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "packsizes.v1.PackSizes",
+	HandlerType: (*PackSizesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CalculatePacks",
+			Handler:    _PackSizes_CalculatePacks_Handler,
+		},
+		{
+			MethodName: "GetSizes",
+			Handler:    _PackSizes_GetSizes_Handler,
+		},
+		{
+			MethodName: "StoreSizes",
+			Handler:    _PackSizes_StoreSizes_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CalculatePacksBatch",
+			Handler:       _PackSizes_CalculatePacksBatch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "packsizes.proto",
+}
@@ -0,0 +1,689 @@
+// Package repotest provides conformance tests that every implementation of
+// pack.PackSizeRepo, pack.CalculationRepo, pack.AuditRepo and pack.APIKeyRepo must pass.
+package repotest
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPackSizeRepo runs the conformance tests for pack.PackSizeRepo.
+// newRepo must return an empty repository for every call.
+func TestPackSizeRepo(t *testing.T, newRepo func(t *testing.T) pack.PackSizeRepo) {
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, set.Version)
+		assert.Empty(t, set.Sizes)
+
+		sets, err := repo.GetPackSizeSets(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, sets)
+
+		_, err = repo.GetPackSizeSet(ctx, 1)
+		assert.ErrorIs(t, err, pack.ErrNotFound)
+	})
+
+	t.Run("Versions", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		before := time.Now().Add(-time.Minute)
+
+		first, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{500, 250}, Author: "john"})
+		require.NoError(t, err)
+		assert.Positive(t, first.Version)
+		assert.Equal(t, []int{250, 500}, first.Sizes)
+		assert.Equal(t, "john", first.Author)
+		assert.True(t, first.CreatedAt.After(before), "created at %s", first.CreatedAt)
+
+		second, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{1000}, Author: "jane", RolledBackFrom: first.Version})
+		require.NoError(t, err)
+		assert.Greater(t, second.Version, first.Version)
+		assert.Equal(t, first.Version, second.RolledBackFrom)
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assertSizeSet(t, second, set)
+
+		set, err = repo.GetPackSizeSet(ctx, first.Version)
+		require.NoError(t, err)
+		assertSizeSet(t, first, set)
+
+		_, err = repo.GetPackSizeSet(ctx, second.Version+1)
+		assert.ErrorIs(t, err, pack.ErrNotFound)
+
+		sets, err := repo.GetPackSizeSets(ctx)
+		require.NoError(t, err)
+		if assert.Len(t, sets, 2) {
+			assertSizeSet(t, second, sets[0])
+			assertSizeSet(t, first, sets[1])
+		}
+	})
+
+	t.Run("Returned sizes are copies", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		sizes := []int{250, 500}
+		stored, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: sizes, Author: "john"})
+		require.NoError(t, err)
+		sizes[0] = 1
+		stored.Sizes[1] = 2
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		set.Sizes[0] = 3
+
+		set, err = repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []int{250, 500}, set.Sizes)
+	})
+
+	t.Run("Invalid sizes are rejected", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		for _, sizes := range [][]int{{250, 0}, {-250}, {250, 250}} {
+			_, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: sizes, Author: "john"})
+			assert.Error(t, err, "sizes %v", sizes)
+		}
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, set.Version)
+	})
+
+	t.Run("Compare and store", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		_, err := repo.CompareAndStorePackSizes(ctx, 1, pack.SizeSet{Sizes: []int{250}, Author: "john"})
+		assert.ErrorIs(t, err, pack.ErrConflict)
+
+		first, err := repo.CompareAndStorePackSizes(ctx, 0, pack.SizeSet{Sizes: []int{250}, Author: "john"})
+		require.NoError(t, err)
+
+		_, err = repo.CompareAndStorePackSizes(ctx, 0, pack.SizeSet{Sizes: []int{500}, Author: "jane"})
+		assert.ErrorIs(t, err, pack.ErrConflict)
+
+		second, err := repo.CompareAndStorePackSizes(ctx, first.Version, pack.SizeSet{Sizes: []int{500}, Author: "jane"})
+		require.NoError(t, err)
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assertSizeSet(t, second, set)
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		stored, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500}, Author: "john"})
+		require.NoError(t, err)
+
+		updated, err := repo.UpdatePackSizes(ctx, "jane", func(current pack.SizeSet) ([]int, error) {
+			assertSizeSet(t, stored, current)
+			return []int{1000, 250, 500}, nil
+		})
+		require.NoError(t, err)
+		assert.Greater(t, updated.Version, stored.Version)
+		assert.Equal(t, []int{250, 500, 1000}, updated.Sizes)
+		assert.Equal(t, "jane", updated.Author)
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assertSizeSet(t, updated, set)
+
+		unchanged, err := repo.UpdatePackSizes(ctx, "jane", func(current pack.SizeSet) ([]int, error) {
+			return []int{1000, 500, 250}, nil
+		})
+		require.NoError(t, err)
+		assertSizeSet(t, updated, unchanged)
+
+		errUpdate := fmt.Errorf("update failed")
+		_, err = repo.UpdatePackSizes(ctx, "jane", func(current pack.SizeSet) ([]int, error) {
+			return nil, errUpdate
+		})
+		assert.ErrorIs(t, err, errUpdate)
+
+		sets, err := repo.GetPackSizeSets(ctx)
+		require.NoError(t, err)
+		assert.Len(t, sets, 2)
+	})
+
+	t.Run("Concurrent updates", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		const writers = 10
+		var wg sync.WaitGroup
+
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.UpdatePackSizes(ctx, fmt.Sprintf("writer-%d", i), func(current pack.SizeSet) ([]int, error) {
+					return append(slices.Clone(current.Sizes), 250*(i+1)), nil
+				})
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+
+		// Every update is based on the previous one, so none of the sizes is lost
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assert.Len(t, set.Sizes, writers)
+	})
+
+	t.Run("Scheduled", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		// The database keeps microseconds
+		now := time.Now().Truncate(time.Microsecond)
+
+		current, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500}, Author: "john"})
+		require.NoError(t, err)
+		assert.True(t, current.EffectiveFrom.Equal(current.CreatedAt), "effective from %s", current.EffectiveFrom)
+
+		scheduled, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{500}, Author: "jane", EffectiveFrom: now.Add(time.Hour)})
+		require.NoError(t, err)
+		assert.True(t, scheduled.EffectiveFrom.Equal(now.Add(time.Hour)), "effective from %s", scheduled.EffectiveFrom)
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assertSizeSet(t, current, set)
+
+		next, err := repo.GetNextEffectiveFrom(ctx, current.EffectiveFrom)
+		require.NoError(t, err)
+		assert.True(t, next.Equal(scheduled.EffectiveFrom), "next effective from %s", next)
+
+		next, err = repo.GetNextEffectiveFrom(ctx, scheduled.EffectiveFrom)
+		require.NoError(t, err)
+		assert.True(t, next.IsZero(), "next effective from %s", next)
+
+		set, err = repo.GetPackSizesAt(ctx, now.Add(2*time.Hour))
+		require.NoError(t, err)
+		assertSizeSet(t, scheduled, set)
+
+		set, err = repo.GetPackSizesAt(ctx, now.Add(-time.Hour))
+		require.NoError(t, err)
+		assert.Zero(t, set.Version)
+
+		// Compare and store checks the currently effective version, and saves made now
+		// don't override the scheduled version once it takes effect
+		replaced, err := repo.CompareAndStorePackSizes(ctx, current.Version, pack.SizeSet{Sizes: []int{1000}, Author: "john"})
+		require.NoError(t, err)
+
+		set, err = repo.GetPackSizesAt(ctx, now.Add(2*time.Hour))
+		require.NoError(t, err)
+		assertSizeSet(t, scheduled, set)
+
+		cancelled, err := repo.CancelPackSizes(ctx, scheduled.Version, "john")
+		require.NoError(t, err)
+		assert.False(t, cancelled.CancelledAt.IsZero())
+
+		set, err = repo.GetPackSizeSet(ctx, scheduled.Version)
+		require.NoError(t, err)
+		assertSizeSet(t, cancelled, set)
+
+		next, err = repo.GetNextEffectiveFrom(ctx, replaced.EffectiveFrom)
+		require.NoError(t, err)
+		assert.True(t, next.IsZero(), "cancelled versions don't take effect, next effective from %s", next)
+
+		set, err = repo.GetPackSizesAt(ctx, now.Add(2*time.Hour))
+		require.NoError(t, err)
+		assertSizeSet(t, replaced, set)
+
+		_, err = repo.CancelPackSizes(ctx, scheduled.Version, "john")
+		assert.ErrorIs(t, err, pack.ErrConflict, "already cancelled")
+		_, err = repo.CancelPackSizes(ctx, replaced.Version, "john")
+		assert.ErrorIs(t, err, pack.ErrConflict, "already effective")
+		_, err = repo.CancelPackSizes(ctx, replaced.Version+1, "john")
+		assert.ErrorIs(t, err, pack.ErrNotFound)
+	})
+
+	t.Run("Apply", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		now := time.Now().Truncate(time.Microsecond)
+
+		current, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250, 500}, Author: "john"})
+		require.NoError(t, err)
+		scheduled, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{500}, Author: "john", EffectiveFrom: now.Add(time.Hour)})
+		require.NoError(t, err)
+
+		stored, err := repo.ApplyPackSizes(ctx, func(sets []pack.SizeSet) (pack.SizeSetChanges, error) {
+			if assert.Len(t, sets, 2) {
+				assertSizeSet(t, scheduled, sets[0])
+				assertSizeSet(t, current, sets[1])
+			}
+			return pack.SizeSetChanges{
+				Cancel: []int{scheduled.Version},
+				Store: []pack.SizeSet{
+					{Sizes: []int{1000, 100}, Author: "jane"},
+					{Sizes: []int{2000}, Author: "jane", EffectiveFrom: now.Add(2 * time.Hour)},
+				},
+			}, nil
+		})
+		require.NoError(t, err)
+		require.Len(t, stored, 2)
+		assert.Equal(t, []int{100, 1000}, stored[0].Sizes)
+		assert.Greater(t, stored[1].Version, stored[0].Version)
+
+		set, err := repo.GetPackSizes(ctx)
+		require.NoError(t, err)
+		assertSizeSet(t, stored[0], set)
+
+		set, err = repo.GetPackSizeSet(ctx, scheduled.Version)
+		require.NoError(t, err)
+		assert.False(t, set.CancelledAt.IsZero())
+
+		set, err = repo.GetPackSizesAt(ctx, now.Add(3*time.Hour))
+		require.NoError(t, err)
+		assertSizeSet(t, stored[1], set)
+
+		// Nothing is applied if any of the changes fails
+		for _, changes := range []pack.SizeSetChanges{
+			{Cancel: []int{current.Version}, Store: []pack.SizeSet{{Sizes: []int{100}}}},
+			{Store: []pack.SizeSet{{Sizes: []int{100}}, {Sizes: []int{0}}}},
+		} {
+			_, err = repo.ApplyPackSizes(ctx, func([]pack.SizeSet) (pack.SizeSetChanges, error) {
+				return changes, nil
+			})
+			assert.Error(t, err)
+		}
+		_, err = repo.ApplyPackSizes(ctx, func([]pack.SizeSet) (pack.SizeSetChanges, error) {
+			return pack.SizeSetChanges{Cancel: []int{stored[1].Version}}, nil
+		})
+		require.NoError(t, err)
+
+		errPlan := fmt.Errorf("plan failed")
+		_, err = repo.ApplyPackSizes(ctx, func([]pack.SizeSet) (pack.SizeSetChanges, error) {
+			return pack.SizeSetChanges{}, errPlan
+		})
+		assert.ErrorIs(t, err, errPlan)
+
+		sets, err := repo.GetPackSizeSets(ctx)
+		require.NoError(t, err)
+		assert.Len(t, sets, 4)
+
+		set, err = repo.GetPackSizesAt(ctx, now.Add(3*time.Hour))
+		require.NoError(t, err)
+		assertSizeSet(t, stored[0], set)
+	})
+
+	t.Run("Concurrent compare and store", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		stored, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250}, Author: "john"})
+		require.NoError(t, err)
+
+		const writers = 10
+		var wg sync.WaitGroup
+		var succeeded atomic.Int64
+
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := repo.CompareAndStorePackSizes(ctx, stored.Version, pack.SizeSet{
+					Sizes:  []int{250 * (i + 2)},
+					Author: fmt.Sprintf("writer-%d", i),
+				})
+				if err == nil {
+					succeeded.Add(1)
+				} else {
+					assert.ErrorIs(t, err, pack.ErrConflict)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.EqualValues(t, 1, succeeded.Load())
+
+		sets, err := repo.GetPackSizeSets(ctx)
+		require.NoError(t, err)
+		assert.Len(t, sets, 2)
+	})
+
+	t.Run("Readers never see a partial set", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		const setLen = 50
+		newSet := func(i int) []int {
+			sizes := make([]int, setLen)
+			for j := range sizes {
+				sizes[j] = (i + 1) * (j + 1)
+			}
+			return sizes
+		}
+
+		_, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: newSet(0), Author: "writer"})
+		require.NoError(t, err)
+
+		var readers sync.WaitGroup
+		for range 4 {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				var last int
+				for ctx.Err() == nil {
+					set, err := repo.GetPackSizes(ctx)
+					if ctx.Err() != nil {
+						return
+					}
+					if assert.NoError(t, err) {
+						assert.Len(t, set.Sizes, setLen, "version %d is partial", set.Version)
+						assert.GreaterOrEqual(t, set.Version, last, "versions went back")
+						last = set.Version
+					}
+				}
+			}()
+		}
+
+		// Writers store at the same time, so every save must be isolated from the others as well
+		var writers sync.WaitGroup
+		for w := range 2 {
+			writers.Add(1)
+			go func() {
+				defer writers.Done()
+				for i := 1; i <= 25; i++ {
+					_, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: newSet(2*i + w), Author: "writer"})
+					assert.NoError(t, err)
+				}
+			}()
+		}
+		writers.Wait()
+
+		cancel()
+		readers.Wait()
+
+		sets, err := repo.GetPackSizeSets(context.Background())
+		require.NoError(t, err)
+		assert.Len(t, sets, 51)
+	})
+}
+
+// TestCalculationRepo runs the conformance tests for pack.CalculationRepo.
+// newRepo must return an empty repository for every call.
+func TestCalculationRepo(t *testing.T, newRepo func(t *testing.T) pack.CalculationRepo) {
+	base := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	calcs := []pack.Calculation{
+		{CreatedAt: base, Order: 251, Sizes: []int{250, 500}, Packs: map[int]int{500: 1}, Solver: pack.SolverDP},
+		{CreatedAt: base.Add(time.Hour), Order: 501, Sizes: []int{250, 500}, Packs: map[int]int{500: 1, 250: 1}, Solver: pack.SolverDP},
+		{CreatedAt: base.Add(2 * time.Hour), Order: 1000, Sizes: []int{1000}, Packs: map[int]int{1000: 1}, Solver: pack.SolverGreedy},
+	}
+
+	newFilledRepo := func(t *testing.T) pack.CalculationRepo {
+		repo := newRepo(t)
+		for _, c := range calcs {
+			require.NoError(t, repo.StoreCalculation(context.Background(), c))
+		}
+		return repo
+	}
+
+	tests := []struct {
+		name     string
+		filter   pack.CalculationFilter
+		expected []int // orders
+	}{
+		{"No filter", pack.CalculationFilter{}, []int{1000, 501, 251}},
+		{"From is inclusive", pack.CalculationFilter{From: base.Add(time.Hour)}, []int{1000, 501}},
+		{"To is exclusive", pack.CalculationFilter{To: base.Add(time.Hour)}, []int{251}},
+		{"Order range is inclusive", pack.CalculationFilter{MinOrder: 501, MaxOrder: 1000}, []int{1000, 501}},
+		{"Limit", pack.CalculationFilter{Limit: 2}, []int{1000, 501}},
+		{"Offset", pack.CalculationFilter{Limit: 2, Offset: 2}, []int{251}},
+		{"Offset past the end", pack.CalculationFilter{Offset: 5}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newFilledRepo(t)
+
+			res, err := repo.GetCalculations(context.Background(), tt.filter)
+			require.NoError(t, err)
+
+			var orders []int
+			for _, c := range res {
+				orders = append(orders, c.Order)
+			}
+			assert.Equal(t, tt.expected, orders)
+		})
+	}
+
+	t.Run("Fields are stored", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		calc := calcs[0]
+		require.NoError(t, repo.StoreCalculation(ctx, calc))
+
+		res, err := repo.GetCalculations(ctx, pack.CalculationFilter{})
+		require.NoError(t, err)
+		if assert.Len(t, res, 1) {
+			assert.True(t, calc.CreatedAt.Equal(res[0].CreatedAt))
+			assert.Equal(t, calc.Order, res[0].Order)
+			assert.Equal(t, calc.Sizes, res[0].Sizes)
+			assert.Equal(t, calc.Packs, res[0].Packs)
+			assert.Equal(t, calc.Solver, res[0].Solver)
+			assert.Zero(t, res[0].Version)
+		}
+	})
+}
+
+// AuditedRepo is a pack.PackSizeRepo that writes the audit log read through pack.AuditRepo
+type AuditedRepo interface {
+	pack.PackSizeRepo
+	pack.AuditRepo
+}
+
+// TestAuditRepo runs the conformance tests for pack.AuditRepo.
+// newRepo must return an empty repository for every call.
+func TestAuditRepo(t *testing.T, newRepo func(t *testing.T) AuditedRepo) {
+	t.Run("Changes are recorded", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := pack.WithClientIP(context.Background(), "192.0.2.1")
+
+		first, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{500, 250}, Author: "john"})
+		require.NoError(t, err)
+		second, err := repo.CompareAndStorePackSizes(context.Background(), first.Version, pack.SizeSet{Sizes: []int{1000}, Author: "jane"})
+		require.NoError(t, err)
+
+		// Failed saves leave no trace
+		_, err = repo.CompareAndStorePackSizes(ctx, first.Version, pack.SizeSet{Sizes: []int{1}, Author: "john"})
+		require.ErrorIs(t, err, pack.ErrConflict)
+
+		entries, err := repo.GetAuditEntries(ctx, pack.AuditFilter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+
+		assert.True(t, second.CreatedAt.Equal(entries[0].CreatedAt))
+		assert.Equal(t, "jane", entries[0].Actor)
+		assert.Empty(t, entries[0].ClientIP)
+		assert.Equal(t, first.Version, entries[0].OldVersion)
+		assert.Equal(t, []int{250, 500}, entries[0].OldSizes)
+		assert.Equal(t, second.Version, entries[0].NewVersion)
+		assert.Equal(t, []int{1000}, entries[0].NewSizes)
+
+		assert.True(t, first.CreatedAt.Equal(entries[1].CreatedAt))
+		assert.Equal(t, "john", entries[1].Actor)
+		assert.Equal(t, "192.0.2.1", entries[1].ClientIP)
+		assert.Zero(t, entries[1].OldVersion)
+		assert.Empty(t, entries[1].OldSizes)
+		assert.Equal(t, first.Version, entries[1].NewVersion)
+		assert.Equal(t, []int{250, 500}, entries[1].NewSizes)
+		assert.False(t, entries[1].Cancelled)
+	})
+
+	t.Run("Cancellations are recorded", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := pack.WithClientIP(context.Background(), "192.0.2.1")
+
+		current, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{250}, Author: "john"})
+		require.NoError(t, err)
+		scheduled, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{500}, Author: "john", EffectiveFrom: time.Now().Add(time.Hour)})
+		require.NoError(t, err)
+		cancelled, err := repo.CancelPackSizes(ctx, scheduled.Version, "jane")
+		require.NoError(t, err)
+
+		// Failed cancellations leave no trace
+		_, err = repo.CancelPackSizes(ctx, scheduled.Version, "jane")
+		require.ErrorIs(t, err, pack.ErrConflict)
+
+		entries, err := repo.GetAuditEntries(ctx, pack.AuditFilter{})
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+
+		assert.True(t, cancelled.CancelledAt.Equal(entries[0].CreatedAt))
+		assert.Equal(t, "jane", entries[0].Actor)
+		assert.Equal(t, "192.0.2.1", entries[0].ClientIP)
+		assert.Equal(t, current.Version, entries[0].OldVersion)
+		assert.Equal(t, []int{250}, entries[0].OldSizes)
+		assert.Equal(t, scheduled.Version, entries[0].NewVersion)
+		assert.Equal(t, []int{500}, entries[0].NewSizes)
+		assert.True(t, entries[0].Cancelled)
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		var sets []pack.SizeSet
+		for i, author := range []string{"john", "jane", "john"} {
+			set, err := repo.StorePackSizes(ctx, pack.SizeSet{Sizes: []int{i + 1}, Author: author})
+			require.NoError(t, err)
+			sets = append(sets, set)
+		}
+
+		tests := []struct {
+			name     string
+			filter   pack.AuditFilter
+			expected []int // new versions
+		}{
+			{"No filter", pack.AuditFilter{}, []int{3, 2, 1}},
+			{"From is inclusive", pack.AuditFilter{From: sets[1].CreatedAt}, []int{3, 2}},
+			{"To is exclusive", pack.AuditFilter{To: sets[1].CreatedAt}, []int{1}},
+			{"Actor", pack.AuditFilter{Actor: "john"}, []int{3, 1}},
+			{"Limit", pack.AuditFilter{Limit: 2}, []int{3, 2}},
+			{"Offset", pack.AuditFilter{Limit: 2, Offset: 2}, []int{1}},
+			{"Offset past the end", pack.AuditFilter{Offset: 5}, nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				entries, err := repo.GetAuditEntries(ctx, tt.filter)
+				require.NoError(t, err)
+
+				var versions []int
+				for _, e := range entries {
+					versions = append(versions, e.NewVersion)
+				}
+				assert.Equal(t, tt.expected, versions)
+			})
+		}
+	})
+}
+
+// TestAPIKeyRepo runs the conformance tests for pack.APIKeyRepo.
+// newRepo must return an empty repository for every call.
+func TestAPIKeyRepo(t *testing.T, newRepo func(t *testing.T) pack.APIKeyRepo) {
+	t.Run("Keys", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		before := time.Now().Add(-time.Minute)
+
+		keys, err := repo.GetAPIKeys(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+
+		_, err = repo.GetAPIKey(ctx, "unknown")
+		assert.ErrorIs(t, err, pack.ErrNotFound)
+
+		first, err := repo.StoreAPIKey(ctx, pack.APIKey{Name: "jane", Role: pack.RoleAdmin, Hash: "hash1"})
+		require.NoError(t, err)
+		assert.Positive(t, first.ID)
+		assert.Equal(t, "jane", first.Name)
+		assert.Equal(t, pack.RoleAdmin, first.Role)
+		assert.Equal(t, "hash1", first.Hash)
+		assert.True(t, first.CreatedAt.After(before), "created at %s", first.CreatedAt)
+		assert.True(t, first.RevokedAt.IsZero())
+
+		second, err := repo.StoreAPIKey(ctx, pack.APIKey{Name: "john", Role: pack.RoleReader, Hash: "hash2"})
+		require.NoError(t, err)
+		assert.Greater(t, second.ID, first.ID)
+
+		key, err := repo.GetAPIKey(ctx, "hash2")
+		require.NoError(t, err)
+		assertAPIKey(t, second, key)
+
+		keys, err = repo.GetAPIKeys(ctx)
+		require.NoError(t, err)
+		if assert.Len(t, keys, 2) {
+			assertAPIKey(t, first, keys[0])
+			assertAPIKey(t, second, keys[1])
+		}
+	})
+
+	t.Run("Revoke", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+
+		stored, err := repo.StoreAPIKey(ctx, pack.APIKey{Name: "jane", Role: pack.RoleCalculator, Hash: "hash1"})
+		require.NoError(t, err)
+
+		revoked, err := repo.RevokeAPIKey(ctx, stored.ID)
+		require.NoError(t, err)
+		assert.Equal(t, stored.ID, revoked.ID)
+		assert.False(t, revoked.RevokedAt.Before(stored.CreatedAt), "revoked at %s", revoked.RevokedAt)
+
+		// Revoked keys are still found, so they can be told apart from unknown ones
+		key, err := repo.GetAPIKey(ctx, "hash1")
+		require.NoError(t, err)
+		assertAPIKey(t, revoked, key)
+
+		_, err = repo.RevokeAPIKey(ctx, stored.ID)
+		assert.ErrorIs(t, err, pack.ErrConflict)
+
+		_, err = repo.RevokeAPIKey(ctx, stored.ID+1)
+		assert.ErrorIs(t, err, pack.ErrNotFound)
+	})
+}
+
+func assertAPIKey(t *testing.T, expected, actual pack.APIKey) {
+	t.Helper()
+
+	assert.Equal(t, expected.ID, actual.ID)
+	assert.Equal(t, expected.Name, actual.Name)
+	assert.Equal(t, expected.Role, actual.Role)
+	assert.Equal(t, expected.Hash, actual.Hash)
+	assert.True(t, expected.CreatedAt.Equal(actual.CreatedAt), "created at %s, expected %s", actual.CreatedAt, expected.CreatedAt)
+	assert.True(t, expected.RevokedAt.Equal(actual.RevokedAt), "revoked at %s, expected %s", actual.RevokedAt, expected.RevokedAt)
+}
+
+func assertSizeSet(t *testing.T, expected, actual pack.SizeSet) {
+	t.Helper()
+
+	assert.Equal(t, expected.Version, actual.Version)
+	assert.Equal(t, expected.Sizes, actual.Sizes)
+	assert.Equal(t, expected.Author, actual.Author)
+	assert.Equal(t, expected.RolledBackFrom, actual.RolledBackFrom)
+	assert.True(t, expected.EffectiveFrom.Equal(actual.EffectiveFrom), "effective from %s, expected %s", actual.EffectiveFrom, expected.EffectiveFrom)
+	assert.True(t, expected.CancelledAt.Equal(actual.CancelledAt), "cancelled at %s, expected %s", actual.CancelledAt, expected.CancelledAt)
+	assert.True(t, expected.CreatedAt.Equal(actual.CreatedAt), "created at %s, expected %s", actual.CreatedAt, expected.CreatedAt)
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+)
+
+// bootstrapKeyName is who changes made with Config.AdminAPIKey are recorded by
+const bootstrapKeyName = "admin"
+
+type apiKeyContextKey struct{}
+
+// authorize makes handler require an API key with a role that allows the required one when auth is enabled.
+// Failed authentications count against the rate limit of the client address, see authenticateLimited().
+// Public routes don't require a key. The key is passed on in the request context, see requestAPIKey().
+func (a *App) authorize(required pack.Role, handler http.HandlerFunc) http.HandlerFunc {
+	if required == public || !a.Config.AuthEnabled {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := a.authenticateLimited(clientIP(r), func() (pack.APIKey, error) {
+			return a.authorizeBearer(r.Context(), r.Header.Get("Authorization"), required)
+		})
+		if err != nil {
+			a.writeError(w, r, err)
+			return
+		}
+
+		handler(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// authorizeBearer finds the API key in an Authorization header or gRPC metadata value
+// and checks that its role allows the required one
+func (a *App) authorizeBearer(ctx context.Context, authorization string, required pack.Role) (pack.APIKey, error) {
+	key, err := a.authenticateBearer(ctx, authorization)
+	if err != nil {
+		return pack.APIKey{}, err
+	}
+
+	if !key.Role.Allows(required) {
+		return pack.APIKey{}, &requestError{
+			status: http.StatusForbidden,
+			code:   codeForbidden,
+			err:    fmt.Errorf("API key of %s has the %s role, %s is required", key.Name, key.Role, required),
+		}
+	}
+
+	return key, nil
+}
+
+// authenticateBearer finds the API key in an Authorization header or gRPC metadata value
+func (a *App) authenticateBearer(ctx context.Context, authorization string) (pack.APIKey, error) {
+	scheme, token, _ := strings.Cut(authorization, " ")
+	if !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return pack.APIKey{}, unauthenticated(errors.New("an API key is required as a bearer token in the Authorization header"))
+	}
+
+	if a.Config.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.Config.AdminAPIKey)) == 1 {
+		return pack.APIKey{Name: bootstrapKeyName, Role: pack.RoleAdmin}, nil
+	}
+
+	key, err := pack.Authenticate(ctx, a.KeyRepo, token)
+	if errors.Is(err, pack.ErrInvalidKey) {
+		return pack.APIKey{}, unauthenticated(err)
+	}
+
+	return key, err
+}
+
+// unauthenticated reports a missing or invalid API key
+func unauthenticated(err error) error {
+	return &requestError{status: http.StatusUnauthorized, code: codeUnauthenticated, field: "Authorization", err: err}
+}
+
+// requestAPIKey returns the API key the request was authorized with, if there was one
+func requestAPIKey(r *http.Request) (pack.APIKey, bool) {
+	return contextAPIKey(r.Context())
+}
+
+// contextAPIKey returns the API key an HTTP request or a gRPC call was authorized with, if there was one
+func contextAPIKey(ctx context.Context) (pack.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(pack.APIKey)
+	return key, ok
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminAPIKey = "bootstrap-admin-key-of-32-characters"
+
+func TestAuthorize(t *testing.T) {
+	keys := map[string]pack.APIKey{
+		"reader-key":     {ID: 1, Name: "john", Role: pack.RoleReader},
+		"calculator-key": {ID: 2, Name: "joe", Role: pack.RoleCalculator},
+		"admin-key":      {ID: 3, Name: "jane", Role: pack.RoleAdmin},
+		"revoked-key":    {ID: 4, Name: "jim", Role: pack.RoleAdmin, RevokedAt: time.Now()},
+	}
+	byHash := map[string]pack.APIKey{}
+	for token, key := range keys {
+		key.Hash = pack.HashAPIKey(token)
+		byHash[key.Hash] = key
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		body           string
+		authorization  string
+		getAPIKey      func(ctx context.Context, hash string) (pack.APIKey, error)
+		expectedStatus int
+		expectedCode   string
+		expectedAuthor string
+	}{
+		{
+			name:           "Public route",
+			method:         http.MethodGet,
+			target:         "/api/openapi.json",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "No key",
+			method:         http.MethodGet,
+			target:         "/api/v2/sizes",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   codeUnauthenticated,
+		},
+		{
+			name:           "Not a bearer token",
+			method:         http.MethodGet,
+			target:         "/api/v2/sizes",
+			authorization:  "Basic cmVhZGVyLWtleQ==",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   codeUnauthenticated,
+		},
+		{
+			name:           "Unknown key",
+			method:         http.MethodGet,
+			target:         "/api/v2/sizes",
+			authorization:  "Bearer unknown-key",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   codeUnauthenticated,
+		},
+		{
+			name:           "Revoked key",
+			method:         http.MethodGet,
+			target:         "/api/v2/sizes",
+			authorization:  "Bearer revoked-key",
+			expectedStatus: http.StatusUnauthorized,
+			expectedCode:   codeUnauthenticated,
+		},
+		{
+			name:           "Reader reads",
+			method:         http.MethodGet,
+			target:         "/api/v2/sizes",
+			authorization:  "Bearer reader-key",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Reader calculates",
+			method:         http.MethodPost,
+			target:         "/api/v2/calculate-packs",
+			body:           `{"order": 251}`,
+			authorization:  "Bearer reader-key",
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   codeForbidden,
+		},
+		{
+			name:           "Calculator calculates",
+			method:         http.MethodPost,
+			target:         "/api/v2/calculate-packs",
+			body:           `{"order": 251}`,
+			authorization:  "bearer calculator-key",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Calculator changes sizes",
+			method:         http.MethodPut,
+			target:         "/api/v2/sizes/1000",
+			authorization:  "Bearer calculator-key",
+			expectedStatus: http.StatusForbidden,
+			expectedCode:   codeForbidden,
+		},
+		{
+			name:           "Admin changes sizes",
+			method:         http.MethodPut,
+			target:         "/api/v2/sizes/1000",
+			authorization:  "Bearer admin-key",
+			expectedStatus: http.StatusOK,
+			expectedAuthor: "jane",
+		},
+		{
+			name:           "Bootstrap key changes sizes",
+			method:         http.MethodPut,
+			target:         "/api/v2/sizes/1000",
+			authorization:  "Bearer " + testAdminAPIKey,
+			expectedStatus: http.StatusOK,
+			expectedAuthor: bootstrapKeyName,
+		},
+		{
+			name:          "Repo unavailable",
+			method:        http.MethodGet,
+			target:        "/api/v2/sizes",
+			authorization: "Bearer reader-key",
+			getAPIKey: func(ctx context.Context, hash string) (pack.APIKey, error) {
+				return pack.APIKey{}, fmt.Errorf("%w: dial tcp: connection refused", pack.ErrUnavailable)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   codeRepoUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getAPIKey := tt.getAPIKey
+			if getAPIKey == nil {
+				getAPIKey = func(ctx context.Context, hash string) (pack.APIKey, error) {
+					key, ok := byHash[hash]
+					if !ok {
+						return pack.APIKey{}, pack.ErrNotFound
+					}
+					return key, nil
+				}
+			}
+
+			var storedAuthor string
+
+			app := NewTestApp()
+			app.Config.AuthEnabled = true
+			app.Config.AdminAPIKey = testAdminAPIKey
+			app.KeyRepo = &KeyRepoStub{getAPIKey: getAPIKey}
+			app.SizeRepo = &SizeRepoStub{
+				getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+					return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+				},
+				updatePackSizes: func(ctx context.Context, author string, update func(pack.SizeSet) ([]int, error)) (pack.SizeSet, error) {
+					storedAuthor = author
+					sizes, err := update(pack.SizeSet{Version: 1, Sizes: []int{250, 500}})
+					return pack.SizeSet{Version: 2, Sizes: sizes, Author: author}, err
+				},
+			}
+
+			req := httptest.NewRequest(tt.method, tt.target, bytes.NewBufferString(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			// Ignored in favour of the name of the key
+			req.Header.Set(authorHeader, "mallory")
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedCode != "" {
+				p := assertProblem(t, rr)
+				assert.Equal(t, tt.expectedCode, p.Code)
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+			}
+			assert.Equal(t, tt.expectedAuthor, storedAuthor)
+		})
+	}
+}
+
+func TestAuthorize_Disabled(t *testing.T) {
+	var storedAuthor string
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		updatePackSizes: func(ctx context.Context, author string, update func(pack.SizeSet) ([]int, error)) (pack.SizeSet, error) {
+			storedAuthor = author
+			sizes, err := update(pack.SizeSet{Version: 1, Sizes: []int{250, 500}})
+			return pack.SizeSet{Version: 2, Sizes: sizes, Author: author}, err
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v2/sizes/1000", nil)
+	req.Header.Set(authorHeader, "jane")
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "jane", storedAuthor)
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decodeJSON decodes the JSON body of r into dst strictly: the body can't be larger than Config.MaxBodyBytes,
+// fields that dst doesn't have are rejected and nothing but whitespace may follow the JSON value
+func (a *App) decodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	body := http.MaxBytesReader(w, r.Body, a.Config.MaxBodyBytes)
+
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		if err != nil {
+			return decodeError(err)
+		}
+		return badRequest("", errors.New("request body must contain a single JSON value"))
+	}
+
+	return nil
+}
+
+// decodeError reports an error of decoding the request body naming the field at fault if it's known.
+// The messages of encoding/json aren't passed on, as they mention Go types and may change between releases.
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return &requestError{
+			status: http.StatusRequestEntityTooLarge,
+			code:   codeRequestTooLarge,
+			err:    fmt.Errorf("request body is larger than %d bytes", maxBytesErr.Limit),
+		}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return badRequest("", errors.New("request body is empty"))
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return badRequest("", errors.New("request body is not valid JSON"))
+	}
+
+	// encoding/json has no type for unknown fields
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if field, unquoteErr := strconv.Unquote(name); unquoteErr == nil {
+			return badRequest(field, errors.New("unknown field"))
+		}
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return badRequest("", fmt.Errorf("request body must be %s", jsonType(typeErr.Type)))
+		}
+		return badRequest(typeErr.Field, fmt.Errorf("must be %s", jsonType(typeErr.Type)))
+	}
+
+	return badRequest("", errors.New("request body doesn't match the expected format"))
+}
+
+// jsonType describes the JSON values that decode into t
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "a value of another type"
+	}
+}
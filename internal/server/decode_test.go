@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+		expectedFields []fieldProblem
+	}{
+		{
+			name:           "Unknown field",
+			requestBody:    `{"order": 251, "sizes": [250]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "unknown field",
+			expectedFields: []fieldProblem{{Field: "sizes", Detail: "unknown field"}},
+		},
+		{
+			name:           "Mistyped field",
+			requestBody:    `{"order": "251"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "must be an integer",
+			expectedFields: []fieldProblem{{Field: "order", Detail: "must be an integer"}},
+		},
+		{
+			name:           "Mistyped body",
+			requestBody:    `[251]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body must be an object",
+		},
+		{
+			name:           "Malformed",
+			requestBody:    `{"order": 251,}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body is not valid JSON",
+		},
+		{
+			name:           "Truncated",
+			requestBody:    `{"order": 25`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body is not valid JSON",
+		},
+		{
+			name:           "Empty",
+			requestBody:    ``,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body is empty",
+		},
+		{
+			name:           "Mistyped time",
+			requestBody:    `{"order": 251, "as_of": "yesterday"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body doesn't match the expected format",
+		},
+		{
+			name:           "Trailing value",
+			requestBody:    `{"order": 251} {"order": 500}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body must contain a single JSON value",
+		},
+		{
+			name:           "Trailing garbage",
+			requestBody:    `{"order": 251}]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedDetail: "request body is not valid JSON",
+		},
+		{
+			name:           "Too large",
+			requestBody:    `{"order": 251, "as_of": "` + strings.Repeat(" ", 64) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedCode:   codeRequestTooLarge,
+			expectedDetail: "request body is larger than 64 bytes",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.Config.MaxBodyBytes = 64
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", strings.NewReader(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			p := assertProblem(t, rr)
+			assert.Equal(t, tt.expectedCode, p.Code)
+			assert.Equal(t, tt.expectedDetail, p.Detail)
+			assert.Equal(t, tt.expectedFields, p.Fields)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag formats a version of pack sizes as a strong entity tag
+func versionETag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// parseIfMatch reads the version of pack sizes a client expects from the If-Match header.
+// It returns anyVersion as true for "*", which matches whatever version is stored.
+func parseIfMatch(header string) (version int, anyVersion bool, err error) {
+	header = strings.TrimSpace(header)
+	if header == "*" {
+		return 0, true, nil
+	}
+
+	unquoted, err := strconv.Unquote(header)
+	if err == nil && strings.HasPrefix(header, `"`) {
+		version, err = strconv.Atoi(unquoted)
+	}
+	if err != nil || version < 0 {
+		return 0, false, &requestError{
+			status: http.StatusPreconditionFailed,
+			code:   codePreconditionFailed,
+			field:  "If-Match",
+			err:    fmt.Errorf("If-Match %q is not a pack sizes version entity tag", header),
+		}
+	}
+
+	return version, false, nil
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header     string
+		version    int
+		anyVersion bool
+		expectErr  bool
+	}{
+		{`"3"`, 3, false, false},
+		{` "0" `, 0, false, false},
+		{`*`, 0, true, false},
+		{`3`, 0, false, true},
+		{`W/"3"`, 0, false, true},
+		{`"3", "4"`, 0, false, true},
+		{`"-1"`, 0, false, true},
+		{`"abc"`, 0, false, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			version, anyVersion, err := parseIfMatch(test.header)
+			if test.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.version, version)
+			assert.Equal(t, test.anyVersion, anyVersion)
+		})
+	}
+}
+
+func TestVersionETag(t *testing.T) {
+	assert.Equal(t, `"12"`, versionETag(12))
+}
@@ -0,0 +1,428 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	packsizesv1 "github.com/achere/homework-pack-sizes/internal/proto/packsizes/v1"
+	"go.opentelemetry.io/otel"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// maxBatchOrders bounds the responses of a batch. The orders share a table up to the largest one,
+	// so a batch takes a calculation slot and a rate limit token about as long as a single order does.
+	maxBatchOrders = 1000
+	// errorDomain is the domain of the ErrorInfo details of gRPC errors
+	errorDomain = "pack-sizes"
+
+	// Metadata keys of gRPC calls, the counterparts of the HTTP headers
+	requestIDMetadata     = "x-request-id"
+	authorizationMetadata = "authorization"
+	authorMetadata        = "x-author"
+)
+
+// grpcRoles are the roles required by the methods of the gRPC API when auth is enabled, like routes() for HTTP.
+// Methods that aren't listed, such as reflection, are public.
+var grpcRoles = map[string]pack.Role{
+	packsizesv1.PackSizes_CalculatePacks_FullMethodName:      pack.RoleCalculator,
+	packsizesv1.PackSizes_CalculatePacksBatch_FullMethodName: pack.RoleCalculator,
+	packsizesv1.PackSizes_GetSizes_FullMethodName:            pack.RoleReader,
+	packsizesv1.PackSizes_StoreSizes_FullMethodName:          pack.RoleAdmin,
+}
+
+// grpcCodes map the statuses of problems to the gRPC codes with the same meaning
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.Aborted,
+	http.StatusPreconditionFailed:    codes.Aborted,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnsupportedMediaType:  codes.InvalidArgument,
+	http.StatusPreconditionRequired:  codes.InvalidArgument,
+	http.StatusTooManyRequests:       codes.ResourceExhausted,
+	http.StatusInternalServerError:   codes.Internal,
+	http.StatusServiceUnavailable:    codes.Unavailable,
+}
+
+// NewGRPCServer creates a gRPC server of the PackSizes service in packsizes.proto. It shares the repositories,
+// API keys and limits with the HTTP API, and its calls are logged, traced and measured the same way.
+func (a *App) NewGRPCServer() *grpc.Server {
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(a.interceptUnary),
+		grpc.ChainStreamInterceptor(a.interceptStream),
+	)
+	packsizesv1.RegisterPackSizesServer(s, &grpcService{app: a})
+	// Lets tools such as grpcurl list and call the methods without the .proto file
+	reflection.Register(s)
+
+	return s
+}
+
+func (a *App) interceptUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	var resp any
+	err := a.interceptCall(ctx, info.FullMethod, func(ctx context.Context) (err error) {
+		resp, err = handler(ctx, req)
+		return err
+	})
+	return resp, err
+}
+
+func (a *App) interceptStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return a.interceptCall(ss.Context(), info.FullMethod, func(ctx context.Context) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	})
+}
+
+// interceptCall does for every gRPC call what the middleware of NewRouter() does for HTTP requests:
+// traces it, assigns it a request ID, authorizes it, limits its rate, logs it and measures it.
+// Errors of handle are mapped to gRPC statuses by rpcError().
+func (a *App) interceptCall(ctx context.Context, method string, handle func(context.Context) error) error {
+	start := time.Now()
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	fullName := strings.TrimPrefix(method, "/")
+	service, name, _ := strings.Cut(fullName, "/")
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+	ctx, span := otel.Tracer(tracerName).Start(ctx, fullName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.RPCSystemGRPC, semconv.RPCService(service), semconv.RPCMethod(name)),
+	)
+	defer span.End()
+
+	id := firstMetadata(md, requestIDMetadata)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, id))
+
+	logger := a.logger.With("request_id", id)
+	if span.SpanContext().IsValid() {
+		logger = logger.With("trace_id", span.SpanContext().TraceID().String())
+	}
+	ctx = context.WithValue(ctx, requestIDContextKey{}, id)
+	ctx = context.WithValue(ctx, loggerContextKey{}, logger)
+
+	ctx, err := a.admitCall(ctx, md, method)
+	if err == nil {
+		err = handle(ctx)
+	}
+	err = a.rpcError(ctx, err)
+
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+
+	duration := time.Since(start)
+	a.metrics.calls.WithLabelValues(method, code.String()).Inc()
+	a.metrics.callDuration.WithLabelValues(method, code.String()).Observe(duration.Seconds())
+
+	logger.Info("call",
+		"method", method,
+		"code", code.String(),
+		"duration", duration,
+		"client", peerIP(ctx),
+	)
+
+	return err
+}
+
+// admitCall authorizes the call with the API key in its metadata if the method requires a role,
+// and checks the rate limit of its client. Failed authentications count against the rate limit of the peer,
+// see authenticateLimited(). The key is passed on in the returned context, see contextAPIKey().
+func (a *App) admitCall(ctx context.Context, md metadata.MD, method string) (context.Context, error) {
+	if required, ok := grpcRoles[method]; ok && required != public && a.Config.AuthEnabled {
+		key, err := a.authenticateLimited(peerIP(ctx), func() (pack.APIKey, error) {
+			return a.authorizeBearer(ctx, firstMetadata(md, authorizationMetadata), required)
+		})
+		if err != nil {
+			return ctx, err
+		}
+		ctx = context.WithValue(ctx, apiKeyContextKey{}, key)
+	}
+
+	if a.rateLimiter != nil {
+		if delay, ok := a.rateLimiter.allow(rateLimitClientOf(ctx, peerIP(ctx)), time.Now()); !ok {
+			return ctx, rateLimited(delay)
+		}
+	}
+
+	return ctx, nil
+}
+
+// rpcError logs err and maps it to the gRPC status of the problem it maps to for HTTP.
+// The status has an ErrorInfo detail with the problem code, a BadRequest detail with the fields at fault
+// and a RetryInfo detail if the client may try again later. Errors that are gRPC statuses already are kept.
+func (a *App) rpcError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	method, _ := grpc.Method(ctx)
+	a.loggerFor(ctx).Error(err.Error(), "method", method)
+
+	p := classifyError(err, false)
+	code, ok := grpcCodes[p.Status]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason:   p.Code,
+		Domain:   errorDomain,
+		Metadata: map[string]string{"request_id": contextRequestID(ctx)},
+	}}
+	if len(p.Fields) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, f := range p.Fields {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       f.Field,
+				Description: f.Detail,
+			})
+		}
+		details = append(details, badRequest)
+	}
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.retryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(reqErr.retryAfter)})
+	}
+
+	st := status.New(code, p.Detail)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+
+	return st.Err()
+}
+
+// grpcService implements the PackSizes service with the same pack functions as the v2 handlers
+type grpcService struct {
+	packsizesv1.UnimplementedPackSizesServer
+	app *App
+}
+
+func (s *grpcService) CalculatePacks(
+	ctx context.Context,
+	req *packsizesv1.CalculatePacksRequest,
+) (*packsizesv1.CalculatePacksResponse, error) {
+	asOf, err := asOfTime(req.GetAsOf())
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := s.app.acquireCalculation(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	calc, err := pack.CalculatePacksWithRepo(ctx, s.app.SizeRepo, int(req.GetOrder()), asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	s.app.recordCalculation(ctx, calc)
+
+	return newCalculatePacksResponse(calc), nil
+}
+
+// CalculatePacksBatch takes a single calculation slot for the whole batch, which is calculated with a single table,
+// see pack.CalculatePacksBatchWithRepo()
+func (s *grpcService) CalculatePacksBatch(
+	req *packsizesv1.CalculatePacksBatchRequest,
+	stream grpc.ServerStreamingServer[packsizesv1.CalculatePacksResponse],
+) error {
+	ctx := stream.Context()
+
+	if len(req.GetOrders()) == 0 || len(req.GetOrders()) > maxBatchOrders {
+		return &requestError{
+			status: http.StatusBadRequest,
+			code:   codeInvalidOrder,
+			field:  "orders",
+			err:    fmt.Errorf("between 1 and %d orders are required", maxBatchOrders),
+		}
+	}
+	asOf, err := asOfTime(req.GetAsOf())
+	if err != nil {
+		return err
+	}
+
+	release, err := s.app.acquireCalculation(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	return pack.CalculatePacksBatchWithRepo(ctx, s.app.SizeRepo, toInts(req.GetOrders()), asOf, func(calc pack.Calculation) error {
+		s.app.recordCalculation(ctx, calc)
+		return stream.Send(newCalculatePacksResponse(calc))
+	})
+}
+
+func (s *grpcService) GetSizes(ctx context.Context, req *packsizesv1.GetSizesRequest) (*packsizesv1.GetSizesResponse, error) {
+	set, err := s.app.SizeRepo.GetPackSizes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &packsizesv1.GetSizesResponse{Sizes: toInt64s(set.Sizes), Version: int64(set.Version)}, nil
+}
+
+// StoreSizes requires the version the change is based on, like the If-Match header of storePackSizesHandler()
+func (s *grpcService) StoreSizes(
+	ctx context.Context,
+	req *packsizesv1.StoreSizesRequest,
+) (*packsizesv1.StoreSizesResponse, error) {
+	if req.ExpectedVersion == nil && !req.GetAnyVersion() {
+		return nil, &requestError{
+			status: http.StatusPreconditionRequired,
+			code:   codePreconditionRequired,
+			field:  "expected_version",
+			err:    errors.New("expected_version with the current version of pack sizes or any_version is required"),
+		}
+	}
+
+	// Like changeContext(), the change isn't cancelled when the client goes away
+	changeCtx := pack.WithClientIP(context.WithoutCancel(ctx), peerIP(ctx))
+	sizes := toInts(req.GetSizes())
+
+	var set pack.SizeSet
+	var err error
+	if req.GetAnyVersion() {
+		set, err = pack.SavePackSizes(changeCtx, s.app.SizeRepo, sizes, callAuthor(ctx))
+	} else {
+		set, err = pack.SavePackSizesIfVersion(changeCtx, s.app.SizeRepo, sizes, callAuthor(ctx), int(req.GetExpectedVersion()))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &packsizesv1.StoreSizesResponse{Sizes: toInt64s(set.Sizes), Version: int64(set.Version)}, nil
+}
+
+func newCalculatePacksResponse(calc pack.Calculation) *packsizesv1.CalculatePacksResponse {
+	packs := make(map[int64]int64, len(calc.Packs))
+	for size, count := range calc.Packs {
+		packs[int64(size)] = int64(count)
+	}
+
+	return &packsizesv1.CalculatePacksResponse{
+		Order:   int64(calc.Order),
+		Packs:   packs,
+		Sizes:   toInt64s(calc.Sizes),
+		Version: int64(calc.Version),
+	}
+}
+
+// asOfTime converts as_of of a request, the zero time if it's not set
+func asOfTime(ts *timestamppb.Timestamp) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	if err := ts.CheckValid(); err != nil {
+		return time.Time{}, badRequest("as_of", err)
+	}
+	return ts.AsTime(), nil
+}
+
+// callAuthor returns the identity of whoever makes the call: the name of the API key if it was authorized with one,
+// and the x-author metadata otherwise, like author() for HTTP
+func callAuthor(ctx context.Context) string {
+	if key, ok := contextAPIKey(ctx); ok {
+		return key.Name
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	return firstMetadata(md, authorMetadata)
+}
+
+// peerIP returns the address of the peer making the call
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func firstMetadata(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func toInts(values []int64) []int {
+	ints := make([]int, len(values))
+	for i, v := range values {
+		ints[i] = int(v)
+	}
+	return ints
+}
+
+func toInt64s(values []int) []int64 {
+	ints := make([]int64, len(values))
+	for i, v := range values {
+		ints[i] = int64(v)
+	}
+	return ints
+}
+
+// contextStream passes the context of interceptCall() on to stream handlers
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// metadataCarrier lets the propagator read the trace context of the caller from the call metadata
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	return firstMetadata(metadata.MD(c), key)
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
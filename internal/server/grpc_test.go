@@ -0,0 +1,390 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	packsizesv1 "github.com/achere/homework-pack-sizes/internal/proto/packsizes/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// dialGRPC serves the gRPC API of app on an in-process listener and returns a client connected to it
+func dialGRPC(t *testing.T, app *App) packsizesv1.PackSizesClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := app.NewGRPCServer()
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return packsizesv1.NewPackSizesClient(conn)
+}
+
+// assertStatus checks the code of a gRPC error and the problem code in its ErrorInfo detail
+func assertStatus(t *testing.T, err error, code codes.Code, reason string) *status.Status {
+	t.Helper()
+
+	st, ok := status.FromError(err)
+	require.True(t, ok, "not a gRPC status: %v", err)
+	assert.Equal(t, code, st.Code(), st.Message())
+
+	var info *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*errdetails.ErrorInfo); ok {
+			info = d
+		}
+	}
+	if assert.NotNil(t, info, "no ErrorInfo detail") {
+		assert.Equal(t, reason, info.Reason)
+		assert.Equal(t, errorDomain, info.Domain)
+		assert.NotEmpty(t, info.Metadata["request_id"])
+	}
+
+	return st
+}
+
+// fieldViolations returns the fields of the BadRequest detail of st
+func fieldViolations(st *status.Status) []string {
+	var fields []string
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range d.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	return fields
+}
+
+func TestGRPC_CalculatePacks(t *testing.T) {
+	effective := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var recorded []pack.Calculation
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 2, Sizes: []int{250, 500}}, nil
+		},
+		getPackSizesAt: func(ctx context.Context, at time.Time) (pack.SizeSet, error) {
+			assert.True(t, effective.Equal(at))
+			return pack.SizeSet{Version: 1, Sizes: []int{1000}}, nil
+		},
+	}
+	app.CalcRepo = &CalcRepoStub{
+		storeCalculation: func(ctx context.Context, calc pack.Calculation) error {
+			recorded = append(recorded, calc)
+			return nil
+		},
+	}
+	client := dialGRPC(t, app)
+
+	var header metadata.MD
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDMetadata, "order-42")
+	resp, err := client.CalculatePacks(ctx, &packsizesv1.CalculatePacksRequest{Order: 501}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Equal(t, int64(501), resp.GetOrder())
+	assert.Equal(t, map[int64]int64{250: 1, 500: 1}, resp.GetPacks())
+	assert.Equal(t, []int64{250, 500}, resp.GetSizes())
+	assert.Equal(t, int64(2), resp.GetVersion())
+	assert.Equal(t, []string{"order-42"}, header.Get(requestIDMetadata), "the request ID of the caller is kept")
+	require.Len(t, recorded, 1)
+	assert.Equal(t, 501, recorded[0].Order)
+
+	resp, err = client.CalculatePacks(context.Background(), &packsizesv1.CalculatePacksRequest{
+		Order: 251,
+		AsOf:  timestamppb.New(effective),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int64{1000: 1}, resp.GetPacks())
+	assert.Equal(t, int64(1), resp.GetVersion())
+
+	_, err = client.CalculatePacks(context.Background(), &packsizesv1.CalculatePacksRequest{Order: 0})
+	st := assertStatus(t, err, codes.InvalidArgument, codeInvalidOrder)
+	assert.Equal(t, []string{"order"}, fieldViolations(st))
+
+	_, err = client.CalculatePacks(context.Background(), &packsizesv1.CalculatePacksRequest{
+		Order: 251,
+		AsOf:  &timestamppb.Timestamp{Nanos: -1},
+	})
+	st = assertStatus(t, err, codes.InvalidArgument, codeInvalidRequest)
+	assert.Equal(t, []string{"as_of"}, fieldViolations(st))
+}
+
+func TestGRPC_CalculatePacksBatch(t *testing.T) {
+	gets := 0
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			gets++
+			return pack.SizeSet{Version: 3, Sizes: []int{250, 500}}, nil
+		},
+	}
+	client := dialGRPC(t, app)
+
+	stream, err := client.CalculatePacksBatch(context.Background(), &packsizesv1.CalculatePacksBatchRequest{
+		Orders: []int64{251, 1, 750},
+	})
+	require.NoError(t, err)
+
+	var results []*packsizesv1.CalculatePacksResponse
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		results = append(results, resp)
+	}
+
+	require.Len(t, results, 3)
+	assert.Equal(t, int64(251), results[0].GetOrder())
+	assert.Equal(t, map[int64]int64{500: 1}, results[0].GetPacks())
+	assert.Equal(t, int64(1), results[1].GetOrder())
+	assert.Equal(t, map[int64]int64{250: 1}, results[1].GetPacks())
+	assert.Equal(t, int64(750), results[2].GetOrder())
+	assert.Equal(t, map[int64]int64{250: 1, 500: 1}, results[2].GetPacks())
+	for _, resp := range results {
+		assert.Equal(t, int64(3), resp.GetVersion())
+	}
+	assert.Equal(t, 1, gets, "the pack sizes are fetched once per batch")
+
+	tests := []struct {
+		name   string
+		orders []int64
+		field  string
+	}{
+		{"No orders", nil, "orders"},
+		{"Too many orders", make([]int64, maxBatchOrders+1), "orders"},
+		{"Invalid order", []int64{251, -1}, "order"},
+		{"Order over the maximum", []int64{251, pack.MaxOrder + 1}, "order"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, err := client.CalculatePacksBatch(context.Background(), &packsizesv1.CalculatePacksBatchRequest{
+				Orders: tt.orders,
+			})
+			require.NoError(t, err)
+
+			var received int
+			for {
+				if _, err = stream.Recv(); err != nil {
+					break
+				}
+				received++
+			}
+			st := assertStatus(t, err, codes.InvalidArgument, codeInvalidOrder)
+			assert.Zero(t, received, "nothing is calculated for an invalid batch")
+			assert.Equal(t, []string{tt.field}, fieldViolations(st))
+		})
+	}
+}
+
+func TestGRPC_GetSizes(t *testing.T) {
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 4, Sizes: []int{250, 500}}, nil
+		},
+	}
+	client := dialGRPC(t, app)
+
+	resp, err := client.GetSizes(context.Background(), &packsizesv1.GetSizesRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{250, 500}, resp.GetSizes())
+	assert.Equal(t, int64(4), resp.GetVersion())
+
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{}, pack.ErrUnavailable
+		},
+	}
+	_, err = client.GetSizes(context.Background(), &packsizesv1.GetSizesRequest{})
+	assertStatus(t, err, codes.Unavailable, codeRepoUnavailable)
+}
+
+func TestGRPC_StoreSizes(t *testing.T) {
+	var stored pack.SizeSet
+	var expected int
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		storePackSies: func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+			stored = set
+			set.Version = 5
+			return set, nil
+		},
+		compareAndStorePackSizes: func(ctx context.Context, version int, set pack.SizeSet) (pack.SizeSet, error) {
+			expected, stored = version, set
+			if version != 5 {
+				return pack.SizeSet{}, pack.ErrConflict
+			}
+			set.Version = 6
+			return set, nil
+		},
+	}
+	client := dialGRPC(t, app)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorMetadata, "john")
+
+	_, err := client.StoreSizes(ctx, &packsizesv1.StoreSizesRequest{Sizes: []int64{250}})
+	st := assertStatus(t, err, codes.InvalidArgument, codePreconditionRequired)
+	assert.Equal(t, []string{"expected_version"}, fieldViolations(st))
+
+	resp, err := client.StoreSizes(ctx, &packsizesv1.StoreSizesRequest{Sizes: []int64{250, 500}, AnyVersion: true})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{250, 500}, resp.GetSizes())
+	assert.Equal(t, int64(5), resp.GetVersion())
+	assert.Equal(t, "john", stored.Author)
+
+	version := int64(5)
+	resp, err = client.StoreSizes(ctx, &packsizesv1.StoreSizesRequest{Sizes: []int64{1000}, ExpectedVersion: &version})
+	require.NoError(t, err)
+	assert.Equal(t, 5, expected)
+	assert.Equal(t, int64(6), resp.GetVersion())
+
+	version = 4
+	_, err = client.StoreSizes(ctx, &packsizesv1.StoreSizesRequest{Sizes: []int64{1000}, ExpectedVersion: &version})
+	assertStatus(t, err, codes.Aborted, codeConflict)
+
+	_, err = client.StoreSizes(ctx, &packsizesv1.StoreSizesRequest{Sizes: []int64{0}, AnyVersion: true})
+	st = assertStatus(t, err, codes.InvalidArgument, codeInvalidSize)
+	assert.Equal(t, []string{"sizes"}, fieldViolations(st))
+}
+
+func TestGRPC_Authorize(t *testing.T) {
+	keys := map[string]pack.APIKey{
+		"reader-key":     {ID: 1, Name: "john", Role: pack.RoleReader},
+		"calculator-key": {ID: 2, Name: "joe", Role: pack.RoleCalculator},
+	}
+	var storedAuthor string
+
+	app := NewTestApp()
+	app.Config.AuthEnabled = true
+	app.Config.AdminAPIKey = testAdminAPIKey
+	app.KeyRepo = &KeyRepoStub{
+		getAPIKey: func(ctx context.Context, hash string) (pack.APIKey, error) {
+			for token, key := range keys {
+				if pack.HashAPIKey(token) == hash {
+					key.Hash = hash
+					return key, nil
+				}
+			}
+			return pack.APIKey{}, pack.ErrNotFound
+		},
+	}
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+		storePackSies: func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+			storedAuthor = set.Author
+			set.Version = 2
+			return set, nil
+		},
+	}
+	client := dialGRPC(t, app)
+
+	withKey := func(token string) context.Context {
+		// Ignored in favour of the name of the key
+		ctx := metadata.AppendToOutgoingContext(context.Background(), authorMetadata, "mallory")
+		return metadata.AppendToOutgoingContext(ctx, authorizationMetadata, "Bearer "+token)
+	}
+	store := &packsizesv1.StoreSizesRequest{Sizes: []int64{250}, AnyVersion: true}
+
+	_, err := client.GetSizes(context.Background(), &packsizesv1.GetSizesRequest{})
+	st := assertStatus(t, err, codes.Unauthenticated, codeUnauthenticated)
+	assert.Equal(t, []string{"Authorization"}, fieldViolations(st))
+
+	_, err = client.GetSizes(withKey("unknown-key"), &packsizesv1.GetSizesRequest{})
+	assertStatus(t, err, codes.Unauthenticated, codeUnauthenticated)
+
+	_, err = client.GetSizes(withKey("reader-key"), &packsizesv1.GetSizesRequest{})
+	assert.NoError(t, err)
+
+	_, err = client.CalculatePacks(withKey("reader-key"), &packsizesv1.CalculatePacksRequest{Order: 251})
+	assertStatus(t, err, codes.PermissionDenied, codeForbidden)
+
+	_, err = client.CalculatePacks(withKey("calculator-key"), &packsizesv1.CalculatePacksRequest{Order: 251})
+	assert.NoError(t, err)
+
+	_, err = client.StoreSizes(withKey("calculator-key"), store)
+	assertStatus(t, err, codes.PermissionDenied, codeForbidden)
+	assert.Empty(t, storedAuthor)
+
+	_, err = client.StoreSizes(withKey(testAdminAPIKey), store)
+	assert.NoError(t, err)
+	assert.Equal(t, bootstrapKeyName, storedAuthor)
+}
+
+func TestGRPC_LimitRate(t *testing.T) {
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+	}
+	app.rateLimiter = newClientLimiter(0.5, 1)
+	client := dialGRPC(t, app)
+
+	_, err := client.GetSizes(context.Background(), &packsizesv1.GetSizesRequest{})
+	assert.NoError(t, err)
+
+	_, err = client.GetSizes(context.Background(), &packsizesv1.GetSizesRequest{})
+	st := assertStatus(t, err, codes.ResourceExhausted, codeRateLimited)
+
+	var retry *errdetails.RetryInfo
+	for _, detail := range st.Details() {
+		if d, ok := detail.(*errdetails.RetryInfo); ok {
+			retry = d
+		}
+	}
+	if assert.NotNil(t, retry, "no RetryInfo detail") {
+		assert.InDelta(t, 2*time.Second, retry.RetryDelay.AsDuration(), float64(100*time.Millisecond))
+	}
+}
+
+func TestGRPC_LimitRate_Unauthenticated(t *testing.T) {
+	var lookups int
+
+	app := NewTestApp()
+	app.Config.AuthEnabled = true
+	app.KeyRepo = &KeyRepoStub{
+		getAPIKey: func(ctx context.Context, hash string) (pack.APIKey, error) {
+			lookups++
+			return pack.APIKey{}, pack.ErrNotFound
+		},
+	}
+	app.rateLimiter = newClientLimiter(0.5, 1)
+	client := dialGRPC(t, app)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorizationMetadata, "Bearer invalid-key")
+
+	_, err := client.GetSizes(ctx, &packsizesv1.GetSizesRequest{})
+	assertStatus(t, err, codes.Unauthenticated, codeUnauthenticated)
+
+	_, err = client.GetSizes(ctx, &packsizesv1.GetSizesRequest{})
+	assertStatus(t, err, codes.ResourceExhausted, codeRateLimited)
+	assert.Equal(t, 1, lookups)
+}
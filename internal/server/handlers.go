@@ -1,10 +1,14 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/achere/homework-pack-sizes/internal/pack"
 )
@@ -16,149 +20,885 @@ type calculatePacksRequestV1 struct {
 
 type calculatePacksResponseV1 struct {
 	Packs map[int]int `json:"packs,omitempty"`
-	Error string      `json:"error,omitempty"`
 }
 
 type calculatePacksRequest struct {
-	Order int `json:"order"`
+	Order int       `json:"order"`
+	AsOf  time.Time `json:"as_of"`
 }
 
 type calculatePacksResponse struct {
-	Packs map[int]int `json:"packs,omitempty"`
-	Sizes []int       `json:"sizes,omitempty"`
-	Error string      `json:"error,omitempty"`
+	Packs   map[int]int `json:"packs,omitempty"`
+	Sizes   []int       `json:"sizes,omitempty"`
+	Version int         `json:"version,omitempty"`
 }
 
 type storePackSizesRequest struct {
 	Sizes []int `json:"sizes"`
 }
 
-type storePackSizesResponse struct {
-	Error string `json:"error"`
+type retrievePackSizesResponse struct {
+	Sizes   []int `json:"sizes,omitempty"`
+	Version int   `json:"version,omitempty"`
 }
 
-type retrievePackSizesResponse struct {
-	Sizes []int  `json:"sizes,omitempty"`
-	Error string `json:"error,omitempty"`
+type sizeSet struct {
+	Version        int       `json:"version"`
+	Sizes          []int     `json:"sizes"`
+	Author         string    `json:"author"`
+	CreatedAt      time.Time `json:"created_at"`
+	RolledBackFrom int       `json:"rolled_back_from,omitempty"`
+	EffectiveFrom  time.Time `json:"effective_from"`
+	CancelledAt    time.Time `json:"cancelled_at,omitzero"`
+}
+
+type listPackSizeVersionsResponse struct {
+	Versions []sizeSet `json:"versions"`
+}
+
+type packSizeVersionResponse struct {
+	Version        int       `json:"version,omitempty"`
+	Sizes          []int     `json:"sizes,omitempty"`
+	Author         string    `json:"author,omitempty"`
+	CreatedAt      time.Time `json:"created_at,omitzero"`
+	RolledBackFrom int       `json:"rolled_back_from,omitempty"`
+	EffectiveFrom  time.Time `json:"effective_from,omitzero"`
+	CancelledAt    time.Time `json:"cancelled_at,omitzero"`
+}
+
+func newPackSizeVersionResponse(set pack.SizeSet) packSizeVersionResponse {
+	return packSizeVersionResponse{
+		Version:        set.Version,
+		Sizes:          set.Sizes,
+		Author:         set.Author,
+		CreatedAt:      set.CreatedAt,
+		RolledBackFrom: set.RolledBackFrom,
+		EffectiveFrom:  set.EffectiveFrom,
+		CancelledAt:    set.CancelledAt,
+	}
+}
+
+type schedulePackSizesRequest struct {
+	Sizes         []int     `json:"sizes"`
+	EffectiveFrom time.Time `json:"effective_from"`
+}
+
+type listScheduledPackSizesResponse struct {
+	Scheduled []sizeSet `json:"scheduled"`
+}
+
+type calculation struct {
+	CreatedAt time.Time   `json:"created_at"`
+	Order     int         `json:"order"`
+	Sizes     []int       `json:"sizes"`
+	Packs     map[int]int `json:"packs"`
+	Solver    pack.Solver `json:"solver"`
+	Version   int         `json:"version,omitempty"`
+}
+
+type listCalculationsResponse struct {
+	Calculations []calculation `json:"calculations"`
+}
+
+type auditEntry struct {
+	CreatedAt  time.Time `json:"created_at"`
+	Actor      string    `json:"actor"`
+	ClientIP   string    `json:"client_ip"`
+	OldVersion int       `json:"old_version,omitempty"`
+	OldSizes   []int     `json:"old_sizes"`
+	NewVersion int       `json:"new_version"`
+	NewSizes   []int     `json:"new_sizes"`
+	Cancelled  bool      `json:"cancelled,omitempty"`
+}
+
+type listAuditEntriesResponse struct {
+	Entries []auditEntry `json:"entries"`
+}
+
+// exportDocument is both the response of the export and the request of the import
+type exportDocument struct {
+	FormatVersion int       `json:"format_version"`
+	ExportedAt    time.Time `json:"exported_at"`
+	SizeSets      []sizeSet `json:"size_sets"`
+}
+
+type importConfigResponse struct {
+	DryRun    bool      `json:"dry_run"`
+	OldSizes  []int     `json:"old_sizes"`
+	NewSizes  []int     `json:"new_sizes"`
+	Scheduled []sizeSet `json:"scheduled"`
+	Cancelled []sizeSet `json:"cancelled"`
+	Stored    []sizeSet `json:"stored,omitempty"`
+}
+
+type poolStatsResponse struct {
+	Pool any `json:"pool,omitempty"`
+}
+
+type simulatePackSizesRequest struct {
+	Sizes []int `json:"sizes"`
+	Limit int   `json:"limit"`
+}
+
+type orderChange struct {
+	Order         int         `json:"order"`
+	CurrentPacks  map[int]int `json:"current"`
+	ProposedPacks map[int]int `json:"proposed"`
+	OverfillDelta int         `json:"overfill_delta"`
+	PacksDelta    int         `json:"packs_delta"`
+}
+
+type simulatePackSizesResponse struct {
+	Orders        int           `json:"orders"`
+	Skipped       int           `json:"skipped"`
+	Changes       []orderChange `json:"changes,omitempty"`
+	OverfillDelta int           `json:"overfill_delta"`
+	PacksDelta    int           `json:"packs_delta"`
+}
+
+type recommendPackSizesRequest struct {
+	Histogram map[int]int `json:"histogram"`
+	MaxSizes  int         `json:"max_sizes"`
+}
+
+type recommendPackSizesResponse struct {
+	Sizes       []int   `json:"sizes,omitempty"`
+	AvgOverfill float64 `json:"avg_overfill"`
+	AvgPacks    float64 `json:"avg_packs"`
+}
+
+// apiKey is a stored API key without its hash
+type apiKey struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      pack.Role `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	RevokedAt time.Time `json:"revoked_at,omitzero"`
+}
+
+func newAPIKey(key pack.APIKey) apiKey {
+	return apiKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Role:      key.Role,
+		CreatedAt: key.CreatedAt,
+		RevokedAt: key.RevokedAt,
+	}
+}
+
+type listAPIKeysResponse struct {
+	Keys []apiKey `json:"keys"`
+}
+
+type createAPIKeyRequest struct {
+	Name string    `json:"name"`
+	Role pack.Role `json:"role"`
+}
+
+type createAPIKeyResponse struct {
+	apiKey
+	Key string `json:"key"`
 }
 
 // calculatePacksHandlerV1 provides an JSON interface to calculate pack sizes from the request
 func (a *App) calculatePacksHandlerV1(w http.ResponseWriter, r *http.Request) {
 	var req calculatePacksRequestV1
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(calculatePacksResponseV1{Error: err.Error()})
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
-	packs, err := pack.CalculatePacks(req.Sizes, req.Order)
-	if err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
+	// Duplicate sizes have always been accepted by V1
+	sizes := slices.Compact(slices.Sorted(slices.Values(req.Sizes)))
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(calculatePacksResponseV1{Error: err.Error()})
+	calc, err := pack.Calculate(sizes, req.Order)
+	if err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
+	a.recordCalculation(r.Context(), calc)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(calculatePacksResponseV1{Packs: packs})
+	json.NewEncoder(w).Encode(calculatePacksResponseV1{Packs: calc.Packs})
 }
 
-// calculatePacksHandler provides an JSON interface to calculate pack sizes from SizeRepo
+// calculatePacksHandler provides an JSON interface to calculate pack sizes from SizeRepo.
+// The pack sizes are the ones effective at as_of from the request, or the current ones if it's omitted.
 func (a *App) calculatePacksHandler(w http.ResponseWriter, r *http.Request) {
 	var req calculatePacksRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
-
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(calculatePacksResponse{Error: err.Error()})
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
-	packs, sizes, err := pack.CalculatePacksWithRepo(r.Context(), a.SizeRepo, req.Order)
+	calc, err := pack.CalculatePacksWithRepo(r.Context(), a.SizeRepo, req.Order, req.AsOf)
 	if err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
-
-		w.Header().Set("Content-Type", "application/json")
-		if errors.Is(err, pack.ErrInvalidArg) {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-		}
-		json.NewEncoder(w).Encode(calculatePacksResponse{Error: err.Error()})
+		a.writeError(w, r, err)
 		return
 	}
 
+	a.recordCalculation(r.Context(), calc)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(calculatePacksResponse{Packs: packs, Sizes: sizes})
+	json.NewEncoder(w).Encode(calculatePacksResponse{Packs: calc.Packs, Sizes: calc.Sizes, Version: calc.Version})
 }
 
-// storePackSizesHandler allows to store pack sizes in the SizeRepo
+// storePackSizesHandler allows to store pack sizes in the SizeRepo.
+// It requires the If-Match header with the ETag of the version the change is based on.
 func (a *App) storePackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		a.writeError(w, r, &requestError{
+			status: http.StatusPreconditionRequired,
+			code:   codePreconditionRequired,
+			field:  "If-Match",
+			err:    errors.New("If-Match header with the ETag of the current pack sizes is required"),
+		})
+		return
+	}
+
+	expectedVersion, anyVersion, err := parseIfMatch(ifMatch)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
 	var req storePackSizesRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
 
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(storePackSizesResponse{Error: err.Error()})
+	var set pack.SizeSet
+	if anyVersion {
+		set, err = pack.SavePackSizes(changeContext(r), a.SizeRepo, req.Sizes, author(r))
+	} else {
+		set, err = pack.SavePackSizesIfVersion(changeContext(r), a.SizeRepo, req.Sizes, author(r), expectedVersion)
+	}
+	if err != nil && !anyVersion {
+		a.writeConditionalError(w, r, err)
+		return
+	}
+	if err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
-	err := pack.SavePackSizes(context.Background(), a.SizeRepo, req.Sizes)
+	w.Header().Set("ETag", versionETag(set.Version))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// putPackSizeHandler adds a single size to the current pack sizes in SizeRepo, doing nothing if it's already there
+func (a *App) putPackSizeHandler(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.Atoi(r.PathValue("size"))
 	if err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
+		a.writeError(w, r, badRequest("size", err))
+		return
+	}
+
+	set, err := pack.AddPackSize(changeContext(r), a.SizeRepo, size, author(r))
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.Header().Set("Content-Type", "application/json")
-		if errors.Is(err, pack.ErrInvalidArg) {
-			w.WriteHeader(http.StatusBadRequest)
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(set.Version))
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
+}
+
+// deletePackSizeHandler removes a single size from the current pack sizes in SizeRepo
+func (a *App) deletePackSizeHandler(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.Atoi(r.PathValue("size"))
+	if err != nil {
+		a.writeError(w, r, badRequest("size", err))
+		return
+	}
+
+	set, err := pack.RemovePackSize(changeContext(r), a.SizeRepo, size, author(r))
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(set.Version))
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
+}
+
+// patchPackSizesHandler applies a JSON Patch to the {"sizes": [...]} document of the current pack sizes in SizeRepo.
+// The patch is applied to the latest sizes atomically, the optional If-Match header makes it fail
+// if they have changed since the given version.
+func (a *App) patchPackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType := r.Header.Get("Content-Type"); mediaType != jsonPatchContentType {
+		a.writeError(w, r, &requestError{
+			status: http.StatusUnsupportedMediaType,
+			code:   codeUnsupportedMediaType,
+			field:  "Content-Type",
+			err:    fmt.Errorf("unsupported content type %q, expected %s", mediaType, jsonPatchContentType),
+		})
+		return
+	}
+
+	expectedVersion, anyVersion := 0, true
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		var err error
+		expectedVersion, anyVersion, err = parseIfMatch(ifMatch)
+		if err != nil {
+			a.writeError(w, r, err)
+			return
 		}
-		json.NewEncoder(w).Encode(storePackSizesResponse{Error: err.Error()})
+	}
+
+	var ops []patchOperation
+	if err := a.decodeJSON(w, r, &ops); err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	set, err := pack.UpdatePackSizes(changeContext(r), a.SizeRepo, author(r), func(current pack.SizeSet) ([]int, error) {
+		if !anyVersion && current.Version != expectedVersion {
+			return nil, fmt.Errorf("%w: expected version %d, current is %d", pack.ErrConflict, expectedVersion, current.Version)
+		}
+		return applySizesPatch(current.Sizes, ops)
+	})
+	if err != nil && !anyVersion {
+		a.writeConditionalError(w, r, err)
+		return
+	}
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(set.Version))
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
 }
 
 // retrievePackSizesHandler allows to retrieve pack sizes from SizeRepo
 func (a *App) retrievePackSizesHandler(w http.ResponseWriter, r *http.Request) {
-	sizes, err := a.SizeRepo.GetPackSizes(r.Context())
+	set, err := a.SizeRepo.GetPackSizes(r.Context())
 	if err != nil {
-		a.logger.Error(err.Error(), "url", r.RequestURI)
+		a.writeError(w, r, err)
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(retrievePackSizesResponse{Error: err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", versionETag(set.Version))
+	json.NewEncoder(w).Encode(retrievePackSizesResponse{Sizes: set.Sizes, Version: set.Version})
+}
+
+// listPackSizeVersionsHandler lists all versions of pack sizes in SizeRepo, newest first
+func (a *App) listPackSizeVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	sets, err := a.SizeRepo.GetPackSizeSets(r.Context())
+	if err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
+	resp := listPackSizeVersionsResponse{Versions: make([]sizeSet, 0, len(sets))}
+	for _, s := range sets {
+		resp.Versions = append(resp.Versions, sizeSet(s))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(retrievePackSizesResponse{Sizes: sizes})
+	json.NewEncoder(w).Encode(resp)
 }
 
-// uiHandler handles displating HTML UI
-func (a *App) uiHandler(w http.ResponseWriter, r *http.Request) {
-	sizes, err := a.SizeRepo.GetPackSizes(r.Context())
+// retrievePackSizeVersionHandler allows to retrieve a single version of pack sizes from SizeRepo
+func (a *App) retrievePackSizeVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(r.PathValue("version"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, r, badRequest("version", err))
+		return
+	}
+
+	set, err := a.SizeRepo.GetPackSizeSet(r.Context(), version)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
+}
+
+// rollbackPackSizesHandler makes a previous version of pack sizes current again by saving it as a new version
+func (a *App) rollbackPackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		a.writeError(w, r, badRequest("version", err))
+		return
+	}
+
+	set, err := pack.RollbackPackSizes(changeContext(r), a.SizeRepo, version, author(r))
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
+}
+
+// listScheduledPackSizesHandler lists the versions of pack sizes in SizeRepo that are still to take effect, soonest first
+func (a *App) listScheduledPackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	sets, err := pack.ScheduledPackSizes(r.Context(), a.SizeRepo)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := listScheduledPackSizesResponse{Scheduled: make([]sizeSet, 0, len(sets))}
+	for _, s := range sets {
+		resp.Scheduled = append(resp.Scheduled, sizeSet(s))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// schedulePackSizesHandler saves a new version of pack sizes in SizeRepo that takes effect in the future
+func (a *App) schedulePackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	var req schedulePackSizesRequest
+
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	set, err := pack.SchedulePackSizes(changeContext(r), a.SizeRepo, req.Sizes, author(r), req.EffectiveFrom)
+	if err != nil {
+		a.writeError(w, r, err)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
+}
+
+// cancelScheduledPackSizesHandler cancels a version of pack sizes in SizeRepo that hasn't taken effect yet
+func (a *App) cancelScheduledPackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		a.writeError(w, r, badRequest("version", err))
+		return
+	}
+
+	set, err := a.SizeRepo.CancelPackSizes(changeContext(r), version, author(r))
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newPackSizeVersionResponse(set))
+}
+
+// listCalculationsHandler allows to page through the calculation history in CalcRepo, newest first.
+// Supported query parameters are from and to (RFC 3339), min_order, max_order, limit and offset.
+func (a *App) listCalculationsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseCalculationFilter(r.URL.Query())
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	calcs, err := a.CalcRepo.GetCalculations(r.Context(), filter)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := listCalculationsResponse{Calculations: make([]calculation, 0, len(calcs))}
+	for _, c := range calcs {
+		resp.Calculations = append(resp.Calculations, calculation(c))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseCalculationFilter reads a CalculationFilter from query parameters, applying the default and maximum page size
+func parseCalculationFilter(query url.Values) (pack.CalculationFilter, error) {
+	page, err := parsePage(query, defaultCalculationsPage, maxCalculationsPage)
+	if err != nil {
+		return pack.CalculationFilter{}, err
+	}
+
+	filter := pack.CalculationFilter{From: page.from, To: page.to, Limit: page.limit, Offset: page.offset}
+	if err := parseNonNegative(query, "min_order", &filter.MinOrder); err != nil {
+		return pack.CalculationFilter{}, err
+	}
+	if err := parseNonNegative(query, "max_order", &filter.MaxOrder); err != nil {
+		return pack.CalculationFilter{}, err
+	}
+
+	return filter, nil
+}
+
+// historyPage is the time range and page of a history list shared by all its filters
+type historyPage struct {
+	from, to      time.Time
+	limit, offset int
+}
+
+// parsePage reads the from and to (RFC 3339), limit and offset query parameters. A missing or zero limit
+// means the default page size and larger ones are clamped to the maximum.
+func parsePage(query url.Values, defaultLimit, maxLimit int) (historyPage, error) {
+	var p historyPage
+
+	for _, param := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"from", &p.from},
+		{"to", &p.to},
+	} {
+		if v := query.Get(param.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return historyPage{}, badRequest(param.name, fmt.Errorf("invalid %s: %w", param.name, err))
+			}
+			*param.dst = t
+		}
+	}
+
+	if err := parseNonNegative(query, "limit", &p.limit); err != nil {
+		return historyPage{}, err
+	}
+	if err := parseNonNegative(query, "offset", &p.offset); err != nil {
+		return historyPage{}, err
+	}
+
+	if p.limit == 0 {
+		p.limit = defaultLimit
+	}
+	p.limit = min(p.limit, maxLimit)
+
+	return p, nil
+}
+
+// parseNonNegative reads an optional non-negative integer query parameter into dst, leaving it as is if it's missing
+func parseNonNegative(query url.Values, name string, dst *int) error {
+	v := query.Get(name)
+	if v == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return badRequest(name, fmt.Errorf("invalid %s: %q is not a non-negative integer", name, v))
+	}
+	*dst = n
+
+	return nil
+}
+
+// listAuditEntriesHandler allows to page through the audit log of pack size changes in AuditRepo, newest first.
+// Supported query parameters are from and to (RFC 3339), actor, limit and offset.
+func (a *App) listAuditEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	entries, err := a.AuditRepo.GetAuditEntries(r.Context(), filter)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := listAuditEntriesResponse{Entries: make([]auditEntry, 0, len(entries))}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, auditEntry(e))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// parseAuditFilter reads an AuditFilter from query parameters, applying the default and maximum page size
+func parseAuditFilter(query url.Values) (pack.AuditFilter, error) {
+	page, err := parsePage(query, defaultAuditPage, maxAuditPage)
+	if err != nil {
+		return pack.AuditFilter{}, err
+	}
+
+	return pack.AuditFilter{
+		From:   page.from,
+		To:     page.to,
+		Actor:  query.Get("actor"),
+		Limit:  page.limit,
+		Offset: page.offset,
+	}, nil
+}
+
+// simulatePackSizesHandler replays past orders from CalcRepo against the stored and the proposed pack sizes
+func (a *App) simulatePackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	var req simulatePackSizesRequest
+
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	if req.Limit <= 0 || req.Limit > defaultSimulationOrders {
+		req.Limit = defaultSimulationOrders
+	}
+
+	report, err := pack.SimulatePackSizesWithRepo(
+		r.Context(),
+		a.SizeRepo,
+		a.CalcRepo,
+		req.Sizes,
+		pack.CalculationFilter{Limit: req.Limit},
+	)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := simulatePackSizesResponse{
+		Orders:        report.Orders,
+		Skipped:       report.Skipped,
+		OverfillDelta: report.OverfillDelta,
+		PacksDelta:    report.PacksDelta,
+	}
+	for _, c := range report.Changes {
+		resp.Changes = append(resp.Changes, orderChange(c))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// recommendPackSizesHandler proposes a set of pack sizes from a histogram of historical orders
+func (a *App) recommendPackSizesHandler(w http.ResponseWriter, r *http.Request) {
+	var req recommendPackSizesRequest
+
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	// Every candidate set is scored against the whole histogram, so its length is bounded
+	if len(req.Histogram) > maxHistogramOrders {
+		a.writeError(w, r, &pack.FieldError{
+			Field:  "histogram",
+			Reason: fmt.Sprintf("histogram has more than %d distinct orders", maxHistogramOrders),
+		})
+		return
+	}
+
+	rec, err := pack.RecommendPackSizes(r.Context(), req.Histogram, req.MaxSizes)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recommendPackSizesResponse{
+		Sizes:       rec.Sizes,
+		AvgOverfill: rec.AvgOverfill,
+		AvgPacks:    rec.AvgPacks,
+	})
+}
+
+// exportConfigHandler returns all configuration stored in SizeRepo as a single document
+func (a *App) exportConfigHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := pack.ExportConfig(r.Context(), a.SizeRepo)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := exportDocument{
+		FormatVersion: doc.FormatVersion,
+		ExportedAt:    doc.ExportedAt,
+		SizeSets:      make([]sizeSet, 0, len(doc.SizeSets)),
+	}
+	for _, s := range doc.SizeSets {
+		resp.SizeSets = append(resp.SizeSets, sizeSet(s))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="pack-sizes-export.json"`)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// importConfigHandler makes the configuration in SizeRepo match an exported document and returns the changes.
+// With the dry_run query parameter set to true the changes are only returned.
+func (a *App) importConfigHandler(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			a.writeError(w, r, badRequest("dry_run", fmt.Errorf("invalid dry_run: %w", err)))
+			return
+		}
+	}
+
+	var req exportDocument
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	doc := pack.Export{FormatVersion: req.FormatVersion, ExportedAt: req.ExportedAt}
+	for _, s := range req.SizeSets {
+		doc.SizeSets = append(doc.SizeSets, pack.SizeSet(s))
+	}
+
+	diff, err := pack.ImportConfig(changeContext(r), a.SizeRepo, doc, author(r), dryRun)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := importConfigResponse{
+		DryRun:    dryRun,
+		OldSizes:  nonNilSizes(diff.OldSizes),
+		NewSizes:  nonNilSizes(diff.NewSizes),
+		Scheduled: make([]sizeSet, 0, len(diff.Scheduled)),
+		Cancelled: make([]sizeSet, 0, len(diff.Cancelled)),
+	}
+	for _, s := range diff.Scheduled {
+		resp.Scheduled = append(resp.Scheduled, sizeSet(s))
+	}
+	for _, s := range diff.Cancelled {
+		resp.Cancelled = append(resp.Cancelled, sizeSet(s))
+	}
+	for _, s := range diff.Stored {
+		resp.Stored = append(resp.Stored, sizeSet(s))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// listAPIKeysHandler lists all API keys in KeyRepo including the revoked ones
+func (a *App) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := a.KeyRepo.GetAPIKeys(r.Context())
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	resp := listAPIKeysResponse{Keys: make([]apiKey, 0, len(keys))}
+	for _, k := range keys {
+		resp.Keys = append(resp.Keys, newAPIKey(k))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// createAPIKeyHandler issues a new API key. The key is only returned in this response, KeyRepo stores its hash.
+func (a *App) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+
+	if err := a.decodeJSON(w, r, &req); err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+
+	key, token, err := pack.CreateAPIKey(changeContext(r), a.KeyRepo, req.Name, req.Role)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+	a.loggerFor(r.Context()).Info("API key created", "id", key.ID, "name", key.Name, "role", key.Role, "by", author(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createAPIKeyResponse{apiKey: newAPIKey(key), Key: token})
+}
+
+// revokeAPIKeyHandler revokes an API key in KeyRepo, so it can't be used anymore
+func (a *App) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		a.writeError(w, r, badRequest("id", err))
+		return
+	}
+
+	key, err := a.KeyRepo.RevokeAPIKey(changeContext(r), id)
+	if err != nil {
+		a.writeError(w, r, err)
+		return
+	}
+	a.loggerFor(r.Context()).Info("API key revoked", "id", key.ID, "name", key.Name, "by", author(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newAPIKey(key))
+}
+
+// nonNilSizes makes sure sizes are encoded as a list even if there are none
+func nonNilSizes(sizes []int) []int {
+	if sizes == nil {
+		return []int{}
+	}
+	return sizes
+}
+
+// poolStatsHandler returns statistics of the database connection pool for monitoring
+func (a *App) poolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if a.PoolStats == nil {
+		a.writeError(w, r, &requestError{
+			status: http.StatusNotFound,
+			code:   codeNotFound,
+			err:    errors.New("the storage has no connection pool"),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(poolStatsResponse{Pool: a.PoolStats()})
+}
+
+// openAPIHandler returns the OpenAPI document of the API
+func (a *App) openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// docsHandler displays the interactive documentation of the API from the OpenAPI document
+func (a *App) docsHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeFileFS(w, r, content, "templates/docs.html")
+}
+
+// uiHandler handles displating HTML UI
+// With auth enabled the page is rendered without the pack sizes, which it then loads with an API key.
+func (a *App) uiHandler(w http.ResponseWriter, r *http.Request) {
+	var set pack.SizeSet
+	if !a.Config.AuthEnabled {
+		var err error
+		set, err = a.SizeRepo.GetPackSizes(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	data := struct {
-		Order string
-		Sizes []int
+		Order       string
+		Sizes       []int
+		Version     int
+		AuthEnabled bool
 	}{
-		Order: a.Config.Order,
-		Sizes: sizes,
+		Order:       a.Config.Order,
+		Sizes:       set.Sizes,
+		Version:     set.Version,
+		AuthEnabled: a.Config.AuthEnabled,
 	}
 
 	if err := a.template.Execute(w, data); err != nil {
@@ -4,33 +4,130 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/achere/homework-pack-sizes/internal/pack"
 	"github.com/stretchr/testify/assert"
 )
 
 type SizeRepoStub struct {
-	getPackSizes  func(ctx context.Context) ([]int, error)
-	storePackSies func(ctx context.Context, sizes []int) error
+	getPackSizes    func(ctx context.Context) (pack.SizeSet, error)
+	storePackSies   func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error)
+	getPackSizeSets func(ctx context.Context) ([]pack.SizeSet, error)
+	getPackSizeSet  func(ctx context.Context, version int) (pack.SizeSet, error)
+
+	getNextEffectiveFrom func(ctx context.Context, after time.Time) (time.Time, error)
+
+	compareAndStorePackSizes func(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error)
+	getPackSizesAt           func(ctx context.Context, at time.Time) (pack.SizeSet, error)
+	cancelPackSizes          func(ctx context.Context, version int, author string) (pack.SizeSet, error)
+	updatePackSizes          func(ctx context.Context, author string, update func(pack.SizeSet) ([]int, error)) (pack.SizeSet, error)
+	applyPackSizes           func(ctx context.Context, plan func([]pack.SizeSet) (pack.SizeSetChanges, error)) ([]pack.SizeSet, error)
 }
 
-func (sr *SizeRepoStub) GetPackSizes(ctx context.Context) ([]int, error) {
+func (sr *SizeRepoStub) GetPackSizes(ctx context.Context) (pack.SizeSet, error) {
 	return sr.getPackSizes(ctx)
 }
 
-func (sr *SizeRepoStub) StorePackSizes(ctx context.Context, sizes []int) error {
-	return sr.storePackSies(ctx, sizes)
+func (sr *SizeRepoStub) StorePackSizes(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+	return sr.storePackSies(ctx, set)
+}
+
+func (sr *SizeRepoStub) CompareAndStorePackSizes(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error) {
+	return sr.compareAndStorePackSizes(ctx, expected, set)
+}
+
+func (sr *SizeRepoStub) GetPackSizesAt(ctx context.Context, at time.Time) (pack.SizeSet, error) {
+	return sr.getPackSizesAt(ctx, at)
+}
+
+func (sr *SizeRepoStub) UpdatePackSizes(
+	ctx context.Context,
+	author string,
+	update func(pack.SizeSet) ([]int, error),
+) (pack.SizeSet, error) {
+	return sr.updatePackSizes(ctx, author, update)
+}
+
+func (sr *SizeRepoStub) ApplyPackSizes(
+	ctx context.Context,
+	plan func([]pack.SizeSet) (pack.SizeSetChanges, error),
+) ([]pack.SizeSet, error) {
+	return sr.applyPackSizes(ctx, plan)
+}
+
+func (sr *SizeRepoStub) CancelPackSizes(ctx context.Context, version int, author string) (pack.SizeSet, error) {
+	return sr.cancelPackSizes(ctx, version, author)
+}
+
+func (sr *SizeRepoStub) GetPackSizeSets(ctx context.Context) ([]pack.SizeSet, error) {
+	return sr.getPackSizeSets(ctx)
+}
+
+func (sr *SizeRepoStub) GetPackSizeSet(ctx context.Context, version int) (pack.SizeSet, error) {
+	return sr.getPackSizeSet(ctx, version)
+}
+
+func (sr *SizeRepoStub) GetNextEffectiveFrom(ctx context.Context, after time.Time) (time.Time, error) {
+	return sr.getNextEffectiveFrom(ctx, after)
+}
+
+type CalcRepoStub struct {
+	storeCalculation func(ctx context.Context, calc pack.Calculation) error
+	getCalculations  func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error)
+}
+
+func (cr *CalcRepoStub) StoreCalculation(ctx context.Context, calc pack.Calculation) error {
+	return cr.storeCalculation(ctx, calc)
+}
+
+func (cr *CalcRepoStub) GetCalculations(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+	return cr.getCalculations(ctx, filter)
+}
+
+type AuditRepoStub struct {
+	getAuditEntries func(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error)
+}
+
+func (ar *AuditRepoStub) GetAuditEntries(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error) {
+	return ar.getAuditEntries(ctx, filter)
+}
+
+type KeyRepoStub struct {
+	storeAPIKey  func(ctx context.Context, key pack.APIKey) (pack.APIKey, error)
+	getAPIKey    func(ctx context.Context, hash string) (pack.APIKey, error)
+	getAPIKeys   func(ctx context.Context) ([]pack.APIKey, error)
+	revokeAPIKey func(ctx context.Context, id int) (pack.APIKey, error)
+}
+
+func (kr *KeyRepoStub) StoreAPIKey(ctx context.Context, key pack.APIKey) (pack.APIKey, error) {
+	return kr.storeAPIKey(ctx, key)
+}
+
+func (kr *KeyRepoStub) GetAPIKey(ctx context.Context, hash string) (pack.APIKey, error) {
+	return kr.getAPIKey(ctx, hash)
+}
+
+func (kr *KeyRepoStub) GetAPIKeys(ctx context.Context) ([]pack.APIKey, error) {
+	return kr.getAPIKeys(ctx)
+}
+
+func (kr *KeyRepoStub) RevokeAPIKey(ctx context.Context, id int) (pack.APIKey, error) {
+	return kr.revokeAPIKey(ctx, id)
 }
 
 func TestCalculatePacksHandler(t *testing.T) {
 	app := NewTestApp()
 	app.SizeRepo = &SizeRepoStub{
-		getPackSizes: func(ctx context.Context) ([]int, error) {
-			return []int{250, 500, 1000, 2000, 5000}, nil
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500, 1000, 2000, 5000}}, nil
 		},
 	}
 
@@ -40,6 +137,7 @@ func TestCalculatePacksHandler(t *testing.T) {
 		expectedStatus int
 		expectedPacks  map[int]int
 		expectedError  bool
+		expectedCode   string
 	}{
 		{
 			name:           "Valid request",
@@ -53,18 +151,21 @@ func TestCalculatePacksHandler(t *testing.T) {
 			requestBody:    `{"order": -12500}`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  true,
+			expectedCode:   codeInvalidOrder,
 		},
 		{
 			name:           "Invalid JSON",
 			requestBody:    `{"order": "251"}`,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  true,
+			expectedCode:   codeInvalidRequest,
 		},
 		{
 			name:           "Empty body",
 			requestBody:    ``,
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  true,
+			expectedCode:   codeInvalidRequest,
 		},
 	}
 
@@ -73,23 +174,22 @@ func TestCalculatePacksHandler(t *testing.T) {
 			body := bytes.NewBufferString(test.requestBody)
 			req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", body)
 			req.Header.Set("Content-Type", "application/json")
-			rr := httptest.NewRecorder()
 
-			app.calculatePacksHandler(rr, req)
+			rr := serve(t, app, req)
 
 			assert.Equal(t, test.expectedStatus, rr.Code)
 
-			var resp calculatePacksResponseV1
+			var resp calculatePacksResponse
 			err := json.Unmarshal(rr.Body.Bytes(), &resp)
 			assert.NoError(t, err)
 
 			if test.expectedError {
-				assert.NotEmpty(t, resp.Error)
+				p := assertProblem(t, rr)
+				assert.Equal(t, test.expectedCode, p.Code)
 				assert.Empty(t, resp.Packs)
 			} else {
-
-				assert.Empty(t, resp.Error)
 				assert.Equal(t, test.expectedPacks, resp.Packs)
+				assert.Equal(t, 1, resp.Version)
 			}
 		})
 	}
@@ -112,6 +212,13 @@ func TestCalculatePacksHandlerV1(t *testing.T) {
 			expectedPacks:  map[int]int{5000: 2, 2000: 1, 500: 1},
 			expectedError:  false,
 		},
+		{
+			name:           "Duplicate sizes",
+			requestBody:    `{"sizes": [5000, 250, 500, 1000, 2000, 5000, 250], "order": 12500}`,
+			expectedStatus: http.StatusOK,
+			expectedPacks:  map[int]int{5000: 2, 2000: 1, 500: 1},
+			expectedError:  false,
+		},
 		{
 			name:           "Negative order",
 			requestBody:    `{"sizes": [250, 500, 1000, 2000, 5000], "order": -12500}`,
@@ -143,9 +250,8 @@ func TestCalculatePacksHandlerV1(t *testing.T) {
 			body := bytes.NewBufferString(test.requestBody)
 			req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate-packs", body)
 			req.Header.Set("Content-Type", "application/json")
-			rr := httptest.NewRecorder()
 
-			app.calculatePacksHandlerV1(rr, req)
+			rr := serve(t, app, req)
 
 			assert.Equal(t, test.expectedStatus, rr.Code)
 
@@ -154,11 +260,10 @@ func TestCalculatePacksHandlerV1(t *testing.T) {
 			assert.NoError(t, err)
 
 			if test.expectedError {
-				assert.NotEmpty(t, resp.Error)
+				assertProblem(t, rr)
 				assert.Empty(t, resp.Packs)
 			} else {
 
-				assert.Empty(t, resp.Error)
 				assert.Equal(t, test.expectedPacks, resp.Packs)
 			}
 		})
@@ -168,33 +273,47 @@ func TestCalculatePacksHandlerV1(t *testing.T) {
 func TestUIHandler_Success(t *testing.T) {
 	app := NewTestApp()
 	app.SizeRepo = &SizeRepoStub{
-		getPackSizes: func(ctx context.Context) ([]int, error) {
-			return []int{250, 500, 1000, 2000, 5000}, nil
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500, 1000, 2000, 5000}}, nil
 		},
 	}
 	app.template, _ = template.ParseFS(content, "templates/index.html")
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	rr := httptest.NewRecorder()
 
-	app.uiHandler(rr, req)
+	rr := serve(t, app, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Contains(t, rr.Body.String(), "<title>Pack Calculator</title>")
 }
 
+func TestUIHandler_AuthEnabled(t *testing.T) {
+	app := NewTestApp()
+	app.Config.AuthEnabled = true
+	// The sizes are loaded by the page with an API key, so SizeRepo isn't used
+	app.SizeRepo = &SizeRepoStub{}
+	app.template, _ = template.ParseFS(content, "templates/index.html")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `id="change-key"`)
+}
+
 func TestRetrievePackSizesHandler(t *testing.T) {
 	tests := []struct {
 		name           string
-		getPackSizes   func(ctx context.Context) ([]int, error)
+		getPackSizes   func(ctx context.Context) (pack.SizeSet, error)
 		expectedStatus int
 		expectedSizes  []int
 		expectedError  bool
 	}{
 		{
 			name: "Success",
-			getPackSizes: func(ctx context.Context) ([]int, error) {
-				return []int{250, 500, 1000}, nil
+			getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+				return pack.SizeSet{Version: 1, Sizes: []int{250, 500, 1000}}, nil
 			},
 			expectedStatus: http.StatusOK,
 			expectedSizes:  []int{250, 500, 1000},
@@ -202,13 +321,22 @@ func TestRetrievePackSizesHandler(t *testing.T) {
 		},
 		{
 			name: "Error from repo",
-			getPackSizes: func(ctx context.Context) ([]int, error) {
-				return nil, assert.AnError
+			getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+				return pack.SizeSet{}, assert.AnError
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectedSizes:  nil,
 			expectedError:  true,
 		},
+		{
+			name: "Repo unavailable",
+			getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+				return pack.SizeSet{}, fmt.Errorf("%w: %w", pack.ErrUnavailable, assert.AnError)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedSizes:  nil,
+			expectedError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -219,9 +347,8 @@ func TestRetrievePackSizesHandler(t *testing.T) {
 			}
 
 			req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
-			rr := httptest.NewRecorder()
 
-			app.retrievePackSizesHandler(rr, req)
+			rr := serve(t, app, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
 
@@ -230,11 +357,12 @@ func TestRetrievePackSizesHandler(t *testing.T) {
 			assert.NoError(t, err)
 
 			if tt.expectedError {
-				assert.NotEmpty(t, resp.Error)
+				assertProblem(t, rr)
 				assert.Nil(t, resp.Sizes)
 			} else {
-				assert.Empty(t, resp.Error)
 				assert.Equal(t, tt.expectedSizes, resp.Sizes)
+				assert.Equal(t, 1, resp.Version)
+				assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
 			}
 		})
 	}
@@ -242,44 +370,105 @@ func TestRetrievePackSizesHandler(t *testing.T) {
 
 func TestStorePackSizesHandler(t *testing.T) {
 	tests := []struct {
-		name           string
-		requestBody    string
-		storePackSies  func(ctx context.Context, sizes []int) error
-		expectedStatus int
-		expectError    bool
+		name                     string
+		requestBody              string
+		ifMatch                  string
+		storePackSies            func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error)
+		compareAndStorePackSizes func(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error)
+		expectedStatus           int
+		expectedETag             string
+		expectError              bool
 	}{
 		{
 			name:        "Success",
 			requestBody: `{"sizes": [250, 500, 1000]}`,
-			storePackSies: func(ctx context.Context, sizes []int) error {
-				assert.Equal(t, []int{250, 500, 1000}, sizes)
-				return nil
+			ifMatch:     `"1"`,
+			compareAndStorePackSizes: func(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error) {
+				assert.Equal(t, 1, expected)
+				assert.Equal(t, []int{250, 500, 1000}, set.Sizes)
+				assert.Equal(t, "jane", set.Author)
+				assert.Equal(t, "192.0.2.1", pack.ClientIP(ctx), "client address is recorded in the audit log")
+				assert.NotEmpty(t, contextRequestID(ctx), "values of the request context are kept")
+				return pack.SizeSet{Version: 2, Sizes: set.Sizes, Author: set.Author}, nil
+			},
+			expectedStatus: http.StatusNoContent,
+			expectedETag:   `"2"`,
+		},
+		{
+			name:        "Any version",
+			requestBody: `{"sizes": [250, 500, 1000]}`,
+			ifMatch:     `*`,
+			storePackSies: func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+				assert.Equal(t, []int{250, 500, 1000}, set.Sizes)
+				return pack.SizeSet{Version: 5, Sizes: set.Sizes, Author: set.Author}, nil
 			},
 			expectedStatus: http.StatusNoContent,
+			expectedETag:   `"5"`,
+		},
+		{
+			name:           "Missing If-Match",
+			requestBody:    `{"sizes": [250, 500, 1000]}`,
+			expectedStatus: http.StatusPreconditionRequired,
+			expectError:    true,
+		},
+		{
+			name:           "Malformed If-Match",
+			requestBody:    `{"sizes": [250, 500, 1000]}`,
+			ifMatch:        `W/"1"`,
+			expectedStatus: http.StatusPreconditionFailed,
+			expectError:    true,
 		},
 		{
-			name:        "Invalid JSON",
-			requestBody: `{"sizes": ["250", 500, 1000]}`,
-			storePackSies: func(ctx context.Context, sizes []int) error {
-				return nil
+			name:        "Version conflict",
+			requestBody: `{"sizes": [250, 500, 1000]}`,
+			ifMatch:     `"1"`,
+			compareAndStorePackSizes: func(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error) {
+				return pack.SizeSet{}, pack.ErrConflict
 			},
+			expectedStatus: http.StatusPreconditionFailed,
+			expectError:    true,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    `{"sizes": ["250", 500, 1000]}`,
+			ifMatch:        `"1"`,
 			expectedStatus: http.StatusBadRequest,
 			expectError:    true,
 		},
 		{
-			name:        "Empty body",
-			requestBody: ``,
-			storePackSies: func(ctx context.Context, sizes []int) error {
-				return nil
-			},
+			name:           "Empty body",
+			requestBody:    ``,
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Unknown field",
+			requestBody:    `{"sizes": [250, 500, 1000], "size": [2000]}`,
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Duplicate sizes",
+			requestBody:    `{"sizes": [250, 500, 250]}`,
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusBadRequest,
+			expectError:    true,
+		},
+		{
+			name:           "Too large size",
+			requestBody:    `{"sizes": [250, 500, 1000001]}`,
+			ifMatch:        `"1"`,
 			expectedStatus: http.StatusBadRequest,
 			expectError:    true,
 		},
 		{
 			name:        "Error from repo",
 			requestBody: `{"sizes": [250, 500, 1000]}`,
-			storePackSies: func(ctx context.Context, sizes []int) error {
-				return assert.AnError
+			ifMatch:     `"1"`,
+			compareAndStorePackSizes: func(ctx context.Context, expected int, set pack.SizeSet) (pack.SizeSet, error) {
+				return pack.SizeSet{}, assert.AnError
 			},
 			expectedStatus: http.StatusInternalServerError,
 			expectError:    true,
@@ -290,33 +479,1266 @@ func TestStorePackSizesHandler(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			app := NewTestApp()
 			app.SizeRepo = &SizeRepoStub{
-				storePackSies: tt.storePackSies,
+				storePackSies:            tt.storePackSies,
+				compareAndStorePackSizes: tt.compareAndStorePackSizes,
 			}
 
 			body := bytes.NewBufferString(tt.requestBody)
 			req := httptest.NewRequest(http.MethodPost, "/api/v2/sizes", body)
 			req.Header.Set("Content-Type", "application/json")
-			rr := httptest.NewRecorder()
+			req.Header.Set(authorHeader, "jane")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
 
-			app.storePackSizesHandler(rr, req)
+			rr := serve(t, app, req)
 
 			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, tt.expectedETag, rr.Header().Get("ETag"))
 
 			if tt.expectError {
-				var resp storePackSizesResponse
-				err := json.Unmarshal(rr.Body.Bytes(), &resp)
-				assert.NoError(t, err)
-				assert.NotEmpty(t, resp.Error)
+				assertProblem(t, rr)
+			}
+		})
+	}
+}
+
+func TestCalculatePacksHandler_RecordsCalculation(t *testing.T) {
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+	}
+
+	var recorded []pack.Calculation
+	app.CalcRepo = &CalcRepoStub{
+		storeCalculation: func(ctx context.Context, calc pack.Calculation) error {
+			recorded = append(recorded, calc)
+			return assert.AnError
+		},
+	}
+
+	body := bytes.NewBufferString(`{"order": 251}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", body)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "failing to record must not fail the calculation")
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, 251, recorded[0].Order)
+		assert.Equal(t, []int{250, 500}, recorded[0].Sizes)
+		assert.Equal(t, map[int]int{500: 1}, recorded[0].Packs)
+		assert.Equal(t, pack.SolverDP, recorded[0].Solver)
+		assert.Equal(t, 1, recorded[0].Version)
+		assert.False(t, recorded[0].CreatedAt.IsZero())
+	}
+}
+
+func TestListPackSizeVersionsHandler(t *testing.T) {
+	createdAt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		getPackSizeSets  func(ctx context.Context) ([]pack.SizeSet, error)
+		expectedStatus   int
+		expectedVersions []sizeSet
+		expectedError    bool
+	}{
+		{
+			name: "Success",
+			getPackSizeSets: func(ctx context.Context) ([]pack.SizeSet, error) {
+				return []pack.SizeSet{
+					{Version: 2, Sizes: []int{250}, Author: "jane", CreatedAt: createdAt, RolledBackFrom: 1},
+					{Version: 1, Sizes: []int{250}, Author: "john", CreatedAt: createdAt},
+				}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expectedVersions: []sizeSet{
+				{Version: 2, Sizes: []int{250}, Author: "jane", CreatedAt: createdAt, RolledBackFrom: 1},
+				{Version: 1, Sizes: []int{250}, Author: "john", CreatedAt: createdAt},
+			},
+		},
+		{
+			name: "Error from repo",
+			getPackSizeSets: func(ctx context.Context) ([]pack.SizeSet, error) {
+				return nil, assert.AnError
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.SizeRepo = &SizeRepoStub{
+				getPackSizeSets: tt.getPackSizeSets,
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes/versions", nil)
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp listPackSizeVersionsResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedError {
+				assertProblem(t, rr)
+				assert.Empty(t, resp.Versions)
+			} else {
+				assert.Equal(t, tt.expectedVersions, resp.Versions)
+			}
+		})
+	}
+}
+
+func TestPackSizeVersionHandlers(t *testing.T) {
+	repo := &SizeRepoStub{
+		getPackSizeSet: func(ctx context.Context, version int) (pack.SizeSet, error) {
+			if version != 1 {
+				return pack.SizeSet{}, pack.ErrNotFound
+			}
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}, Author: "john"}, nil
+		},
+		storePackSies: func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+			set.Version = 3
+			return set, nil
+		},
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		expectedStatus  int
+		expectedVersion *packSizeVersionResponse
+	}{
+		{
+			name:            "Get version",
+			method:          http.MethodGet,
+			path:            "/api/v2/sizes/versions/1",
+			expectedStatus:  http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{Version: 1, Sizes: []int{250, 500}, Author: "john"},
+		},
+		{
+			name:           "Get unknown version",
+			method:         http.MethodGet,
+			path:           "/api/v2/sizes/versions/2",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "Get invalid version",
+			method:         http.MethodGet,
+			path:           "/api/v2/sizes/versions/latest",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "Rollback",
+			method:          http.MethodPost,
+			path:            "/api/v2/sizes/versions/1/rollback",
+			expectedStatus:  http.StatusCreated,
+			expectedVersion: &packSizeVersionResponse{Version: 3, Sizes: []int{250, 500}, Author: "jane", RolledBackFrom: 1},
+		},
+		{
+			name:           "Rollback unknown version",
+			method:         http.MethodPost,
+			path:           "/api/v2/sizes/versions/2/rollback",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.SizeRepo = repo
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set(authorHeader, "jane")
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp packSizeVersionResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedVersion == nil {
+				assertProblem(t, rr)
+			} else {
+				assert.Equal(t, *tt.expectedVersion, resp)
+			}
+		})
+	}
+}
+
+func TestGranularPackSizeHandlers(t *testing.T) {
+	repo := &SizeRepoStub{
+		updatePackSizes: func(ctx context.Context, author string, update func(pack.SizeSet) ([]int, error)) (pack.SizeSet, error) {
+			current := pack.SizeSet{Version: 2, Sizes: []int{250, 500}, Author: "john"}
+			sizes, err := update(current)
+			if err != nil {
+				return pack.SizeSet{}, err
+			}
+			if slices.Equal(sizes, current.Sizes) {
+				return current, nil
+			}
+			return pack.SizeSet{Version: 3, Sizes: sizes, Author: author}, nil
+		},
+	}
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		contentType     string
+		ifMatch         string
+		requestBody     string
+		expectedStatus  int
+		expectedVersion *packSizeVersionResponse
+	}{
+		{
+			name:            "Put size",
+			method:          http.MethodPut,
+			path:            "/api/v2/sizes/1000",
+			expectedStatus:  http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{Version: 3, Sizes: []int{250, 500, 1000}, Author: "jane"},
+		},
+		{
+			name:            "Put existing size",
+			method:          http.MethodPut,
+			path:            "/api/v2/sizes/500",
+			expectedStatus:  http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{Version: 2, Sizes: []int{250, 500}, Author: "john"},
+		},
+		{
+			name:           "Put invalid size",
+			method:         http.MethodPut,
+			path:           "/api/v2/sizes/0",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Put malformed size",
+			method:         http.MethodPut,
+			path:           "/api/v2/sizes/large",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:            "Delete size",
+			method:          http.MethodDelete,
+			path:            "/api/v2/sizes/250",
+			expectedStatus:  http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{Version: 3, Sizes: []int{500}, Author: "jane"},
+		},
+		{
+			name:           "Delete unknown size",
+			method:         http.MethodDelete,
+			path:           "/api/v2/sizes/1000",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:            "Patch",
+			method:          http.MethodPatch,
+			path:            "/api/v2/sizes",
+			contentType:     jsonPatchContentType,
+			ifMatch:         `"2"`,
+			requestBody:     `[{"op": "test", "path": "/sizes/0", "value": 250}, {"op": "replace", "path": "/sizes/0", "value": 1000}]`,
+			expectedStatus:  http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{Version: 3, Sizes: []int{500, 1000}, Author: "jane"},
+		},
+		{
+			name:            "Patch without If-Match",
+			method:          http.MethodPatch,
+			path:            "/api/v2/sizes",
+			contentType:     jsonPatchContentType,
+			requestBody:     `[{"op": "add", "path": "/sizes/-", "value": 100}]`,
+			expectedStatus:  http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{Version: 3, Sizes: []int{100, 250, 500}, Author: "jane"},
+		},
+		{
+			name:           "Patch stale version",
+			method:         http.MethodPatch,
+			path:           "/api/v2/sizes",
+			contentType:    jsonPatchContentType,
+			ifMatch:        `"1"`,
+			requestBody:    `[{"op": "add", "path": "/sizes/-", "value": 100}]`,
+			expectedStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:           "Patch failed test",
+			method:         http.MethodPatch,
+			path:           "/api/v2/sizes",
+			contentType:    jsonPatchContentType,
+			requestBody:    `[{"op": "test", "path": "/sizes", "value": [250]}]`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Patch duplicate sizes",
+			method:         http.MethodPatch,
+			path:           "/api/v2/sizes",
+			contentType:    jsonPatchContentType,
+			requestBody:    `[{"op": "copy", "from": "/sizes/0", "path": "/sizes/-"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Patch invalid operation",
+			method:         http.MethodPatch,
+			path:           "/api/v2/sizes",
+			contentType:    jsonPatchContentType,
+			requestBody:    `[{"op": "merge", "path": "/sizes"}]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Patch wrong content type",
+			method:         http.MethodPatch,
+			path:           "/api/v2/sizes",
+			contentType:    "application/json",
+			requestBody:    `[{"op": "add", "path": "/sizes/-", "value": 100}]`,
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.SizeRepo = repo
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set(authorHeader, "jane")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp packSizeVersionResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedVersion == nil {
+				assertProblem(t, rr)
+			} else {
+				assert.Equal(t, *tt.expectedVersion, resp)
+				assert.Equal(t, versionETag(tt.expectedVersion.Version), rr.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestScheduledPackSizesHandlers(t *testing.T) {
+	effectiveFrom := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	cancelledAt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	repo := &SizeRepoStub{
+		getPackSizeSets: func(ctx context.Context) ([]pack.SizeSet, error) {
+			return []pack.SizeSet{
+				{Version: 3, Sizes: []int{500}, Author: "jane", EffectiveFrom: effectiveFrom},
+				{Version: 2, Sizes: []int{1000}, Author: "jane", EffectiveFrom: effectiveFrom, CancelledAt: cancelledAt},
+				{Version: 1, Sizes: []int{250, 500}, Author: "john"},
+			}, nil
+		},
+		storePackSies: func(ctx context.Context, set pack.SizeSet) (pack.SizeSet, error) {
+			set.Version = 4
+			return set, nil
+		},
+		cancelPackSizes: func(ctx context.Context, version int, author string) (pack.SizeSet, error) {
+			switch version {
+			case 3:
+				assert.Equal(t, "jane", author)
+				return pack.SizeSet{Version: 3, Sizes: []int{500}, Author: "jane", EffectiveFrom: effectiveFrom, CancelledAt: cancelledAt}, nil
+			case 1:
+				return pack.SizeSet{}, pack.ErrConflict
+			default:
+				return pack.SizeSet{}, pack.ErrNotFound
 			}
+		},
+	}
+
+	t.Run("List", func(t *testing.T) {
+		app := NewTestApp()
+		app.SizeRepo = repo
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes/scheduled", nil)
+
+		rr := serve(t, app, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var resp listScheduledPackSizesResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+		assert.Equal(t, []sizeSet{
+			{Version: 3, Sizes: []int{500}, Author: "jane", EffectiveFrom: effectiveFrom},
+		}, resp.Scheduled)
+	})
+
+	tests := []struct {
+		name            string
+		method          string
+		path            string
+		requestBody     string
+		ifMatch         string
+		expectedStatus  int
+		expectedVersion *packSizeVersionResponse
+	}{
+		{
+			name:            "Schedule",
+			method:          http.MethodPost,
+			path:            "/api/v2/sizes/scheduled",
+			requestBody:     `{"sizes": [500], "effective_from": "` + effectiveFrom.Format(time.RFC3339) + `"}`,
+			expectedStatus:  http.StatusCreated,
+			expectedVersion: &packSizeVersionResponse{Version: 4, Sizes: []int{500}, Author: "jane", EffectiveFrom: effectiveFrom},
+		},
+		{
+			name:           "Schedule in the past",
+			method:         http.MethodPost,
+			path:           "/api/v2/sizes/scheduled",
+			requestBody:    `{"sizes": [500], "effective_from": "2020-01-01T00:00:00Z"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Schedule without effective from",
+			method:         http.MethodPost,
+			path:           "/api/v2/sizes/scheduled",
+			requestBody:    `{"sizes": [500]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Cancel",
+			method:         http.MethodDelete,
+			path:           "/api/v2/sizes/scheduled/3",
+			expectedStatus: http.StatusOK,
+			expectedVersion: &packSizeVersionResponse{
+				Version:       3,
+				Sizes:         []int{500},
+				Author:        "jane",
+				EffectiveFrom: effectiveFrom,
+				CancelledAt:   cancelledAt,
+			},
+		},
+		{
+			name:           "Cancel effective version",
+			method:         http.MethodDelete,
+			path:           "/api/v2/sizes/scheduled/1",
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Cancel effective version with a stray If-Match",
+			method:         http.MethodDelete,
+			path:           "/api/v2/sizes/scheduled/1",
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "Cancel unknown version",
+			method:         http.MethodDelete,
+			path:           "/api/v2/sizes/scheduled/5",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.SizeRepo = repo
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(authorHeader, "jane")
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp packSizeVersionResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedVersion == nil {
+				assertProblem(t, rr)
+			} else {
+				assert.Equal(t, *tt.expectedVersion, resp)
+			}
+		})
+	}
+}
+
+func TestCalculatePacksHandler_AsOf(t *testing.T) {
+	asOf := time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizesAt: func(ctx context.Context, at time.Time) (pack.SizeSet, error) {
+			assert.True(t, asOf.Equal(at), "as of %s", at)
+			return pack.SizeSet{Version: 3, Sizes: []int{500, 1000}}, nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", bytes.NewBufferString(`{"order": 251, "as_of": "2025-11-01T00:00:00Z"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp calculatePacksResponse
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, calculatePacksResponse{Packs: map[int]int{500: 1}, Sizes: []int{500, 1000}, Version: 3}, resp)
+}
+
+func TestCalculatePacksHandlerV1_RecordsCalculation(t *testing.T) {
+	app := NewTestApp()
+
+	var recorded []pack.Calculation
+	app.CalcRepo = &CalcRepoStub{
+		storeCalculation: func(ctx context.Context, calc pack.Calculation) error {
+			recorded = append(recorded, calc)
+			return nil
+		},
+	}
+
+	body := bytes.NewBufferString(`{"sizes": [500, 250], "order": 251}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/calculate-packs", body)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.Len(t, recorded, 1) {
+		assert.Equal(t, 251, recorded[0].Order)
+		assert.Equal(t, []int{250, 500}, recorded[0].Sizes)
+		assert.Equal(t, map[int]int{500: 1}, recorded[0].Packs)
+	}
+}
+
+func TestListCalculationsHandler(t *testing.T) {
+	createdAt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedFilter  pack.CalculationFilter
+		getCalculations func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error)
+		expectedStatus  int
+		expectedError   bool
+	}{
+		{
+			name:           "Defaults",
+			query:          "",
+			expectedFilter: pack.CalculationFilter{Limit: defaultCalculationsPage},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "All filters",
+			query: "?from=2025-07-01T00:00:00Z&to=2025-07-02T00:00:00Z&min_order=100&max_order=1000&limit=10&offset=20",
+			expectedFilter: pack.CalculationFilter{
+				From:     time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+				To:       time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC),
+				MinOrder: 100,
+				MaxOrder: 1000,
+				Limit:    10,
+				Offset:   20,
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Limit above maximum",
+			query:          "?limit=100000",
+			expectedFilter: pack.CalculationFilter{Limit: maxCalculationsPage},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Zero limit",
+			query:          "?limit=0",
+			expectedFilter: pack.CalculationFilter{Limit: defaultCalculationsPage},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid date",
+			query:          "?from=yesterday",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:           "Negative offset",
+			query:          "?offset=-1",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:  "Error from repo",
+			query: "",
+			getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+				return nil, assert.AnError
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.CalcRepo = &CalcRepoStub{
+				getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+					if tt.getCalculations != nil {
+						return tt.getCalculations(ctx, filter)
+					}
+					assert.Equal(t, tt.expectedFilter, filter)
+					return []pack.Calculation{
+						{CreatedAt: createdAt, Order: 251, Sizes: []int{250, 500}, Packs: map[int]int{500: 1}, Solver: pack.SolverDP},
+					}, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/calculations"+tt.query, nil)
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp listCalculationsResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedError {
+				assertProblem(t, rr)
+				assert.Empty(t, resp.Calculations)
+			} else {
+				assert.Equal(t, []calculation{
+					{CreatedAt: createdAt, Order: 251, Sizes: []int{250, 500}, Packs: map[int]int{500: 1}, Solver: pack.SolverDP},
+				}, resp.Calculations)
+			}
+		})
+	}
+}
+
+func TestListAuditEntriesHandler(t *testing.T) {
+	createdAt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		query           string
+		expectedFilter  pack.AuditFilter
+		getAuditEntries func(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error)
+		expectedStatus  int
+		expectedError   bool
+	}{
+		{
+			name:           "Defaults",
+			query:          "",
+			expectedFilter: pack.AuditFilter{Limit: defaultAuditPage},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:  "All filters",
+			query: "?from=2025-07-01T00:00:00Z&to=2025-07-02T00:00:00Z&actor=jane&limit=10&offset=20",
+			expectedFilter: pack.AuditFilter{
+				From:   time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC),
+				To:     time.Date(2025, 7, 2, 0, 0, 0, 0, time.UTC),
+				Actor:  "jane",
+				Limit:  10,
+				Offset: 20,
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Limit above maximum",
+			query:          "?limit=100000",
+			expectedFilter: pack.AuditFilter{Limit: maxAuditPage},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Zero limit",
+			query:          "?limit=0",
+			expectedFilter: pack.AuditFilter{Limit: defaultAuditPage},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid date",
+			query:          "?to=tomorrow",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:           "Invalid limit",
+			query:          "?limit=ten",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:  "Error from repo",
+			query: "",
+			getAuditEntries: func(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error) {
+				return nil, assert.AnError
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.AuditRepo = &AuditRepoStub{
+				getAuditEntries: func(ctx context.Context, filter pack.AuditFilter) ([]pack.AuditEntry, error) {
+					if tt.getAuditEntries != nil {
+						return tt.getAuditEntries(ctx, filter)
+					}
+					assert.Equal(t, tt.expectedFilter, filter)
+					return []pack.AuditEntry{
+						{
+							CreatedAt:  createdAt,
+							Actor:      "jane",
+							ClientIP:   "192.0.2.1",
+							OldVersion: 1,
+							OldSizes:   []int{250, 500},
+							NewVersion: 2,
+							NewSizes:   []int{250, 500, 1000},
+						},
+					}, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v2/audit"+tt.query, nil)
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp listAuditEntriesResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedError {
+				assertProblem(t, rr)
+				assert.Empty(t, resp.Entries)
+			} else {
+				assert.Equal(t, []auditEntry{
+					{
+						CreatedAt:  createdAt,
+						Actor:      "jane",
+						ClientIP:   "192.0.2.1",
+						OldVersion: 1,
+						OldSizes:   []int{250, 500},
+						NewVersion: 2,
+						NewSizes:   []int{250, 500, 1000},
+					},
+				}, resp.Entries)
+			}
+		})
+	}
+}
+
+func TestSimulatePackSizesHandler(t *testing.T) {
+	tests := []struct {
+		name             string
+		requestBody      string
+		getCalculations  func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error)
+		expectedStatus   int
+		expectedOverfill int
+		expectedChanges  int
+		expectedSkipped  int
+		expectedError    bool
+	}{
+		{
+			name:        "Success",
+			requestBody: `{"sizes": [500, 1000]}`,
+			getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+				assert.Equal(t, defaultSimulationOrders, filter.Limit)
+				return []pack.Calculation{{Order: 251}, {Order: 501}}, nil
+			},
+			expectedStatus:   http.StatusOK,
+			expectedOverfill: 250,
+			expectedChanges:  1,
+		},
+		{
+			name:        "Orders over the maximum are skipped",
+			requestBody: `{"sizes": [500, 1000]}`,
+			getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+				return []pack.Calculation{{Order: pack.MaxOrder + 1}, {Order: 501}}, nil
+			},
+			expectedStatus:   http.StatusOK,
+			expectedOverfill: 250,
+			expectedChanges:  1,
+			expectedSkipped:  1,
+		},
+		{
+			name:        "Too much work",
+			requestBody: `{"sizes": [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34, 35, 36, 37, 38, 39, 40, 41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51, 52, 53, 54, 55, 56, 57, 58, 59, 60, 61, 62, 63, 64, 65, 66, 67, 68, 69, 70, 71, 72, 73, 74, 75, 76, 77, 78, 79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 89, 90, 91, 92, 93, 94, 95, 96, 97, 98, 99, 100]}`,
+			getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+				return []pack.Calculation{{Order: pack.MaxOrder}}, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:        "Empty sizes",
+			requestBody: `{"sizes": []}`,
+			getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+				return []pack.Calculation{{Order: 251}}, nil
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    `{"sizes": ["500"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:        "Error from repo",
+			requestBody: `{"sizes": [500, 1000]}`,
+			getCalculations: func(ctx context.Context, filter pack.CalculationFilter) ([]pack.Calculation, error) {
+				return nil, assert.AnError
+			},
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.SizeRepo = &SizeRepoStub{
+				getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+					return pack.SizeSet{Version: 1, Sizes: []int{250, 500, 1000}}, nil
+				},
+			}
+			app.CalcRepo = &CalcRepoStub{
+				getCalculations: tt.getCalculations,
+			}
+
+			body := bytes.NewBufferString(tt.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/sizes/simulate", body)
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp simulatePackSizesResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expectedError {
+				assertProblem(t, rr)
+			} else {
+				assert.Equal(t, tt.expectedOverfill, resp.OverfillDelta)
+				assert.Len(t, resp.Changes, tt.expectedChanges)
+				assert.Equal(t, tt.expectedSkipped, resp.Skipped)
+			}
+		})
+	}
+}
+
+func TestRecommendPackSizesHandler(t *testing.T) {
+	app := NewTestApp()
+
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectedStatus int
+		expectedSizes  []int
+		expectedError  bool
+	}{
+		{
+			name:           "Valid request",
+			requestBody:    `{"histogram": {"250": 10, "500": 5}, "max_sizes": 2}`,
+			expectedStatus: http.StatusOK,
+			expectedSizes:  []int{250, 500},
+		},
+		{
+			name:           "Zero max sizes",
+			requestBody:    `{"histogram": {"250": 10}, "max_sizes": 0}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:           "Too much work",
+			requestBody:    `{"histogram": {"1000000": 1, "950000": 1, "900000": 1, "850000": 1, "800000": 1, "750000": 1, "700000": 1, "650000": 1, "600000": 1, "550000": 1, "500000": 1, "450000": 1}, "max_sizes": 12}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    `{"histogram": [250], "max_sizes": 2}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+		{
+			name:           "Empty body",
+			requestBody:    ``,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := bytes.NewBufferString(test.requestBody)
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/recommend-sizes", body)
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, test.expectedStatus, rr.Code)
+
+			var resp recommendPackSizesResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if test.expectedError {
+				assertProblem(t, rr)
+				assert.Empty(t, resp.Sizes)
+			} else {
+				assert.Equal(t, test.expectedSizes, resp.Sizes)
+			}
+		})
+	}
+}
+
+func TestExportConfigHandler(t *testing.T) {
+	createdAt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizeSets: func(ctx context.Context) ([]pack.SizeSet, error) {
+			return []pack.SizeSet{
+				{Version: 1, Sizes: []int{250, 500}, Author: "john", CreatedAt: createdAt, EffectiveFrom: createdAt},
+			}, nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/export", nil)
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp exportDocument
+	err := json.Unmarshal(rr.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, pack.ExportFormatVersion, resp.FormatVersion)
+	assert.False(t, resp.ExportedAt.IsZero())
+	assert.Equal(t, []sizeSet{
+		{Version: 1, Sizes: []int{250, 500}, Author: "john", CreatedAt: createdAt, EffectiveFrom: createdAt},
+	}, resp.SizeSets)
+}
+
+func TestImportConfigHandler(t *testing.T) {
+	current := []pack.SizeSet{{Version: 1, Sizes: []int{100}, Author: "john"}}
+	document := `{"format_version": 1, "size_sets": [
+		{"version": 7, "sizes": [500, 250], "author": "john", "effective_from": "2025-07-01T12:00:00Z"}
+	]}`
+
+	tests := []struct {
+		name           string
+		query          string
+		requestBody    string
+		applyPackSizes func(ctx context.Context, plan func([]pack.SizeSet) (pack.SizeSetChanges, error)) ([]pack.SizeSet, error)
+		expectedStatus int
+		expected       *importConfigResponse
+	}{
+		{
+			name:           "Dry run",
+			query:          "?dry_run=true",
+			requestBody:    document,
+			expectedStatus: http.StatusOK,
+			expected: &importConfigResponse{
+				DryRun:    true,
+				OldSizes:  []int{100},
+				NewSizes:  []int{250, 500},
+				Scheduled: []sizeSet{},
+				Cancelled: []sizeSet{},
+			},
+		},
+		{
+			name:        "Apply",
+			requestBody: document,
+			applyPackSizes: func(ctx context.Context, plan func([]pack.SizeSet) (pack.SizeSetChanges, error)) ([]pack.SizeSet, error) {
+				assert.Equal(t, "192.0.2.1", pack.ClientIP(ctx))
+
+				changes, err := plan(current)
+				assert.NoError(t, err)
+				assert.Equal(t, pack.SizeSetChanges{Store: []pack.SizeSet{{Sizes: []int{250, 500}, Author: "jane"}}, Author: "jane"}, changes)
+
+				return []pack.SizeSet{{Version: 2, Sizes: []int{250, 500}, Author: "jane"}}, nil
+			},
+			expectedStatus: http.StatusOK,
+			expected: &importConfigResponse{
+				OldSizes:  []int{100},
+				NewSizes:  []int{250, 500},
+				Scheduled: []sizeSet{},
+				Cancelled: []sizeSet{},
+				Stored:    []sizeSet{{Version: 2, Sizes: []int{250, 500}, Author: "jane"}},
+			},
+		},
+		{
+			name:           "Unsupported format version",
+			requestBody:    `{"format_version": 2, "size_sets": []}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid sizes",
+			requestBody:    `{"format_version": 1, "size_sets": [{"version": 1, "sizes": [250, 250]}]}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			requestBody:    `{"format_version": "1"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid dry run",
+			query:          "?dry_run=maybe",
+			requestBody:    document,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "Error from repo",
+			requestBody: document,
+			applyPackSizes: func(ctx context.Context, plan func([]pack.SizeSet) (pack.SizeSetChanges, error)) ([]pack.SizeSet, error) {
+				return nil, assert.AnError
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.SizeRepo = &SizeRepoStub{
+				getPackSizeSets: func(ctx context.Context) ([]pack.SizeSet, error) {
+					return current, nil
+				},
+				applyPackSizes: tt.applyPackSizes,
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/import"+tt.query, bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(authorHeader, "jane")
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+
+			var resp importConfigResponse
+			err := json.Unmarshal(rr.Body.Bytes(), &resp)
+			assert.NoError(t, err)
+
+			if tt.expected == nil {
+				assertProblem(t, rr)
+			} else {
+				assert.Equal(t, *tt.expected, resp)
+			}
+		})
+	}
+}
+
+func TestPoolStatsHandler(t *testing.T) {
+	t.Run("Pool", func(t *testing.T) {
+		app := NewTestApp()
+		app.PoolStats = func() any {
+			return map[string]int{"total_conns": 4}
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/pool", nil)
+
+		rr := serve(t, app, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"pool": {"total_conns": 4}}`, rr.Body.String())
+	})
+
+	t.Run("No pool", func(t *testing.T) {
+		app := NewTestApp()
+
+		req := httptest.NewRequest(http.MethodGet, "/debug/pool", nil)
+
+		rr := serve(t, app, req)
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		var resp poolStatsResponse
+		err := json.Unmarshal(rr.Body.Bytes(), &resp)
+		assert.NoError(t, err)
+		assertProblem(t, rr)
+	})
+}
+
+func TestListAPIKeysHandler(t *testing.T) {
+	createdAt := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	app := NewTestApp()
+	app.KeyRepo = &KeyRepoStub{
+		getAPIKeys: func(ctx context.Context) ([]pack.APIKey, error) {
+			return []pack.APIKey{
+				{ID: 1, Name: "jane", Role: pack.RoleAdmin, Hash: "hash1", CreatedAt: createdAt},
+				{ID: 2, Name: "john", Role: pack.RoleReader, Hash: "hash2", CreatedAt: createdAt, RevokedAt: createdAt.Add(time.Hour)},
+			}, nil
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/keys", nil)
+
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"keys": [
+		{"id": 1, "name": "jane", "role": "admin", "created_at": "2025-07-01T12:00:00Z"},
+		{"id": 2, "name": "john", "role": "reader", "created_at": "2025-07-01T12:00:00Z", "revoked_at": "2025-07-01T13:00:00Z"}
+	]}`, rr.Body.String(), "hashes aren't exposed")
+}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		requestBody    string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name:           "Success",
+			requestBody:    `{"name": "john", "role": "calculator"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "Unknown role",
+			requestBody:    `{"name": "john", "role": "root"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidArgument,
+		},
+		{
+			name:           "No name",
+			requestBody:    `{"role": "reader"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stored pack.APIKey
+
+			app := NewTestApp()
+			app.KeyRepo = &KeyRepoStub{
+				storeAPIKey: func(ctx context.Context, key pack.APIKey) (pack.APIKey, error) {
+					key.ID = 3
+					key.CreatedAt = time.Now()
+					stored = key
+					return key, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/keys", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedCode != "" {
+				p := assertProblem(t, rr)
+				assert.Equal(t, tt.expectedCode, p.Code)
+				assert.Zero(t, stored)
+				return
+			}
+
+			var resp createAPIKeyResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, 3, resp.ID)
+			assert.Equal(t, "john", resp.Name)
+			assert.Equal(t, pack.RoleCalculator, resp.Role)
+			assert.Equal(t, pack.HashAPIKey(resp.Key), stored.Hash, "only the hash of the returned key is stored")
+			assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestRevokeAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name           string
+		id             string
+		revokeAPIKey   func(ctx context.Context, id int) (pack.APIKey, error)
+		expectedStatus int
+	}{
+		{
+			name: "Success",
+			id:   "2",
+			revokeAPIKey: func(ctx context.Context, id int) (pack.APIKey, error) {
+				assert.Equal(t, 2, id)
+				return pack.APIKey{ID: id, Name: "john", Role: pack.RoleReader, CreatedAt: time.Now(), RevokedAt: time.Now()}, nil
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Invalid ID",
+			id:             "two",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "Unknown key",
+			id:   "5",
+			revokeAPIKey: func(ctx context.Context, id int) (pack.APIKey, error) {
+				return pack.APIKey{}, fmt.Errorf("API key %d: %w", id, pack.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "Already revoked",
+			id:   "2",
+			revokeAPIKey: func(ctx context.Context, id int) (pack.APIKey, error) {
+				return pack.APIKey{}, fmt.Errorf("%w: API key %d is already revoked", pack.ErrConflict, id)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.KeyRepo = &KeyRepoStub{revokeAPIKey: tt.revokeAPIKey}
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/v2/keys/"+tt.id, nil)
+
+			rr := serve(t, app, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expectedStatus != http.StatusOK {
+				assertProblem(t, rr)
+				return
+			}
+
+			var resp apiKey
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, 2, resp.ID)
+			assert.False(t, resp.RevokedAt.IsZero())
 		})
 	}
 }
 
 func NewTestApp() *App {
 	return &App{
-		logger: slog.New(slog.DiscardHandler),
+		logger:  slog.New(slog.DiscardHandler),
+		metrics: newMetrics(),
 		Config: &Config{
-			Order: "250",
+			Order:        "250",
+			MaxBodyBytes: defaultMaxBodyBytes,
 		},
 	}
 }
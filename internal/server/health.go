@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// readyCheckTimeout keeps /readyz from hanging on a database that doesn't respond,
+// probes usually give up after a second or a few
+const readyCheckTimeout = time.Second
+
+// Statuses of /healthz, /readyz and their checks
+const (
+	healthOK           = "ok"
+	healthFailing      = "failing"
+	healthShuttingDown = "shutting_down"
+)
+
+// CheckFunc reports an error if a dependency of the server isn't usable, see App.ReadyChecks
+type CheckFunc func(context.Context) error
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// StartShutdown makes /readyz fail, so load balancers stop sending requests before the server shuts down
+func (a *App) StartShutdown() {
+	a.shuttingDown.Store(true)
+}
+
+// healthzHandler reports that the process is alive, regardless of its dependencies
+func (a *App) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: healthOK})
+}
+
+// readyzHandler reports whether the server can handle requests: its templates are parsed and ReadyChecks pass.
+// It fails once the server is shutting down without running the checks.
+func (a *App) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	if a.shuttingDown.Load() {
+		writeHealth(w, http.StatusServiceUnavailable, healthResponse{Status: healthShuttingDown})
+		return
+	}
+
+	checks := map[string]CheckFunc{"templates": a.checkTemplates}
+	for name, check := range a.ReadyChecks {
+		checks[name] = check
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyCheckTimeout)
+	defer cancel()
+
+	resp := healthResponse{Status: healthOK, Checks: make(map[string]checkResult, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			result := checkResult{Status: healthOK}
+			if err := check(ctx); err != nil {
+				a.loggerFor(ctx).Warn("readiness check failed", "check", name, "err", err)
+				result = checkResult{Status: healthFailing, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			resp.Checks[name] = result
+			if result.Status != healthOK {
+				resp.Status = healthFailing
+			}
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if resp.Status != healthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, resp)
+}
+
+func (a *App) checkTemplates(context.Context) error {
+	if a.template == nil {
+		return errors.New("the templates aren't parsed")
+	}
+	return nil
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
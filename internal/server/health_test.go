@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthzHandler(t *testing.T) {
+	app := NewTestApp()
+	app.ReadyChecks = map[string]CheckFunc{
+		"database": func(ctx context.Context) error { return errors.New("connection refused") },
+	}
+	app.StartShutdown()
+
+	rr := serve(t, app, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, rr.Body.String())
+}
+
+func TestReadyzHandler(t *testing.T) {
+	parsed, err := template.ParseFS(content, "templates/index.html")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		template       *template.Template
+		checks         map[string]CheckFunc
+		shuttingDown   bool
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "Ready",
+			template:       parsed,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"status": "ok", "checks": {"templates": {"status": "ok"}}}`,
+		},
+		{
+			name:     "Ready with checks",
+			template: parsed,
+			checks: map[string]CheckFunc{
+				"database":   func(ctx context.Context) error { return nil },
+				"migrations": func(ctx context.Context) error { return nil },
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"status": "ok", "checks": {
+				"database": {"status": "ok"},
+				"migrations": {"status": "ok"},
+				"templates": {"status": "ok"}
+			}}`,
+		},
+		{
+			name:     "Failing check",
+			template: parsed,
+			checks: map[string]CheckFunc{
+				"database":   func(ctx context.Context) error { return nil },
+				"migrations": func(ctx context.Context) error { return errors.New("1 migrations are pending: 6_add_index") },
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: `{"status": "failing", "checks": {
+				"database": {"status": "ok"},
+				"migrations": {"status": "failing", "error": "1 migrations are pending: 6_add_index"},
+				"templates": {"status": "ok"}
+			}}`,
+		},
+		{
+			name:           "Templates not parsed",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status": "failing", "checks": {"templates": {"status": "failing", "error": "the templates aren't parsed"}}}`,
+		},
+		{
+			name:     "Timed out check",
+			template: parsed,
+			checks: map[string]CheckFunc{
+				"database": func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody: `{"status": "failing", "checks": {
+				"database": {"status": "failing", "error": "context deadline exceeded"},
+				"templates": {"status": "ok"}
+			}}`,
+		},
+		{
+			name:     "Shutting down",
+			template: parsed,
+			checks: map[string]CheckFunc{
+				"database": func(ctx context.Context) error {
+					t.Error("checks don't run during shutdown")
+					return nil
+				},
+			},
+			shuttingDown:   true,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   `{"status": "shutting_down"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := NewTestApp()
+			app.template = tt.template
+			app.ReadyChecks = tt.checks
+			if tt.shuttingDown {
+				app.StartShutdown()
+			}
+
+			rr := serve(t, app, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+			assert.JSONEq(t, tt.expectedBody, rr.Body.String())
+		})
+	}
+}
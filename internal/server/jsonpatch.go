@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+)
+
+const jsonPatchContentType = "application/json-patch+json"
+
+// errPatchFailed means that a valid patch can't be applied to the current pack sizes,
+// e.g. a test operation failed or an index is out of range
+var errPatchFailed = errors.New("patch can't be applied")
+
+// patchOperation is a single JSON Patch (RFC 6902) operation
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// patchLocation is a JSON Pointer into the {"sizes": [...]} document of pack sizes
+type patchLocation struct {
+	whole bool // the whole list of sizes
+	end   bool // the "-" past the last element, only valid for add
+	index int
+}
+
+// applySizesPatch applies JSON Patch operations to the {"sizes": [...]} document of pack sizes.
+// All operations are supported with paths pointing to the list of sizes or its elements.
+func applySizesPatch(sizes []int, ops []patchOperation) ([]int, error) {
+	sizes = slices.Clone(sizes)
+
+	for i, op := range ops {
+		var err error
+		sizes, err = applySizesPatchOperation(sizes, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return sizes, nil
+}
+
+func applySizesPatchOperation(sizes []int, op patchOperation) ([]int, error) {
+	path, err := parsePatchPath(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if path.whole {
+			var value []int
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, fmt.Errorf("%w: value of %s must be a list of sizes", pack.ErrInvalidArg, op.Path)
+			}
+			if op.Op == "test" && !slices.Equal(sizes, value) {
+				return nil, fmt.Errorf("%w: %s is %v, not %v", errPatchFailed, op.Path, sizes, value)
+			}
+			return value, nil
+		}
+
+		var value int
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: value of %s must be a size", pack.ErrInvalidArg, op.Path)
+		}
+
+		switch op.Op {
+		case "add":
+			return insertSize(sizes, path, value)
+		case "replace":
+			if err := checkSizeIndex(sizes, path); err != nil {
+				return nil, err
+			}
+			sizes[path.index] = value
+			return sizes, nil
+		default:
+			if err := checkSizeIndex(sizes, path); err != nil {
+				return nil, err
+			}
+			if sizes[path.index] != value {
+				return nil, fmt.Errorf("%w: %s is %d, not %d", errPatchFailed, op.Path, sizes[path.index], value)
+			}
+			return sizes, nil
+		}
+
+	case "remove":
+		if path.whole {
+			return []int{}, nil
+		}
+		if err := checkSizeIndex(sizes, path); err != nil {
+			return nil, err
+		}
+		return slices.Delete(sizes, path.index, path.index+1), nil
+
+	case "move", "copy":
+		from, err := parsePatchPath(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if from.whole || path.whole {
+			return nil, fmt.Errorf("%w: %s can only %s single sizes", pack.ErrInvalidArg, op.Op, op.Op)
+		}
+		if err := checkSizeIndex(sizes, from); err != nil {
+			return nil, err
+		}
+
+		value := sizes[from.index]
+		if op.Op == "move" {
+			sizes = slices.Delete(sizes, from.index, from.index+1)
+		}
+		return insertSize(sizes, path, value)
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported patch operation %q", pack.ErrInvalidArg, op.Op)
+	}
+}
+
+// parsePatchPath parses a JSON Pointer to the list of sizes or one of its elements
+func parsePatchPath(path string) (patchLocation, error) {
+	rest, ok := strings.CutPrefix(path, "/sizes")
+	switch {
+	case !ok:
+		return patchLocation{}, fmt.Errorf("%w: path %q is outside of /sizes", pack.ErrInvalidArg, path)
+	case rest == "":
+		return patchLocation{whole: true}, nil
+	case rest == "/-":
+		return patchLocation{end: true}, nil
+	}
+
+	index, err := strconv.Atoi(strings.TrimPrefix(rest, "/"))
+	if !strings.HasPrefix(rest, "/") || err != nil || index < 0 || strconv.Itoa(index) != rest[1:] {
+		return patchLocation{}, fmt.Errorf("%w: invalid path %q", pack.ErrInvalidArg, path)
+	}
+
+	return patchLocation{index: index}, nil
+}
+
+// checkSizeIndex ensures that loc points to an existing element
+func checkSizeIndex(sizes []int, loc patchLocation) error {
+	if loc.end || loc.index >= len(sizes) {
+		return fmt.Errorf("%w: no size at the index", errPatchFailed)
+	}
+	return nil
+}
+
+// insertSize inserts value before the element loc points to, or appends it for "-"
+func insertSize(sizes []int, loc patchLocation, value int) ([]int, error) {
+	if loc.end {
+		return append(sizes, value), nil
+	}
+	if loc.index > len(sizes) {
+		return nil, fmt.Errorf("%w: index %d is past the end", errPatchFailed, loc.index)
+	}
+	return slices.Insert(sizes, loc.index, value), nil
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySizesPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patch    string
+		expected []int
+		err      error
+	}{
+		{
+			name:     "Add to end",
+			patch:    `[{"op": "add", "path": "/sizes/-", "value": 1000}]`,
+			expected: []int{250, 500, 1000},
+		},
+		{
+			name:     "Add at index",
+			patch:    `[{"op": "add", "path": "/sizes/0", "value": 100}]`,
+			expected: []int{100, 250, 500},
+		},
+		{
+			name:     "Add past end",
+			patch:    `[{"op": "add", "path": "/sizes/2", "value": 1000}]`,
+			expected: []int{250, 500, 1000},
+		},
+		{
+			name:  "Add out of range",
+			patch: `[{"op": "add", "path": "/sizes/3", "value": 1000}]`,
+			err:   errPatchFailed,
+		},
+		{
+			name:     "Replace whole",
+			patch:    `[{"op": "replace", "path": "/sizes", "value": [23, 31, 53]}]`,
+			expected: []int{23, 31, 53},
+		},
+		{
+			name:     "Replace",
+			patch:    `[{"op": "replace", "path": "/sizes/1", "value": 1000}]`,
+			expected: []int{250, 1000},
+		},
+		{
+			name:     "Remove",
+			patch:    `[{"op": "remove", "path": "/sizes/0"}]`,
+			expected: []int{500},
+		},
+		{
+			name:     "Remove whole",
+			patch:    `[{"op": "remove", "path": "/sizes"}]`,
+			expected: []int{},
+		},
+		{
+			name:  "Remove out of range",
+			patch: `[{"op": "remove", "path": "/sizes/2"}]`,
+			err:   errPatchFailed,
+		},
+		{
+			name:     "Test and replace",
+			patch:    `[{"op": "test", "path": "/sizes/0", "value": 250}, {"op": "replace", "path": "/sizes/0", "value": 100}]`,
+			expected: []int{100, 500},
+		},
+		{
+			name:  "Failed test",
+			patch: `[{"op": "test", "path": "/sizes", "value": [250]}, {"op": "remove", "path": "/sizes/0"}]`,
+			err:   errPatchFailed,
+		},
+		{
+			name:     "Move",
+			patch:    `[{"op": "move", "from": "/sizes/0", "path": "/sizes/-"}]`,
+			expected: []int{500, 250},
+		},
+		{
+			name:     "Copy",
+			patch:    `[{"op": "copy", "from": "/sizes/1", "path": "/sizes/0"}]`,
+			expected: []int{500, 250, 500},
+		},
+		{
+			name:  "Move whole",
+			patch: `[{"op": "move", "from": "/sizes", "path": "/sizes/0"}]`,
+			err:   pack.ErrInvalidArg,
+		},
+		{
+			name:  "Unsupported operation",
+			patch: `[{"op": "merge", "path": "/sizes"}]`,
+			err:   pack.ErrInvalidArg,
+		},
+		{
+			name:  "Path outside of sizes",
+			patch: `[{"op": "add", "path": "/version", "value": 1}]`,
+			err:   pack.ErrInvalidArg,
+		},
+		{
+			name:  "Leading zero index",
+			patch: `[{"op": "remove", "path": "/sizes/01"}]`,
+			err:   pack.ErrInvalidArg,
+		},
+		{
+			name:  "Invalid value",
+			patch: `[{"op": "add", "path": "/sizes/-", "value": "1000"}]`,
+			err:   pack.ErrInvalidArg,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []patchOperation
+			require.NoError(t, json.Unmarshal([]byte(tt.patch), &ops))
+
+			current := []int{250, 500}
+			sizes, err := applySizesPatch(current, ops)
+
+			assert.Equal(t, []int{250, 500}, current, "current sizes must not be modified")
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, sizes)
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"golang.org/x/time/rate"
+)
+
+// calculationRetryAfter is when clients turned away by a full calculation queue are told to try again
+const calculationRetryAfter = time.Second
+
+// clientLimiter is a token bucket per client. Clients are API keys or addresses, see rateLimitClient().
+type clientLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+func newClientLimiter(perSecond float64, burst int) *clientLimiter {
+	return &clientLimiter{limit: rate.Limit(perSecond), burst: burst, buckets: make(map[string]*bucket)}
+}
+
+// allow takes a token from the bucket of client, or returns how long it takes until there is one
+func (l *clientLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[client] = b
+	}
+	b.seen = now
+
+	r := b.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay, false
+	}
+
+	return 0, true
+}
+
+// check returns how long it takes until the bucket of client has a token, without taking one
+func (l *clientLimiter) check(client string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		return 0, true
+	}
+
+	r := b.limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	r.CancelAt(now)
+
+	return delay, delay <= 0
+}
+
+// sweep drops the buckets that have refilled since they were last used, as they are no different from new ones.
+// It goes through the buckets once per refill time at most, expects the limiter to be locked.
+func (l *clientLimiter) sweep(now time.Time) {
+	refill := time.Duration(float64(l.burst) / float64(l.limit) * float64(time.Second))
+	if now.Sub(l.swept) < refill {
+		return
+	}
+
+	for client, b := range l.buckets {
+		if now.Sub(b.seen) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+	l.swept = now
+}
+
+// calcLimiter caps the number of calculations running at once. Calculations over the cap wait in a bounded queue.
+type calcLimiter struct {
+	slots     chan struct{}
+	queued    atomic.Int64
+	maxQueued int64
+	timeout   time.Duration
+}
+
+func newCalcLimiter(maxRunning, maxQueued int, timeout time.Duration) *calcLimiter {
+	return &calcLimiter{slots: make(chan struct{}, maxRunning), maxQueued: int64(maxQueued), timeout: timeout}
+}
+
+// acquire takes a slot for a calculation, waiting in the queue for the timeout at most.
+// It returns false if the queue is full, the wait times out or ctx is done. Taken slots must be released.
+func (l *calcLimiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if l.queued.Add(1) > l.maxQueued {
+		l.queued.Add(-1)
+		return false
+	}
+	defer l.queued.Add(-1)
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *calcLimiter) release() {
+	<-l.slots
+}
+
+// limitRate makes handler respond with 429 Too Many Requests to clients that have used up their rate limit
+func (a *App) limitRate(handler http.HandlerFunc) http.HandlerFunc {
+	if a.rateLimiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if delay, ok := a.rateLimiter.allow(rateLimitClient(r), time.Now()); !ok {
+			a.writeError(w, r, rateLimited(delay))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// authenticateLimited calls authenticate for a request or call from ip unless the rate limit of ip is used up.
+// Failed authentications take a token from the bucket of ip, so clients without a valid API key are limited
+// like anonymous ones before each of their attempts costs an API key lookup.
+func (a *App) authenticateLimited(ip string, authenticate func() (pack.APIKey, error)) (pack.APIKey, error) {
+	if a.rateLimiter == nil {
+		return authenticate()
+	}
+
+	client := rateLimitClientOf(context.Background(), ip)
+	if delay, ok := a.rateLimiter.check(client, time.Now()); !ok {
+		return pack.APIKey{}, rateLimited(delay)
+	}
+
+	key, err := authenticate()
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.status == http.StatusUnauthorized {
+		a.rateLimiter.allow(client, time.Now())
+	}
+
+	return key, err
+}
+
+// rateLimited reports a client that has used up its rate limit and may try again after delay
+func rateLimited(delay time.Duration) error {
+	return &requestError{
+		status:     http.StatusTooManyRequests,
+		code:       codeRateLimited,
+		retryAfter: delay,
+		err:        errors.New("too many requests, try again later"),
+	}
+}
+
+// limitCalculations makes handler wait for a calculation slot and respond with 503 Service Unavailable
+// if there is none in time, so large orders can't take up all CPUs
+func (a *App) limitCalculations(handler http.HandlerFunc) http.HandlerFunc {
+	if a.calcLimiter == nil {
+		return handler
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		release, err := a.acquireCalculation(r.Context())
+		if err != nil {
+			a.writeError(w, r, err)
+			return
+		}
+		defer release()
+
+		handler(w, r)
+	}
+}
+
+// acquireCalculation waits for a calculation slot if the calculations are capped.
+// The returned function releases the slot.
+func (a *App) acquireCalculation(ctx context.Context) (func(), error) {
+	if a.calcLimiter == nil {
+		return func() {}, nil
+	}
+
+	if !a.calcLimiter.acquire(ctx) {
+		return nil, &requestError{
+			status:     http.StatusServiceUnavailable,
+			code:       codeOverloaded,
+			retryAfter: calculationRetryAfter,
+			err:        errors.New("too many calculations are running, try again later"),
+		}
+	}
+
+	return a.calcLimiter.release, nil
+}
+
+// rateLimitClient identifies who the rate limit of a request applies to: its API key if it was authorized with one,
+// and the client address otherwise
+func rateLimitClient(r *http.Request) string {
+	return rateLimitClientOf(r.Context(), clientIP(r))
+}
+
+// rateLimitClientOf identifies who the rate limit of an HTTP request or a gRPC call from ip applies to
+func rateLimitClientOf(ctx context.Context, ip string) string {
+	if key, ok := contextAPIKey(ctx); ok {
+		return fmt.Sprintf("key:%d:%s", key.ID, key.Name)
+	}
+	return "ip:" + ip
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientLimiter(t *testing.T) {
+	l := newClientLimiter(2, 3)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for range 3 {
+		_, ok := l.allow("ip:192.0.2.1", now)
+		assert.True(t, ok)
+	}
+
+	delay, ok := l.allow("ip:192.0.2.1", now)
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, delay)
+
+	// Other clients have their own buckets
+	_, ok = l.allow("ip:192.0.2.2", now)
+	assert.True(t, ok)
+
+	// Turned away requests don't take tokens
+	_, ok = l.allow("ip:192.0.2.1", now.Add(500*time.Millisecond))
+	assert.True(t, ok)
+
+	// Buckets that have refilled are dropped
+	_, ok = l.allow("ip:192.0.2.3", now.Add(2*time.Second))
+	assert.True(t, ok)
+	assert.Len(t, l.buckets, 1)
+	assert.Contains(t, l.buckets, "ip:192.0.2.3")
+}
+
+func TestCalcLimiter(t *testing.T) {
+	t.Run("Queue full", func(t *testing.T) {
+		l := newCalcLimiter(1, 0, time.Second)
+
+		assert.True(t, l.acquire(context.Background()))
+		assert.False(t, l.acquire(context.Background()))
+
+		l.release()
+		assert.True(t, l.acquire(context.Background()))
+	})
+
+	t.Run("Queued", func(t *testing.T) {
+		l := newCalcLimiter(1, 1, time.Second)
+		assert.True(t, l.acquire(context.Background()))
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			l.release()
+		}()
+
+		assert.True(t, l.acquire(context.Background()))
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		l := newCalcLimiter(1, 1, 10*time.Millisecond)
+
+		assert.True(t, l.acquire(context.Background()))
+		assert.False(t, l.acquire(context.Background()))
+		assert.Zero(t, l.queued.Load())
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		l := newCalcLimiter(1, 1, time.Second)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.True(t, l.acquire(context.Background()))
+		assert.False(t, l.acquire(ctx))
+	})
+}
+
+func TestLimitRate(t *testing.T) {
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+	}
+	app.rateLimiter = newClientLimiter(0.5, 1)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+	rr := serve(t, app, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+	rr = serve(t, app, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	p := assertProblem(t, rr)
+	assert.Equal(t, codeRateLimited, p.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+
+	// Requests from other addresses aren't limited
+	req = httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	rr = serve(t, app, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestLimitCalculations(t *testing.T) {
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+	}
+	app.calcLimiter = newCalcLimiter(1, 0, time.Second)
+
+	// A calculation is running
+	assert.True(t, app.calcLimiter.acquire(context.Background()))
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", strings.NewReader(`{"order": 251}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	p := assertProblem(t, rr)
+	assert.Equal(t, codeOverloaded, p.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+
+	// Other routes aren't limited
+	req = httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+	rr = serve(t, app, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	app.calcLimiter.release()
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", strings.NewReader(`{"order": 251}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, app.calcLimiter.slots, 0)
+}
+
+func TestLimitRate_Unauthenticated(t *testing.T) {
+	var lookups int
+
+	app := NewTestApp()
+	app.Config.AuthEnabled = true
+	app.KeyRepo = &KeyRepoStub{
+		getAPIKey: func(ctx context.Context, hash string) (pack.APIKey, error) {
+			lookups++
+			if hash == pack.HashAPIKey("reader-key") {
+				return pack.APIKey{ID: 1, Name: "john", Role: pack.RoleReader, Hash: hash}, nil
+			}
+			return pack.APIKey{}, pack.ErrNotFound
+		},
+	}
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+	}
+	app.rateLimiter = newClientLimiter(0.5, 1)
+
+	get := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+		req.Header.Set("Authorization", authorization)
+		return serve(t, app, req)
+	}
+
+	rr := get("Bearer invalid-key")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// The failed attempt used up the limit of the address, so the next one isn't looked up
+	rr = get("Bearer invalid-key")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	assert.Equal(t, 1, lookups)
+
+	rr = get("")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	// Clients with a valid key from other addresses have their own limit
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+	req.RemoteAddr = "198.51.100.1:1234"
+	req.Header.Set("Authorization", "Bearer reader-key")
+	rr = serve(t, app, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestLimitRate_Unlimited(t *testing.T) {
+	app := NewTestApp()
+	app.rateLimiter = newClientLimiter(0.5, 1)
+
+	for _, target := range []string{"/healthz", "/readyz", "/metrics"} {
+		for range 3 {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rr := serve(t, app, req)
+			assert.NotEqual(t, http.StatusTooManyRequests, rr.Code, target)
+		}
+	}
+
+	// The other routes of the same address are still limited
+	for _, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+		rr := serve(t, app, req)
+		assert.Equal(t, expected, rr.Code)
+	}
+}
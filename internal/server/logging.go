@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// requestIDHeader identifies a request in the logs and error responses of every service it passes through
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLen keeps IDs sent by clients from bloating the logs
+	maxRequestIDLen = 128
+)
+
+type (
+	requestIDContextKey struct{}
+	loggerContextKey    struct{}
+)
+
+// logRequests assigns every request handled by next an ID, or keeps the one the client sent in X-Request-ID,
+// and returns it in the response. Handlers log with a logger that adds the ID, see loggerFor().
+// When the request is done, a single access line with its route of mux, status, duration and size is logged.
+func (a *App) logRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeOf(mux, r)
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		logger := a.logger.With("request_id", id)
+		// Links the logs to the trace of the request if it's traced
+		if span := trace.SpanContextFromContext(r.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		ctx = context.WithValue(ctx, loggerContextKey{}, logger)
+		r = r.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		logger.Info("request",
+			"method", r.Method,
+			"route", route,
+			"path", r.URL.Path,
+			"status", rec.statusCode(),
+			"duration", time.Since(start),
+			"bytes", rec.bytes,
+			"client", clientIP(r),
+		)
+	})
+}
+
+// loggerFor returns the logger of the request ctx belongs to, or the logger of the App outside of requests
+func (a *App) loggerFor(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return a.logger
+}
+
+// requestID returns the ID assigned to the request by logRequests(), empty if there is none
+func requestID(r *http.Request) string {
+	return contextRequestID(r.Context())
+}
+
+// contextRequestID returns the ID of the HTTP request or gRPC call ctx belongs to, empty if there is none
+func contextRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// validRequestID checks that an ID sent by a client is short and printable, so it can't forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range []byte(id) {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
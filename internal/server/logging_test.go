@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRequests(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestID   string
+		body        string
+		expectedID  string
+		expectedLog []string
+	}{
+		{
+			name:        "Assigned ID",
+			body:        `{"order": 251}`,
+			expectedLog: []string{"request"},
+		},
+		{
+			name:        "Propagated ID",
+			requestID:   "upstream-1234",
+			body:        `{"order": 251}`,
+			expectedID:  "upstream-1234",
+			expectedLog: []string{"request"},
+		},
+		{
+			name:        "Unprintable ID",
+			requestID:   "forged\nline",
+			body:        `{"order": 251}`,
+			expectedLog: []string{"request"},
+		},
+		{
+			name:        "Too long ID",
+			requestID:   strings.Repeat("a", maxRequestIDLen+1),
+			body:        `{"order": 251}`,
+			expectedLog: []string{"request"},
+		},
+		{
+			name:        "Error",
+			requestID:   "upstream-1234",
+			body:        `{"order": 0}`,
+			expectedID:  "upstream-1234",
+			expectedLog: []string{"couldn't calculate packs: invalid arguments received: order amount is not positive", "request"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+
+			app := NewTestApp()
+			app.logger = slog.New(slog.NewJSONHandler(&logs, nil))
+			app.SizeRepo = &SizeRepoStub{
+				getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+					return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+
+			rr := serve(t, app, req)
+
+			id := rr.Header().Get(requestIDHeader)
+			if tt.expectedID != "" {
+				assert.Equal(t, tt.expectedID, id)
+			} else {
+				assert.Regexp(t, "^[0-9a-f]{32}$", id)
+			}
+
+			if rr.Code >= http.StatusBadRequest {
+				p := assertProblem(t, rr)
+				assert.Equal(t, id, p.RequestID)
+			}
+
+			var lines []map[string]any
+			for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+				var entry map[string]any
+				require.NoError(t, json.Unmarshal([]byte(line), &entry))
+				lines = append(lines, entry)
+			}
+			require.Len(t, lines, len(tt.expectedLog))
+			for i, entry := range lines {
+				assert.Equal(t, tt.expectedLog[i], entry["msg"])
+				assert.Equal(t, id, entry["request_id"], "every line of the request has its ID")
+			}
+
+			access := lines[len(lines)-1]
+			assert.Equal(t, http.MethodPost, access["method"])
+			assert.Equal(t, "POST /api/v2/calculate-packs", access["route"])
+			assert.Equal(t, float64(rr.Code), access["status"])
+			assert.Equal(t, float64(rr.Body.Len()), access["bytes"])
+			assert.Equal(t, "192.0.2.1", access["client"])
+			assert.Contains(t, access, "duration")
+		})
+	}
+}
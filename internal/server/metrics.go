@@ -0,0 +1,132 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// unmatchedRoute labels the requests that matched no route. Unknown paths match the UI route "/",
+// so they don't create new series either.
+const unmatchedRoute = "unmatched"
+
+// routeOf returns the pattern of the route mux handles r with, e.g. "POST /api/v2/calculate-packs".
+// Middleware looks it up itself, as ServeMux only sets Request.Pattern on the request it's given.
+func routeOf(mux *http.ServeMux, r *http.Request) string {
+	if _, pattern := mux.Handler(r); pattern != "" {
+		return pattern
+	}
+	return unmatchedRoute
+}
+
+// metrics are the Prometheus metrics served by /metrics
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	calls           *prometheus.CounterVec
+	callDuration    *prometheus.HistogramVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pack_http_requests_total",
+			Help: "HTTP requests by route pattern and status code.",
+		}, []string{"route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pack_http_request_duration_seconds",
+			Help:    "Time taken to handle HTTP requests by route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "status"}),
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pack_grpc_calls_total",
+			Help: "gRPC calls by method and status code.",
+		}, []string{"method", "code"}),
+		callDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pack_grpc_call_duration_seconds",
+			Help:    "Time taken to handle gRPC calls by method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "code"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.calls,
+		m.callDuration,
+	)
+	m.registry.MustRegister(pack.Collectors()...)
+
+	return m
+}
+
+// RegisterCollector adds metrics of other components, such as the database, to /metrics
+func (a *App) RegisterCollector(c prometheus.Collector) error {
+	return a.metrics.registry.Register(c)
+}
+
+// instrument counts and times the requests handled by next by the route pattern of mux they match
+func (a *App) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		route := routeOf(mux, r)
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		status := strconv.Itoa(rec.statusCode())
+
+		a.metrics.requests.WithLabelValues(route, status).Inc()
+		a.metrics.requestDuration.WithLabelValues(route, status).Observe(time.Since(start).Seconds())
+	})
+}
+
+// metricsHandler serves the metrics in the Prometheus exposition format
+func (a *App) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// statusRecorder remembers the status code and counts the bytes of the body written through it
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// statusCode returns the status code written, 200 if the handler wrote nothing
+func (rec *statusRecorder) statusCode() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 1, Sizes: []int{250, 500}}, nil
+		},
+	}
+
+	for _, body := range []string{`{"order": 251}`, `{"order": 501}`, `{"order": 0}`} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		serve(t, app, req)
+	}
+
+	rr := serve(t, app, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain"))
+
+	body := rr.Body.String()
+	assert.Contains(t, body, `pack_http_requests_total{route="POST /api/v2/calculate-packs",status="200"} 2`)
+	assert.Contains(t, body, `pack_http_requests_total{route="POST /api/v2/calculate-packs",status="400"} 1`)
+	assert.Contains(t, body, `pack_http_request_duration_seconds_count{route="POST /api/v2/calculate-packs",status="200"} 2`)
+	assert.Contains(t, body, `pack_calculation_duration_seconds_count{solver="dp"}`)
+	assert.Contains(t, body, "pack_dp_table_entries_count")
+	assert.Contains(t, body, "pack_order_items_count")
+	assert.Contains(t, body, "go_goroutines")
+}
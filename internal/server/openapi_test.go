@@ -0,0 +1,162 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var loadOpenAPISpec = sync.OnceValues(func() (*openapi3.T, error) {
+	// Pages are only checked to be documented, their content is opaque
+	openapi3filter.RegisterBodyDecoder("text/html", openapi3filter.FileBodyDecoder)
+
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, err
+	}
+
+	return doc, doc.Validate(context.Background())
+})
+
+// specRouter finds the operations of requests in the OpenAPI document
+func specRouter(t *testing.T) (*openapi3.T, routers.Router) {
+	t.Helper()
+
+	doc, err := loadOpenAPISpec()
+	require.NoError(t, err)
+
+	router, err := legacy.NewRouter(doc)
+	require.NoError(t, err)
+
+	return doc, router
+}
+
+// serve routes req through the App's router and checks that both the request and the response match
+// the OpenAPI document. Only requests that succeed have to be valid as handlers are tested with invalid ones too.
+func serve(t *testing.T, app *App, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+	specReq := req.Clone(context.Background())
+	specReq.Body = io.NopCloser(bytes.NewReader(body))
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	rr := httptest.NewRecorder()
+	app.NewRouter().ServeHTTP(rr, req)
+
+	_, router := specRouter(t)
+	route, pathParams, err := router.FindRoute(specReq)
+	if !assert.NoError(t, err, "%s %s isn't documented", req.Method, req.URL.Path) {
+		return rr
+	}
+
+	reqInput := &openapi3filter.RequestValidationInput{
+		Request:    specReq,
+		PathParams: pathParams,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			// The key itself is checked by the App, the document only says one is needed when auth is enabled
+			AuthenticationFunc: func(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+				scheme, _, _ := strings.Cut(input.RequestValidationInput.Request.Header.Get("Authorization"), " ")
+				if app.Config.AuthEnabled && !strings.EqualFold(scheme, "Bearer") {
+					return errors.New("no bearer token")
+				}
+				return nil
+			},
+		},
+	}
+	if rr.Code < http.StatusMultipleChoices {
+		assert.NoError(t, openapi3filter.ValidateRequest(context.Background(), reqInput), "accepted request doesn't match the OpenAPI document")
+	}
+
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: reqInput,
+		Status:                 rr.Code,
+		Header:                 rr.Header(),
+		Body:                   io.NopCloser(bytes.NewReader(rr.Body.Bytes())),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	assert.NoError(t, err, "response doesn't match the OpenAPI document")
+
+	return rr
+}
+
+func TestOpenAPISpec_Routes(t *testing.T) {
+	doc, _ := specRouter(t)
+
+	registered := map[string]bool{}
+	for _, rt := range NewTestApp().routes() {
+		method, path, found := strings.Cut(rt.pattern, " ")
+		if !found {
+			// Patterns without a method only serve pages, which are documented for GET
+			method, path = http.MethodGet, rt.pattern
+		}
+		registered[method+" "+path] = true
+
+		item := doc.Paths.Find(path)
+		if !assert.NotNil(t, item, "%s isn't documented", rt.pattern) {
+			continue
+		}
+		op := item.GetOperation(method)
+		if !assert.NotNil(t, op, "%s isn't documented", rt.pattern) {
+			continue
+		}
+
+		// Public operations opt out of the API key required by default
+		if rt.role == public {
+			assert.True(t, op.Security != nil && len(*op.Security) == 0, "%s is documented to require an API key", rt.pattern)
+			assert.NotContains(t, op.Extensions, "x-role", "%s is documented to require a role", rt.pattern)
+		} else {
+			assert.Nil(t, op.Security, "%s isn't documented to require an API key", rt.pattern)
+			assert.Equal(t, string(rt.role), op.Extensions["x-role"], "%s is documented to require another role", rt.pattern)
+		}
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			assert.True(t, registered[method+" "+path], "%s %s is documented but not routed", method, path)
+		}
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	app := NewTestApp()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil)
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestDocsHandler(t *testing.T) {
+	app := NewTestApp()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/docs", nil)
+	rr := serve(t, app, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rr.Body.String(), "/api/openapi.json")
+}
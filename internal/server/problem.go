@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+)
+
+const problemContentType = "application/problem+json"
+
+// Stable codes of problems for clients to match on instead of the messages
+const (
+	codeInvalidRequest       = "invalid_request" // the body, a header or a parameter can't be read
+	codeInvalidOrder         = "invalid_order"
+	codeInvalidSize          = "invalid_size"
+	codeInvalidArgument      = "invalid_argument" // any other invalid input
+	codeUnauthenticated      = "unauthenticated"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codePreconditionFailed   = "precondition_failed"
+	codePreconditionRequired = "precondition_required"
+	codePatchFailed          = "patch_failed"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeRequestTooLarge      = "request_too_large"
+	codeRateLimited          = "rate_limited"
+	codeOverloaded           = "overloaded"
+	codeRepoUnavailable      = "repo_unavailable"
+	codeInternal             = "internal_error"
+)
+
+// fieldCodes are the codes of invalid input fields that have their own, the others are invalid_argument
+var fieldCodes = map[string]string{
+	"order": codeInvalidOrder,
+	"sizes": codeInvalidSize,
+}
+
+// problem is an RFC 7807 problem details object extended with a code and the invalid fields
+type problem struct {
+	Type     string         `json:"type"`
+	Title    string         `json:"title"`
+	Status   int            `json:"status"`
+	Detail   string         `json:"detail,omitempty"`
+	Instance string         `json:"instance,omitempty"`
+	Code     string         `json:"code"`
+	Fields   []fieldProblem `json:"fields,omitempty"`
+	// RequestID is the X-Request-ID of the request, to find it in the logs
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// fieldProblem is what's wrong with a single field, header or parameter of the request
+type fieldProblem struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// requestError is a problem with the request found by a handler itself rather than by the pack package
+type requestError struct {
+	status int
+	code   string
+	field  string // the field, header or parameter at fault if there is a single one
+	err    error
+	// retryAfter is when the client may try again, sent as the Retry-After header if it's set
+	retryAfter time.Duration
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// badRequest reports a field, header or parameter that can't be read, field may be empty if it's not known
+func badRequest(field string, err error) error {
+	return &requestError{status: http.StatusBadRequest, code: codeInvalidRequest, field: field, err: err}
+}
+
+// newProblem maps an error of a handler to the problem reported to the client, see classifyError().
+// The details of server errors aren't exposed, they are only logged.
+func newProblem(r *http.Request, err error, conditional bool) problem {
+	p := classifyError(err, conditional)
+
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+	p.RequestID = requestID(r)
+
+	return p
+}
+
+// classifyError finds the status, code, detail and fields of the problem err maps to.
+// A conflict is a failed precondition if the change was conditional on the version it's based on.
+func classifyError(err error, conditional bool) problem {
+	var p problem
+
+	var reqErr *requestError
+	var fieldErr *pack.FieldError
+	switch {
+	case errors.As(err, &reqErr):
+		p.Status, p.Code, p.Detail = reqErr.status, reqErr.code, err.Error()
+		if reqErr.field != "" {
+			p.Fields = []fieldProblem{{Field: reqErr.field, Detail: reqErr.err.Error()}}
+		}
+	case errors.As(err, &fieldErr):
+		p.Status, p.Code, p.Detail = http.StatusBadRequest, codeInvalidArgument, err.Error()
+		if code, ok := fieldCodes[fieldErr.Field]; ok {
+			p.Code = code
+		}
+		p.Fields = []fieldProblem{{Field: fieldErr.Field, Detail: fieldErr.Reason}}
+	case errors.Is(err, pack.ErrInvalidArg):
+		p.Status, p.Code, p.Detail = http.StatusBadRequest, codeInvalidArgument, err.Error()
+	case errors.Is(err, errPatchFailed):
+		p.Status, p.Code, p.Detail = http.StatusConflict, codePatchFailed, err.Error()
+	case errors.Is(err, pack.ErrNotFound):
+		p.Status, p.Code, p.Detail = http.StatusNotFound, codeNotFound, err.Error()
+	case errors.Is(err, pack.ErrConflict) && conditional:
+		// The version the client based the change on isn't the current one anymore
+		p.Status, p.Code, p.Detail = http.StatusPreconditionFailed, codePreconditionFailed, err.Error()
+	case errors.Is(err, pack.ErrConflict):
+		p.Status, p.Code, p.Detail = http.StatusConflict, codeConflict, err.Error()
+	case errors.Is(err, pack.ErrUnavailable):
+		p.Status, p.Code, p.Detail = http.StatusServiceUnavailable, codeRepoUnavailable, "the repository is unavailable, try again later"
+	default:
+		p.Status, p.Code, p.Detail = http.StatusInternalServerError, codeInternal, "the request couldn't be handled"
+	}
+
+	return p
+}
+
+// writeError logs err and responds with the problem it maps to
+func (a *App) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	a.writeProblem(w, r, err, false)
+}
+
+// writeConditionalError is writeError for a change conditional on the version in the If-Match header,
+// which reports a conflict as a failed precondition
+func (a *App) writeConditionalError(w http.ResponseWriter, r *http.Request, err error) {
+	a.writeProblem(w, r, err, true)
+}
+
+func (a *App) writeProblem(w http.ResponseWriter, r *http.Request, err error, conditional bool) {
+	a.loggerFor(r.Context()).Error(err.Error(), "url", r.RequestURI)
+
+	p := newProblem(r, err, conditional)
+	if p.Status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	var reqErr *requestError
+	if errors.As(err, &reqErr) && reqErr.retryAfter > 0 {
+		// Rounded up, so clients don't come back too early
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(reqErr.retryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
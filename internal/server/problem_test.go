@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+)
+
+// assertProblem checks that rr is a problem details response matching its status and returns the problem
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder) problem {
+	t.Helper()
+
+	assert.Equal(t, problemContentType, rr.Header().Get("Content-Type"))
+
+	var p problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, rr.Code, p.Status)
+	assert.Equal(t, http.StatusText(rr.Code), p.Title)
+	assert.NotEmpty(t, p.Code)
+	assert.NotEmpty(t, p.Detail)
+
+	return p
+}
+
+func TestNewProblem(t *testing.T) {
+	typeErr := json.Unmarshal([]byte(`{"order": "251"}`), &calculatePacksRequest{})
+
+	tests := []struct {
+		name           string
+		err            error
+		ifMatch        string
+		conditional    bool
+		expectedStatus int
+		expectedCode   string
+		expectedFields []fieldProblem
+		hiddenDetail   bool
+	}{
+		{
+			name:           "Mistyped body field",
+			err:            decodeError(typeErr),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+			expectedFields: []fieldProblem{{Field: "order", Detail: "must be an integer"}},
+		},
+		{
+			name:           "Malformed body",
+			err:            decodeError(errors.New("unexpected EOF")),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidRequest,
+		},
+		{
+			name:           "Invalid order",
+			err:            &pack.FieldError{Field: "order", Reason: "order amount is not positive"},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidOrder,
+			expectedFields: []fieldProblem{{Field: "order", Detail: "order amount is not positive"}},
+		},
+		{
+			name:           "Invalid size wrapped",
+			err:            fmt.Errorf("pack sizes version 2: %w", &pack.FieldError{Field: "sizes", Reason: "duplicate size: 5"}),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidSize,
+			expectedFields: []fieldProblem{{Field: "sizes", Detail: "duplicate size: 5"}},
+		},
+		{
+			name:           "Invalid other field",
+			err:            &pack.FieldError{Field: "max_sizes", Reason: "max sizes is not positive"},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidArgument,
+			expectedFields: []fieldProblem{{Field: "max_sizes", Detail: "max sizes is not positive"}},
+		},
+		{
+			name:           "Invalid argument",
+			err:            fmt.Errorf("%w: unsupported operation", pack.ErrInvalidArg),
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   codeInvalidArgument,
+		},
+		{
+			name:           "Failed patch",
+			err:            fmt.Errorf("operation 0: %w", errPatchFailed),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   codePatchFailed,
+		},
+		{
+			name:           "Not found",
+			err:            fmt.Errorf("pack sizes version 5: %w", pack.ErrNotFound),
+			expectedStatus: http.StatusNotFound,
+			expectedCode:   codeNotFound,
+		},
+		{
+			name:           "Conflict with If-Match",
+			err:            fmt.Errorf("%w: expected version 1, current is 2", pack.ErrConflict),
+			ifMatch:        `"1"`,
+			conditional:    true,
+			expectedStatus: http.StatusPreconditionFailed,
+			expectedCode:   codePreconditionFailed,
+		},
+		{
+			name:           "Conflict with a stray If-Match",
+			err:            fmt.Errorf("%w: pack sizes version 1 is not scheduled", pack.ErrConflict),
+			ifMatch:        `"1"`,
+			expectedStatus: http.StatusConflict,
+			expectedCode:   codeConflict,
+		},
+		{
+			name:           "Conflict",
+			err:            fmt.Errorf("%w: pack sizes version 1 is not scheduled", pack.ErrConflict),
+			expectedStatus: http.StatusConflict,
+			expectedCode:   codeConflict,
+		},
+		{
+			name:           "Repository unavailable",
+			err:            fmt.Errorf("%w: dial tcp: connection refused", pack.ErrUnavailable),
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedCode:   codeRepoUnavailable,
+			hiddenDetail:   true,
+		},
+		{
+			name:           "Internal error",
+			err:            fmt.Errorf("couldn't get pack sizes: %w", assert.AnError),
+			expectedStatus: http.StatusInternalServerError,
+			expectedCode:   codeInternal,
+			hiddenDetail:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v2/sizes", nil)
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			p := newProblem(req, tt.err, tt.conditional)
+
+			assert.Equal(t, tt.expectedStatus, p.Status)
+			assert.Equal(t, tt.expectedCode, p.Code)
+			assert.Equal(t, tt.expectedFields, p.Fields)
+			assert.Equal(t, "about:blank", p.Type)
+			assert.Equal(t, http.StatusText(tt.expectedStatus), p.Title)
+			assert.Equal(t, "/api/v2/sizes", p.Instance)
+			if tt.hiddenDetail {
+				assert.NotContains(t, p.Detail, tt.err.Error(), "server errors aren't exposed")
+			} else {
+				assert.Equal(t, tt.err.Error(), p.Detail)
+			}
+		})
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	app := NewTestApp()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", nil)
+	rr := httptest.NewRecorder()
+
+	app.writeError(rr, req, &pack.FieldError{Field: "order", Reason: "order amount is not positive"})
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	p := assertProblem(t, rr)
+	assert.Equal(t, codeInvalidOrder, p.Code)
+}
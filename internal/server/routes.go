@@ -2,20 +2,85 @@ package server
 
 import (
 	"net/http"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
 )
 
+// public routes don't require an API key even when auth is enabled
+const public pack.Role = ""
+
+// unlimitedRoutes aren't rate limited. Probes and scrapers often share an address with many clients
+// behind a load balancer, and a rate limited /readyz would take the instance out of rotation.
+var unlimitedRoutes = map[string]bool{
+	"GET /healthz": true,
+	"GET /readyz":  true,
+	"GET /metrics": true,
+}
+
+// route is a ServeMux pattern with the role it requires and its handler.
+// Every route is documented in openapi.json, which is checked by the tests.
+type route struct {
+	pattern string
+	role    pack.Role
+	handler http.HandlerFunc
+}
+
 func (a *App) NewRouter() http.Handler {
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("/", a.uiHandler)
+	for _, rt := range a.routes() {
+		handler := rt.handler
+		if !unlimitedRoutes[rt.pattern] {
+			handler = a.limitRate(handler)
+		}
+		mux.HandleFunc(rt.pattern, a.authorize(rt.role, handler))
+	}
+
+	var handler http.Handler = mux
+	handler = a.instrument(mux, handler)
+	handler = a.logRequests(mux, handler)
+	handler = a.traceRequests(mux, handler)
+
+	return handler
+}
+
+func (a *App) routes() []route {
+	return []route{
+		{"/", public, a.uiHandler},
+
+		{"GET /healthz", public, a.healthzHandler},
+		{"GET /readyz", public, a.readyzHandler},
+
+		{"GET /api/openapi.json", public, a.openAPIHandler},
+		{"GET /api/docs", public, a.docsHandler},
 
-	// API versioning for backwards compatibility in case the functionality will change
-	mux.HandleFunc("POST /api/v1/calculate-packs", a.calculatePacksHandlerV1)
+		// API versioning for backwards compatibility in case the functionality will change
+		{"POST /api/v1/calculate-packs", pack.RoleCalculator, a.limitCalculations(a.calculatePacksHandlerV1)},
 
-	// V2
-	mux.HandleFunc("POST /api/v2/calculate-packs", a.calculatePacksHandler)
-	mux.HandleFunc("POST /api/v2/sizes", a.storePackSizesHandler)
-	mux.HandleFunc("GET /api/v2/sizes", a.retrievePackSizesHandler)
+		// V2
+		{"POST /api/v2/calculate-packs", pack.RoleCalculator, a.limitCalculations(a.calculatePacksHandler)},
+		{"POST /api/v2/sizes", pack.RoleAdmin, a.storePackSizesHandler},
+		{"GET /api/v2/sizes", pack.RoleReader, a.retrievePackSizesHandler},
+		{"PATCH /api/v2/sizes", pack.RoleAdmin, a.patchPackSizesHandler},
+		{"PUT /api/v2/sizes/{size}", pack.RoleAdmin, a.putPackSizeHandler},
+		{"DELETE /api/v2/sizes/{size}", pack.RoleAdmin, a.deletePackSizeHandler},
+		{"GET /api/v2/sizes/versions", pack.RoleReader, a.listPackSizeVersionsHandler},
+		{"GET /api/v2/sizes/versions/{version}", pack.RoleReader, a.retrievePackSizeVersionHandler},
+		{"POST /api/v2/sizes/versions/{version}/rollback", pack.RoleAdmin, a.rollbackPackSizesHandler},
+		{"GET /api/v2/sizes/scheduled", pack.RoleReader, a.listScheduledPackSizesHandler},
+		{"POST /api/v2/sizes/scheduled", pack.RoleAdmin, a.schedulePackSizesHandler},
+		{"DELETE /api/v2/sizes/scheduled/{version}", pack.RoleAdmin, a.cancelScheduledPackSizesHandler},
+		{"POST /api/v2/sizes/simulate", pack.RoleCalculator, a.limitCalculations(a.simulatePackSizesHandler)},
+		{"POST /api/v2/recommend-sizes", pack.RoleCalculator, a.limitCalculations(a.recommendPackSizesHandler)},
+		{"GET /api/v2/calculations", pack.RoleReader, a.listCalculationsHandler},
+		{"GET /api/v2/audit", pack.RoleReader, a.listAuditEntriesHandler},
+		{"GET /api/v2/export", pack.RoleReader, a.exportConfigHandler},
+		{"POST /api/v2/import", pack.RoleAdmin, a.importConfigHandler},
+		{"GET /api/v2/keys", pack.RoleAdmin, a.listAPIKeysHandler},
+		{"POST /api/v2/keys", pack.RoleAdmin, a.createAPIKeyHandler},
+		{"DELETE /api/v2/keys/{id}", pack.RoleAdmin, a.revokeAPIKeyHandler},
 
-	return mux
+		{"GET /debug/pool", pack.RoleAdmin, a.poolStatsHandler},
+		{"GET /metrics", pack.RoleReader, a.metricsHandler},
+	}
 }
@@ -6,6 +6,11 @@ import (
 	"fmt"
 	"html/template"
 	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"sync/atomic"
+	"time"
 
 	"github.com/achere/homework-pack-sizes/internal/pack"
 	"github.com/joeshaw/envdecode"
@@ -14,21 +19,107 @@ import (
 //go:embed templates
 var content embed.FS
 
+// openAPISpec is the OpenAPI document of all routes
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
 const (
 	defaultPort = 8080
+	// defaultGRPCPort is the port of the gRPC API, see NewGRPCServer()
+	defaultGRPCPort = 9090
+	// defaultSizeCacheTTL bounds how long cached pack sizes are served if a change notification is missed
+	defaultSizeCacheTTL = time.Minute
+	// defaultDBQueryTimeout keeps requests from hanging on a slow database
+	defaultDBQueryTimeout = 5 * time.Second
+	// defaultDBMaxRetries and defaultDBRetryBackoff ride out a database restart of a few seconds
+	defaultDBMaxRetries   = 3
+	defaultDBRetryBackoff = 100 * time.Millisecond
+	// defaultMaxBodyBytes fits an export of thousands of pack sizes versions
+	defaultMaxBodyBytes = 1 << 20
+	maxHistogramOrders  = 100
+	// minAdminAPIKeyLen keeps the bootstrap key from being guessed
+	minAdminAPIKeyLen = 32
+	// defaultRateLimit and defaultRateBurst are generous for people using the UI and scripts alike
+	defaultRateLimit = 10
+	defaultRateBurst = 20
+	// defaultMaxQueuedCalculations and defaultCalculationQueueTimeout let bursts of calculations wait
+	// for a CPU instead of failing right away
+	defaultMaxQueuedCalculations   = 100
+	defaultCalculationQueueTimeout = 2 * time.Second
+	// defaultShutdownDelay gives load balancers probing /readyz every few seconds time to notice the shutdown
+	defaultShutdownDelay = 5 * time.Second
+	// defaultSimulationOrders is the number of most recent calculations replayed by a simulation
+	defaultSimulationOrders = 1000
+	defaultCalculationsPage = 100
+	maxCalculationsPage     = 1000
+	defaultAuditPage        = 100
+	maxAuditPage            = 1000
+
+	// authorHeader identifies who makes changes to the stored configuration
+	authorHeader = "X-Author"
 )
 
 type App struct {
-	Config   *Config
-	logger   *slog.Logger
-	SizeRepo pack.PackSizeRepo
-	template *template.Template
+	Config    *Config
+	logger    *slog.Logger
+	SizeRepo  pack.PackSizeRepo
+	CalcRepo  pack.CalculationRepo
+	AuditRepo pack.AuditRepo
+	KeyRepo   pack.APIKeyRepo
+	// PoolStats reports statistics of the database connection pool, nil if there is none
+	PoolStats func() any
+	// ReadyChecks are the dependencies /readyz checks by name, e.g. the database
+	ReadyChecks map[string]CheckFunc
+	template    *template.Template
+	// rateLimiter and calcLimiter are nil if the limits are disabled
+	rateLimiter *clientLimiter
+	calcLimiter *calcLimiter
+	metrics     *metrics
+	// shuttingDown is set by StartShutdown()
+	shuttingDown atomic.Bool
 }
 
 type Config struct {
-	Port  int    `env:"PORT"`
-	Order string `env:"ORDER"`
-	DbUrl string `env:"DB_URL"`
+	Port           int    `env:"PORT"`
+	Order          string `env:"ORDER"`
+	DbUrl          string `env:"DB_URL"`
+	MigrateOnStart bool   `env:"MIGRATE_ON_START"`
+	// SizeCacheTTL is how long Postgres pack sizes are cached, a negative value disables the cache
+	SizeCacheTTL time.Duration `env:"SIZE_CACHE_TTL"`
+	// DBQueryTimeout bounds every database query, a negative value disables the timeout
+	DBQueryTimeout time.Duration `env:"DB_QUERY_TIMEOUT"`
+	// DBMaxRetries is how many times queries failed with transient errors are retried, a negative value disables retries
+	DBMaxRetries   int           `env:"DB_MAX_RETRIES"`
+	DBRetryBackoff time.Duration `env:"DB_RETRY_BACKOFF"`
+	// DBMaxConns and DBMinConns size the connection pool, the pool_max_conns and pool_min_conns parameters of DB_URL
+	// or the driver defaults are used if they are 0
+	DBMaxConns int32 `env:"DB_MAX_CONNS"`
+	DBMinConns int32 `env:"DB_MIN_CONNS"`
+	// DBReplicaURL is an optional Postgres hot standby serving reads
+	DBReplicaURL string `env:"DB_REPLICA_URL"`
+	// MaxBodyBytes limits the size of request bodies
+	MaxBodyBytes int64 `env:"MAX_BODY_BYTES"`
+	// AuthEnabled requires API keys with the roles given in routes()
+	AuthEnabled bool `env:"AUTH_ENABLED"`
+	// AdminAPIKey is accepted as an admin key without being stored, so the first keys can be created
+	AdminAPIKey string `env:"ADMIN_API_KEY"`
+	// RateLimit is how many requests per second an API key or a client address may make on average
+	// and RateBurst how many at once, a negative RateLimit disables rate limiting
+	RateLimit float64 `env:"RATE_LIMIT"`
+	RateBurst int     `env:"RATE_BURST"`
+	// MaxCalculations caps the calculations running at once, the others wait in a queue of MaxQueuedCalculations
+	// for CalculationQueueTimeout at most. A negative MaxCalculations disables the cap.
+	MaxCalculations         int           `env:"MAX_CALCULATIONS"`
+	MaxQueuedCalculations   int           `env:"MAX_QUEUED_CALCULATIONS"`
+	CalculationQueueTimeout time.Duration `env:"CALCULATION_QUEUE_TIMEOUT"`
+	// TracesExporter is where spans are exported: none, otlp or stdout, see SetupTracing()
+	TracesExporter string `env:"TRACES_EXPORTER"`
+	// ShutdownDelay is how long /readyz fails before the server stops accepting requests on shutdown,
+	// a negative value shuts down right away
+	ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY"`
+	// GRPCPort is the port of the gRPC API, a negative value disables it
+	GRPCPort int `env:"GRPC_PORT"`
 }
 
 // NewApp creates a new App, initialising the config from environment variables.
@@ -37,6 +128,7 @@ func NewApp(ctx context.Context, logger *slog.Logger) (*App, error) {
 
 	app.logger = logger
 	app.Config = &Config{}
+	app.metrics = newMetrics()
 
 	err := envdecode.Decode(app.Config)
 	if err != nil {
@@ -49,6 +141,60 @@ func NewApp(ctx context.Context, logger *slog.Logger) (*App, error) {
 	if app.Config.Port == 0 {
 		app.Config.Port = defaultPort
 	}
+	if app.Config.GRPCPort == 0 {
+		app.Config.GRPCPort = defaultGRPCPort
+	}
+	if app.Config.SizeCacheTTL == 0 {
+		app.Config.SizeCacheTTL = defaultSizeCacheTTL
+	}
+	if app.Config.DBQueryTimeout == 0 {
+		app.Config.DBQueryTimeout = defaultDBQueryTimeout
+	}
+	if app.Config.DBMaxRetries == 0 {
+		app.Config.DBMaxRetries = defaultDBMaxRetries
+	}
+	if app.Config.DBRetryBackoff <= 0 {
+		app.Config.DBRetryBackoff = defaultDBRetryBackoff
+	}
+	if app.Config.MaxBodyBytes <= 0 {
+		app.Config.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	if app.Config.RateLimit == 0 {
+		app.Config.RateLimit = defaultRateLimit
+	}
+	if app.Config.RateBurst <= 0 {
+		app.Config.RateBurst = defaultRateBurst
+	}
+	if app.Config.MaxCalculations == 0 {
+		app.Config.MaxCalculations = runtime.GOMAXPROCS(0)
+	}
+	if app.Config.MaxQueuedCalculations <= 0 {
+		app.Config.MaxQueuedCalculations = defaultMaxQueuedCalculations
+	}
+	if app.Config.CalculationQueueTimeout <= 0 {
+		app.Config.CalculationQueueTimeout = defaultCalculationQueueTimeout
+	}
+	if app.Config.ShutdownDelay == 0 {
+		app.Config.ShutdownDelay = defaultShutdownDelay
+	}
+	if app.Config.RateLimit > 0 {
+		app.rateLimiter = newClientLimiter(app.Config.RateLimit, app.Config.RateBurst)
+	}
+	if app.Config.MaxCalculations > 0 {
+		app.calcLimiter = newCalcLimiter(
+			app.Config.MaxCalculations,
+			app.Config.MaxQueuedCalculations,
+			app.Config.CalculationQueueTimeout,
+		)
+	}
+	switch app.Config.TracesExporter {
+	case "", tracesExporterNone, tracesExporterOTLP, tracesExporterStdout:
+	default:
+		return nil, fmt.Errorf("unsupported TRACES_EXPORTER %q, expected none, otlp or stdout", app.Config.TracesExporter)
+	}
+	if app.Config.AdminAPIKey != "" && len(app.Config.AdminAPIKey) < minAdminAPIKeyLen {
+		return nil, fmt.Errorf("ADMIN_API_KEY must be at least %d characters long", minAdminAPIKeyLen)
+	}
 
 	app.template, err = template.ParseFS(content, "templates/index.html")
 	if err != nil {
@@ -57,3 +203,40 @@ func NewApp(ctx context.Context, logger *slog.Logger) (*App, error) {
 
 	return app, nil
 }
+
+// recordCalculation stores a calculation in CalcRepo if it is set.
+// Failing to record is logged and doesn't affect the response.
+func (a *App) recordCalculation(ctx context.Context, calc pack.Calculation) {
+	if a.CalcRepo == nil {
+		return
+	}
+
+	if err := a.CalcRepo.StoreCalculation(ctx, calc); err != nil {
+		a.loggerFor(ctx).Error("failed to record calculation", "err", err)
+	}
+}
+
+// author returns the identity of whoever makes the request: the name of the API key if it was authorized with one,
+// and the X-Author header otherwise
+func author(r *http.Request) string {
+	if key, ok := requestAPIKey(r); ok {
+		return key.Name
+	}
+	return r.Header.Get(authorHeader)
+}
+
+// changeContext returns a context for changing the stored configuration on behalf of the request.
+// It isn't cancelled when the client disconnects, keeps the values of the request context such as its trace
+// and request ID, and carries the client address for the audit log.
+func changeContext(r *http.Request) context.Context {
+	return pack.WithClientIP(context.WithoutCancel(r.Context()), clientIP(r))
+}
+
+// clientIP returns the address of the peer making the request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
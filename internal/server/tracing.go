@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName  = "github.com/achere/homework-pack-sizes/internal/server"
+	serviceName = "pack-sizes"
+
+	// Values of Config.TracesExporter
+	tracesExporterNone   = "none"
+	tracesExporterOTLP   = "otlp"
+	tracesExporterStdout = "stdout"
+)
+
+// SetupTracing makes the global tracer provider export spans as configured by Config.TracesExporter
+// and propagates W3C trace context from incoming requests. The returned function flushes the spans
+// that weren't exported yet and must be called on shutdown.
+func (a *App) SetupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newTraceExporter(ctx, a.Config.TracesExporter, os.Stdout)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(serviceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// newTraceExporter creates the exporter named by Config.TracesExporter, nil for none.
+// OTLP is sent over HTTP as configured by the standard OTEL_EXPORTER_OTLP_* variables, stdout is written to out.
+func newTraceExporter(ctx context.Context, name string, out io.Writer) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "", tracesExporterNone:
+		return nil, nil
+	case tracesExporterOTLP:
+		return otlptracehttp.New(ctx)
+	case tracesExporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(out))
+	default:
+		return nil, fmt.Errorf("unsupported TRACES_EXPORTER %q, expected none, otlp or stdout", name)
+	}
+}
+
+// traceRequests starts a server span for every request handled by next, continuing the trace of the caller
+// if it sent a traceparent header. The span is named by the method and the path of the route of mux it matches.
+func (a *App) traceRequests(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Method
+		attrs := []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)}
+		// Patterns such as "POST /api/v2/calculate-packs" or "/" for the UI
+		if route := routeOf(mux, r); route != unmatchedRoute {
+			_, path, hasMethod := strings.Cut(route, " ")
+			if !hasMethod {
+				path = route
+			}
+			name += " " + path
+			attrs = append(attrs, semconv.HTTPRoute(path))
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(tracerName).Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.statusCode()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
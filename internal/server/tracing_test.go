@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achere/homework-pack-sizes/internal/pack"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans makes the global tracer provider record the spans ended during the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return recorder
+}
+
+func TestTraceRequests(t *testing.T) {
+	recorder := recordSpans(t)
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{Version: 3, Sizes: []int{250, 500}}, nil
+		},
+	}
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/api/v2/calculate-packs", strings.NewReader(`{"order": 251}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	rr := serve(t, app, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Len(t, spans, 4)
+
+	server := spans["POST /api/v2/calculate-packs"]
+	require.NotNil(t, server)
+	assert.Equal(t, traceID, server.SpanContext().TraceID().String(), "the trace of the caller is continued")
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	assert.Contains(t, server.Attributes(), attribute.String("http.route", "/api/v2/calculate-packs"))
+	assert.Contains(t, server.Attributes(), attribute.Int("http.response.status_code", http.StatusOK))
+
+	calculate := spans["CalculatePacksWithRepo"]
+	require.NotNil(t, calculate)
+	assert.Equal(t, server.SpanContext().SpanID(), calculate.Parent().SpanID())
+	assert.Contains(t, calculate.Attributes(), attribute.Int("pack.order", 251))
+
+	repo := spans["GetPackSizes"]
+	require.NotNil(t, repo)
+	assert.Equal(t, calculate.SpanContext().SpanID(), repo.Parent().SpanID())
+	assert.Contains(t, repo.Attributes(), attribute.Int("pack.version", 3))
+
+	solver := spans["Calculate"]
+	require.NotNil(t, solver)
+	assert.Equal(t, calculate.SpanContext().SpanID(), solver.Parent().SpanID())
+	assert.Contains(t, solver.Attributes(), attribute.String("pack.solver", string(pack.SolverDP)))
+}
+
+func TestTraceRequests_Error(t *testing.T) {
+	recorder := recordSpans(t)
+
+	app := NewTestApp()
+	app.SizeRepo = &SizeRepoStub{
+		getPackSizes: func(ctx context.Context) (pack.SizeSet, error) {
+			return pack.SizeSet{}, pack.ErrUnavailable
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v2/sizes", nil)
+	rr := serve(t, app, req)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "GET /api/v2/sizes", spans[0].Name())
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.False(t, spans[0].Parent().IsValid(), "a new trace is started without traceparent")
+}
+
+func TestNewTraceExporter(t *testing.T) {
+	var out bytes.Buffer
+
+	exporter, err := newTraceExporter(context.Background(), "", &out)
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	exporter, err = newTraceExporter(context.Background(), tracesExporterStdout, &out)
+	require.NoError(t, err)
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	_, span := provider.Tracer("test").Start(context.Background(), "exported")
+	span.End()
+	require.NoError(t, provider.Shutdown(context.Background()))
+	assert.Contains(t, out.String(), `"Name":"exported"`)
+
+	_, err = newTraceExporter(context.Background(), "zipkin", &out)
+	assert.Error(t, err)
+}